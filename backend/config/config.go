@@ -1,89 +1,346 @@
-package config
-
-import (
-	"encoding/json"
-	"os"
-)
-
-type Config struct {
-	Server ServerConfig `json:"server"`
-	User   UserConfig   `json:"user"`
-	File   FileConfig   `json:"file"`
-	System SystemConfig `json:"system"`
-}
-
-type ServerConfig struct {
-	Port string `json:"port"`
-}
-
-type UserConfig struct {
-	AdminUsername string `json:"admin_username"`
-	AdminPassword string `json:"admin_password"`
-}
-
-type FileConfig struct {
-	UploadPath string `json:"upload_path"`
-	MaxSize    int64  `json:"max_size"`
-}
-
-type SystemConfig struct {
-	DataFile string `json:"data_file"`
-	Interval int    `json:"interval"`
-}
-
-var config *Config
-
-// InitConfig 初始化配置
-func InitConfig() {
-	// 默认配置
-	config = &Config{
-		Server: ServerConfig{
-			Port: "8080",
-		},
-		User: UserConfig{
-			AdminUsername: "admin",
-			AdminPassword: "admin123",
-		},
-		File: FileConfig{
-			UploadPath: "./upload",
-			MaxSize:    100 << 20, // 100MB
-		},
-		System: SystemConfig{
-			DataFile: "./system/system_history.json",
-			Interval: 60, // 1分钟
-		},
-	}
-
-	// 从文件加载配置（如果存在）
-	loadConfigFromFile()
-}
-
-// GetConfig 获取配置
-func GetConfig() *Config {
-	return config
-}
-
-// 从文件加载配置
-func loadConfigFromFile() {
-	file, err := os.ReadFile("./backend/config/config.json")
-	if err != nil {
-		// 如果文件不存在，使用默认配置
-		return
-	}
-
-	err = json.Unmarshal(file, config)
-	if err != nil {
-		// 如果解析失败，使用默认配置
-		return
-	}
-}
-
-// 保存配置到文件
-func SaveConfig() error {
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile("./backend/config/config.json", data, 0644)
-}
+package config
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// configFile 配置文件路径
+const configFile = "./backend/config/config.json"
+
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	User      UserConfig      `json:"user"`
+	Session   SessionConfig   `json:"session"`
+	Token     TokenConfig     `json:"token"`
+	TwoFactor TwoFactorConfig `json:"two_factor"`
+	Login     LoginConfig     `json:"login"`
+	OIDC      OIDCConfig      `json:"oidc"`
+	LDAP      LDAPConfig      `json:"ldap"`
+	File      FileConfig      `json:"file"`
+	Share     ShareConfig     `json:"share"`
+	Access    AccessConfig    `json:"access"`
+	ACL       ACLConfig       `json:"acl"`
+	System    SystemConfig    `json:"system"`
+}
+
+type ServerConfig struct {
+	Port           string   `json:"port"`
+	TrustedProxies []string `json:"trusted_proxies"` // 可信的反向代理地址或网段，只有来自这些地址的请求才使用X-Forwarded-For中的客户端IP，为空时不信任任何代理
+}
+
+type UserConfig struct {
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password"` // 初始管理员密码，启动时明文会被替换为bcrypt哈希
+	DataFile      string `json:"data_file"`
+}
+
+type SessionConfig struct {
+	Secret      string `json:"secret"`       // 令牌签名密钥，为空时启动时随机生成
+	TTL         int    `json:"ttl"`          // 空闲超时（秒），每次访问自动续期
+	MaxLifetime int    `json:"max_lifetime"` // 最长有效期（秒），超过后必须重新登录
+	// 除本站外允许发起修改请求的来源（如https://drive.example.com），反向代理改写了Host时需要配置
+	TrustedOrigins []string `json:"trusted_origins"`
+}
+
+type TokenConfig struct {
+	DataFile string `json:"data_file"` // API令牌数据（只保存哈希）
+}
+
+type TwoFactorConfig struct {
+	Issuer   string `json:"issuer"`    // 身份验证器应用中显示的服务名称
+	DataFile string `json:"data_file"` // TOTP密钥和恢复码哈希
+}
+
+type LoginConfig struct {
+	MaxFailures     int `json:"max_failures"`     // 同一用户名连续失败多少次后锁定，0表示不锁定
+	IPMaxFailures   int `json:"ip_max_failures"`  // 同一IP连续失败多少次后锁定，0表示不锁定
+	LockoutDuration int `json:"lockout_duration"` // 锁定时长（秒）
+	BackoffBase     int `json:"backoff_base"`     // 失败后的等待时间（秒），每多失败一次翻倍
+	BackoffMax      int `json:"backoff_max"`      // 最长等待时间（秒）
+	FailureWindow   int `json:"failure_window"`   // 超过该时间（秒）没有新的失败时清零失败次数
+}
+
+type OIDCConfig struct {
+	Enabled           bool     `json:"enabled"`
+	DisplayName       string   `json:"display_name"` // 登录框中单点登录按钮的文字
+	Issuer            string   `json:"issuer"`       // 身份提供方地址，通过/.well-known/openid-configuration自动发现端点
+	ClientID          string   `json:"client_id"`
+	ClientSecret      string   `json:"client_secret"` // 公开客户端可以为空，仅依赖PKCE
+	RedirectURL       string   `json:"redirect_url"`  // 回调地址，如https://drive.example.com/api/auth/oidc/callback
+	Scopes            []string `json:"scopes"`
+	UsernameClaim     string   `json:"username_claim"` // 作为本地用户名的声明，令牌中没有该声明时使用邮箱
+	EmailClaim        string   `json:"email_claim"`
+	GroupsClaim       string   `json:"groups_claim"`
+	AdminGroups       []string `json:"admin_groups"`        // 属于这些组的用户映射为管理员
+	EditorGroups      []string `json:"editor_groups"`       // 属于这些组的用户映射为编辑者
+	DefaultRole       string   `json:"default_role"`        // 不属于以上组的用户的角色
+	AutoProvision     bool     `json:"auto_provision"`      // 首次登录时自动创建本地用户
+	LinkExistingUsers bool     `json:"link_existing_users"` // 允许关联同名的已有本地用户，只应在身份提供方可信时开启
+	DataFile          string   `json:"data_file"`           // 身份提供方账号与本地用户的关联
+}
+
+type LDAPConfig struct {
+	Enabled            bool     `json:"enabled"`
+	URL                string   `json:"url"` // ldap://host:389或ldaps://host:636
+	StartTLS           bool     `json:"start_tls"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"` // 不校验服务器证书，仅用于测试环境
+	BindDN             string   `json:"bind_dn"`              // 查询用户的服务账号，为空时匿名查询
+	BindPassword       string   `json:"bind_password"`
+	BaseDN             string   `json:"base_dn"`
+	UserFilter         string   `json:"user_filter"`        // {username}替换为转义后的登录用户名
+	UsernameAttribute  string   `json:"username_attribute"` // 作为本地用户名的属性
+	EmailAttribute     string   `json:"email_attribute"`
+	GroupAttribute     string   `json:"group_attribute"`      // 用户条目中列出所属组的属性，如memberOf
+	GroupBaseDN        string   `json:"group_base_dn"`        // 不为空时再按group_filter搜索用户所属的组
+	GroupFilter        string   `json:"group_filter"`         // {dn}替换为用户DN，{username}替换为用户名
+	GroupNameAttribute string   `json:"group_name_attribute"` // 组名属性
+	AdminGroups        []string `json:"admin_groups"`         // 属于这些组（组名或DN）的用户映射为管理员
+	EditorGroups       []string `json:"editor_groups"`        // 属于这些组（组名或DN）的用户映射为编辑者
+	DefaultRole        string   `json:"default_role"`         // 不属于以上组的用户的角色
+	AutoProvision      bool     `json:"auto_provision"`       // 首次登录时自动创建本地用户
+	LinkExistingUsers  bool     `json:"link_existing_users"`  // 允许关联同名的已有本地用户
+	Timeout            int      `json:"timeout"`              // 连接和请求超时（秒）
+	DataFile           string   `json:"data_file"`            // LDAP账号与本地用户的关联
+}
+
+type FileConfig struct {
+	Storage           string           `json:"storage"`     // 存储驱动：local（本地磁盘，默认）或s3（S3兼容的对象存储）
+	UploadPath        string           `json:"upload_path"` // 本地磁盘驱动的存储目录
+	S3                S3Config         `json:"s3"`
+	Encryption        EncryptionConfig `json:"encryption"`
+	MaxSize           int64            `json:"max_size"`            // 单个文件最大大小（字节），0表示不限制
+	Quota             int64            `json:"quota"`               // 上传目录总容量配额（字节），所有用户共用，0表示不限制
+	UploadSessionTTL  int              `json:"upload_session_ttl"`  // 分片上传会话闲置超时（秒），超时后被清理
+	TrashRetention    int              `json:"trash_retention"`     // 回收站保留时间（秒），超时后自动彻底删除，0表示不自动清理
+	MaxVersions       int              `json:"max_versions"`        // 每个文件最多保留的历史版本数，0表示不保留历史版本
+	VersionRetention  int              `json:"version_retention"`   // 历史版本保留时间（秒），0表示不按时间清理
+	ExtractMaxSize    int64            `json:"extract_max_size"`    // 在线解压时解压出的文件总大小上限（字节），0表示不限制
+	ExtractMaxEntries int              `json:"extract_max_entries"` // 在线解压时压缩包的最大条目数，0表示不限制
+}
+
+// EncryptionConfig 静态加密：文件写入存储前用AES-GCM加密，每个文件使用独立的数据密钥，数据密钥由主密钥加密后保存在文件头部
+// 主密钥为32字节，使用base64编码，可以用openssl rand -base64 32生成
+type EncryptionConfig struct {
+	Enabled      bool     `json:"enabled"`       // 开启后新写入的文件都会加密，已有的明文文件仍可读取，轮换密钥时一并加密
+	Key          string   `json:"key"`           // 当前主密钥
+	KeyFile      string   `json:"key_file"`      // 主密钥文件，优先于key：第一行为当前主密钥，其余行为旧主密钥
+	PreviousKeys []string `json:"previous_keys"` // 旧主密钥，轮换完成前用于解密旧密钥加密的文件
+}
+
+// S3Config S3兼容对象存储（AWS S3、MinIO等）的连接参数
+type S3Config struct {
+	Endpoint        string `json:"endpoint"`          // 服务地址，如https://s3.us-east-1.amazonaws.com
+	Region          string `json:"region"`            // 区域，用于请求签名
+	Bucket          string `json:"bucket"`            // 存储桶
+	Prefix          string `json:"prefix"`            // 对象键前缀，多个实例共用存储桶时使用
+	AccessKeyID     string `json:"access_key_id"`     // 访问密钥，为空时匿名访问
+	SecretAccessKey string `json:"secret_access_key"` // 访问密钥的密码
+	PathStyle       bool   `json:"path_style"`        // 使用路径风格的地址（endpoint/bucket/key），MinIO等需要开启
+	Timeout         int    `json:"timeout"`           // 连接和等待响应的超时（秒）
+}
+
+type ShareConfig struct {
+	DataFile string `json:"data_file"`
+}
+
+type AccessConfig struct {
+	GuestMode string `json:"guest_mode"` // 游客访问模式：open（默认公开）或authenticated（默认需要登录）
+	DataFile  string `json:"data_file"`  // 目录公开/私有规则
+}
+
+type ACLConfig struct {
+	DataFile           string   `json:"data_file"`           // 目录权限数据
+	GroupFile          string   `json:"group_file"`          // 用户组数据
+	DefaultPermissions []string `json:"default_permissions"` // 没有任何匹配条目时登录用户拥有的权限
+}
+
+type SystemConfig struct {
+	DataFile string `json:"data_file"`
+	Interval int    `json:"interval"`
+}
+
+var config *Config
+
+// fileBacked 配置是否来自配置文件，通过SetConfig注入的配置不读写配置文件
+var fileBacked bool
+
+// InitConfig 初始化配置
+func InitConfig() {
+	config = Default()
+	fileBacked = true
+
+	// 从文件加载配置（如果存在）
+	loadConfigFromFile()
+}
+
+// SetConfig 直接使用给定的配置，不读写配置文件，供测试等需要注入配置的场景使用
+func SetConfig(cfg *Config) {
+	config = cfg
+	fileBacked = false
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port: "8080",
+		},
+		User: UserConfig{
+			AdminUsername: "admin",
+			AdminPassword: "admin123",
+			DataFile:      "./data/users.json",
+		},
+		Session: SessionConfig{
+			TTL:         3600,      // 1小时
+			MaxLifetime: 7 * 86400, // 7天
+		},
+		Token: TokenConfig{
+			DataFile: "./data/tokens.json",
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:   "gin_cloud_drive",
+			DataFile: "./data/totp.json",
+		},
+		Login: LoginConfig{
+			MaxFailures:     5,
+			IPMaxFailures:   20,
+			LockoutDuration: 900, // 15分钟
+			BackoffBase:     1,
+			BackoffMax:      30,
+			FailureWindow:   900, // 15分钟
+		},
+		OIDC: OIDCConfig{
+			DisplayName:   "单点登录",
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "preferred_username",
+			EmailClaim:    "email",
+			GroupsClaim:   "groups",
+			DefaultRole:   "editor",
+			AutoProvision: true,
+			DataFile:      "./data/oidc.json",
+		},
+		LDAP: LDAPConfig{
+			UserFilter:         "(uid={username})",
+			UsernameAttribute:  "uid",
+			EmailAttribute:     "mail",
+			GroupAttribute:     "memberOf",
+			GroupFilter:        "(member={dn})",
+			GroupNameAttribute: "cn",
+			DefaultRole:        "editor",
+			AutoProvision:      true,
+			Timeout:            10,
+			DataFile:           "./data/ldap.json",
+		},
+		File: FileConfig{
+			Storage:    "local",
+			UploadPath: "./upload",
+			S3: S3Config{
+				Region:  "us-east-1",
+				Timeout: 30,
+			},
+			MaxSize:           100 << 20,  // 100MB
+			UploadSessionTTL:  86400,      // 24小时
+			TrashRetention:    30 * 86400, // 30天
+			MaxVersions:       10,
+			VersionRetention:  30 * 86400, // 30天
+			ExtractMaxSize:    1 << 30,    // 1GB
+			ExtractMaxEntries: 10000,
+		},
+		Share: ShareConfig{
+			DataFile: "./data/shares.json",
+		},
+		Access: AccessConfig{
+			GuestMode: "open",
+			DataFile:  "./data/access.json",
+		},
+		ACL: ACLConfig{
+			DataFile:           "./data/acl.json",
+			GroupFile:          "./data/groups.json",
+			DefaultPermissions: []string{"read", "write", "delete", "share"},
+		},
+		System: SystemConfig{
+			DataFile: "./system/system_history.json",
+			Interval: 60, // 1分钟
+		},
+	}
+}
+
+// GetConfig 获取配置
+func GetConfig() *Config {
+	return config
+}
+
+// 从文件加载配置
+func loadConfigFromFile() {
+	file, err := os.ReadFile(configFile)
+	if err != nil {
+		// 如果文件不存在，使用默认配置
+		return
+	}
+
+	err = json.Unmarshal(file, config)
+	if err != nil {
+		// 如果解析失败，使用默认配置
+		return
+	}
+}
+
+// 保存配置到文件，配置中包含密码哈希和密钥，只允许所有者读写
+func SaveConfig() error {
+	if !fileBacked {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(data)
+}
+
+// SetAdminPasswordHash 用哈希替换内存中的初始管理员密码，配置文件中写有admin_password时一并替换
+// 只修改这一个字段，不会把其他默认配置写入配置文件
+func SetAdminPasswordHash(hash string) error {
+	config.User.AdminPassword = hash
+	if !fileBacked {
+		return nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	var user map[string]json.RawMessage
+	if err := json.Unmarshal(root["user"], &user); err != nil || user["admin_password"] == nil {
+		return nil
+	}
+
+	if user["admin_password"], err = json.Marshal(hash); err != nil {
+		return err
+	}
+	if root["user"], err = json.Marshal(user); err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(root, "", "  "); err != nil {
+		return err
+	}
+	return writeConfigFile(data)
+}
+
+// writeConfigFile 写入配置文件，已存在的文件也收紧为只允许所有者读写
+func writeConfigFile(data []byte) error {
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(configFile, 0600)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAccessRules 获取游客访问模式和目录规则
+func GetAccessRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"guest_mode": models.GuestMode(),
+			"rules":      models.ListAccessRules(),
+		},
+	})
+}
+
+// SetAccessRule 设置目录对游客公开或私有
+func SetAccessRule(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path   string `json:"path"`
+		Public *bool  `json:"public"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Public == nil {
+		logger.LogError(ip, userAgent, username, "设置访问规则失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	info, err := utils.StatEntry(req.Path)
+	if err == nil && !info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "只能为目录设置访问规则",
+		})
+		return
+	}
+	if err != nil {
+		status, message := fileErrorStatus(err, "设置访问规则失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	rule, err := models.SetAccessRule(req.Path, *req.Public, username)
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "设置访问规则失败", fmt.Sprintf("保存访问规则失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "设置访问规则失败",
+		})
+		return
+	}
+
+	visibility := "私有"
+	if rule.Public {
+		visibility = "公开"
+	}
+	logger.LogUserOperation(ip, userAgent, username, "设置访问规则", fmt.Sprintf("目录 /%s 设为%s", rule.Path, visibility))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "设置成功",
+		"data":    rule,
+	})
+}
+
+// DeleteAccessRule 删除目录规则，目录恢复继承上级目录的设置
+func DeleteAccessRule(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	path := c.Query("path")
+
+	if err := models.DeleteAccessRule(path); err != nil {
+		status, message := http.StatusInternalServerError, "删除访问规则失败"
+		if err == models.ErrAccessRuleNotFound {
+			status, message = http.StatusNotFound, "该目录没有单独的访问规则"
+		}
+		logger.LogError(ip, userAgent, username, "删除访问规则失败", fmt.Sprintf("删除 /%s 的访问规则失败: %v", path, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "删除访问规则", fmt.Sprintf("目录 /%s 恢复继承上级设置", path))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已恢复继承上级目录的设置",
+	})
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hasPermission 当前用户对路径是否有指定权限，路径经过符号链接时链接位置和真实位置都需要有权限
+// 未登录的请求（游客、分享链接）不受ACL限制，由游客访问控制和分享校验负责
+func hasPermission(c *gin.Context, perm, path string) bool {
+	user, ok := middleware.CurrentUser(c)
+	return !ok || allPermissionPaths(path, func(p string) bool {
+		return models.HasPermission(user, p, perm)
+	})
+}
+
+// hasTreePermission 当前用户对路径及其下所有子项是否都有指定权限
+func hasTreePermission(c *gin.Context, perm, path string) bool {
+	user, ok := middleware.CurrentUser(c)
+	return !ok || allPermissionPaths(path, func(p string) bool {
+		return models.HasTreePermission(user, p, perm)
+	})
+}
+
+// allPermissionPaths 路径本身和解析符号链接后的真实路径是否都通过检查
+func allPermissionPaths(path string, allowed func(path string) bool) bool {
+	for _, p := range utils.PermissionPaths(path) {
+		if !allowed(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPermission 检查当前用户对路径的权限，没有权限时写入403响应
+func checkPermission(c *gin.Context, perm, path string) bool {
+	if hasPermission(c, perm, path) {
+		return true
+	}
+	denyPermission(c, perm, path)
+	return false
+}
+
+// checkTreePermission 检查当前用户对路径及其下所有子项的权限，没有权限时写入403响应
+func checkTreePermission(c *gin.Context, perm, path string) bool {
+	if hasTreePermission(c, perm, path) {
+		return true
+	}
+	denyPermission(c, perm, path)
+	return false
+}
+
+// denyPermission 记录日志并返回403响应
+func denyPermission(c *gin.Context, perm, path string) {
+	logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "权限不足", fmt.Sprintf("没有 /%s 的 %s 权限", path, perm))
+	c.JSON(http.StatusForbidden, gin.H{
+		"code":    403,
+		"message": "没有权限执行此操作",
+	})
+}
+
+// aclErrorStatus 将用户组和权限错误转换为状态码和提示信息
+func aclErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrGroupNotFound):
+		return http.StatusNotFound, "用户组不存在"
+	case errors.Is(err, models.ErrGroupExists):
+		return http.StatusConflict, "用户组已存在"
+	case errors.Is(err, models.ErrInvalidGroupName):
+		return http.StatusBadRequest, "用户组名称不合法"
+	case errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound, "用户不存在"
+	case errors.Is(err, models.ErrInvalidSubject):
+		return http.StatusBadRequest, "授权对象不合法，应为user:用户名、group:组名或*"
+	case errors.Is(err, models.ErrInvalidPermission):
+		return http.StatusBadRequest, "权限不合法，可选值为read、write、delete、share"
+	case errors.Is(err, models.ErrACLEntryNotFound):
+		return http.StatusNotFound, "权限条目不存在"
+	default:
+		return http.StatusInternalServerError, fallback
+	}
+}
+
+// ListGroups 列出所有用户组
+func ListGroups(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": models.ListGroups(),
+	})
+}
+
+// CreateGroup 创建用户组
+func CreateGroup(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Name    string   `json:"name"`
+		Members []string `json:"members"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "创建用户组失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	group, err := models.CreateGroup(req.Name, req.Members)
+	if err != nil {
+		status, message := aclErrorStatus(err, "创建用户组失败")
+		logger.LogError(ip, userAgent, username, "创建用户组失败", fmt.Sprintf("创建用户组 %s 失败: %v", req.Name, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "创建用户组", fmt.Sprintf("创建用户组 %s，成员 %v", group.Name, group.Members))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户组创建成功",
+		"data":    group,
+	})
+}
+
+// UpdateGroupMembers 替换用户组成员
+func UpdateGroupMembers(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	name := c.Param("name")
+
+	var req struct {
+		Members []string `json:"members"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "更新用户组失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	group, err := models.SetGroupMembers(name, req.Members)
+	if err != nil {
+		status, message := aclErrorStatus(err, "更新用户组失败")
+		logger.LogError(ip, userAgent, username, "更新用户组失败", fmt.Sprintf("更新用户组 %s 失败: %v", name, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "更新用户组", fmt.Sprintf("用户组 %s 成员更新为 %v", group.Name, group.Members))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户组更新成功",
+		"data":    group,
+	})
+}
+
+// DeleteGroup 删除用户组，同时删除授予该组的权限条目
+func DeleteGroup(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	name := c.Param("name")
+
+	if err := models.DeleteGroup(name); err != nil {
+		status, message := aclErrorStatus(err, "删除用户组失败")
+		logger.LogError(ip, userAgent, username, "删除用户组失败", fmt.Sprintf("删除用户组 %s 失败: %v", name, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	if err := models.RemoveACLSubject(models.GroupSubject(name)); err != nil {
+		logger.LogError(ip, userAgent, username, "删除权限条目失败", fmt.Sprintf("删除用户组 %s 的权限条目失败: %v", name, err))
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "删除用户组", fmt.Sprintf("删除用户组 %s", name))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户组删除成功",
+	})
+}
+
+// ListACL 列出所有目录权限条目
+func ListACL(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"default_permissions": models.DefaultPermissions(),
+			"entries":             models.ListACLEntries(),
+		},
+	})
+}
+
+// GetEffectivePermissions 查询用户对路径的有效权限
+func GetEffectivePermissions(c *gin.Context) {
+	user, err := models.GetUser(c.Query("username"))
+	if err != nil {
+		status, message := aclErrorStatus(err, "查询权限失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"username":    user.Username,
+			"path":        c.Query("path"),
+			"groups":      models.UserGroups(user.Username),
+			"permissions": models.UserPermissions(user, c.Query("path")),
+		},
+	})
+}
+
+// SetACLEntry 设置目录上某个用户或用户组的权限
+func SetACLEntry(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path        string   `json:"path"`
+		Subject     string   `json:"subject"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "设置目录权限失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	entry, err := models.SetACLEntry(req.Path, req.Subject, req.Permissions, username)
+	if err != nil {
+		status, message := aclErrorStatus(err, "设置目录权限失败")
+		logger.LogError(ip, userAgent, username, "设置目录权限失败", fmt.Sprintf("设置 /%s 上 %s 的权限失败: %v", req.Path, req.Subject, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "设置目录权限", fmt.Sprintf("/%s 上 %s 的权限设为 %v", entry.Path, entry.Subject, entry.Permissions))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "设置成功",
+		"data":    entry,
+	})
+}
+
+// DeleteACLEntry 删除权限条目，恢复继承上级目录的权限
+func DeleteACLEntry(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	path := c.Query("path")
+	subject := c.Query("subject")
+
+	if err := models.DeleteACLEntry(path, subject); err != nil {
+		status, message := aclErrorStatus(err, "删除目录权限失败")
+		logger.LogError(ip, userAgent, username, "删除目录权限失败", fmt.Sprintf("删除 /%s 上 %s 的权限失败: %v", path, subject, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "删除目录权限", fmt.Sprintf("/%s 上 %s 恢复继承上级目录的权限", path, subject))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已恢复继承上级目录的权限",
+	})
+}
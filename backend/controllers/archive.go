@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadArchive 将目录或多个文件打包下载
+// GET请求通过重复的path查询参数指定路径，POST请求使用JSON请求体
+func DownloadArchive(c *gin.Context) {
+	var req struct {
+		Paths  []string `json:"paths"`
+		Format string   `json:"format"`
+	}
+
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "打包下载失败", fmt.Sprintf("请求参数错误: %v", err))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+			})
+			return
+		}
+		// GET请求的路径已由游客访问控制中间件检查，POST请求体中的路径在这里检查
+		if middleware.IsGuest(c) {
+			for _, p := range req.Paths {
+				if !allPermissionPaths(p, models.GuestCanReadTree) {
+					middleware.AbortGuestDenied(c)
+					return
+				}
+			}
+		}
+	} else {
+		req.Paths = c.QueryArray("path")
+		req.Format = c.Query("format")
+	}
+
+	streamArchive(c, req.Paths, req.Format)
+}
+
+// streamArchive 校验路径后以附件形式流式返回压缩包
+func streamArchive(c *gin.Context, paths []string, format string) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	format, err := utils.ParseArchiveFormat(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "不支持的打包格式，可选值为zip、tar.gz",
+		})
+		return
+	}
+
+	for _, p := range paths {
+		if !checkTreePermission(c, models.PermRead, p) {
+			return
+		}
+	}
+
+	plan, err := utils.PlanArchive(paths)
+	if err != nil {
+		status, message := fileErrorStatus(err, "打包下载失败")
+		logger.LogError(ip, userAgent, username, "打包下载失败", fmt.Sprintf("打包 %v 失败: %v", paths, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	contentType := "application/zip"
+	if format == utils.ArchiveTarGz {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	setAttachmentHeader(c, plan.Name+utils.ArchiveExtension(format))
+	c.Status(http.StatusOK)
+
+	logger.LogFileOperation(ip, userAgent, username, "打包下载", strings.Join(paths, ", "), plan.TotalSize)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+
+	// 响应头已经发出，出错时只能记录日志，客户端会得到无法解压的不完整压缩包
+	if err := utils.WriteArchive(c.Writer, format, plan); err != nil {
+		logger.LogError(ip, userAgent, username, "打包下载失败", fmt.Sprintf("写入压缩包失败: %v", err))
+	}
+}
+
+// ListArchive 浏览压缩包内容，dir参数指定压缩包内的目录
+func ListArchive(c *gin.Context) {
+	archivePath := c.Query("path")
+	if !checkPermission(c, models.PermRead, archivePath) {
+		return
+	}
+
+	files, err := utils.ListArchive(archivePath, c.Query("dir"))
+	if err != nil {
+		status, message := fileErrorStatus(err, "读取压缩包失败")
+		logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "读取压缩包失败", fmt.Sprintf("读取压缩包 %s 失败: %v", archivePath, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": files,
+	})
+}
+
+// ExtractArchive 在服务器上解压压缩包，未指定目标目录时解压到压缩包所在目录下的同名文件夹
+func ExtractArchive(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path     string  `json:"path"`
+		Target   *string `json:"target"`
+		Conflict string  `json:"conflict"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "解压文件失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	policy, err := utils.ParseConflictPolicy(req.Conflict, utils.ConflictFail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "冲突策略不合法",
+		})
+		return
+	}
+
+	target := path.Join(path.Dir(filepath.ToSlash(req.Path)), utils.ArchiveBaseName(path.Base(filepath.ToSlash(req.Path))))
+	if req.Target != nil {
+		target = *req.Target
+	}
+
+	if !checkPermission(c, models.PermRead, req.Path) || !checkPermission(c, models.PermWrite, target) {
+		return
+	}
+
+	result, err := utils.ExtractArchive(req.Path, target, policy, func(p string) bool {
+		return hasPermission(c, models.PermWrite, p)
+	})
+	if err != nil {
+		status, message := fileErrorStatus(err, "解压文件失败")
+		logger.LogError(ip, userAgent, username, "解压文件失败", fmt.Sprintf("解压 %s 到 %s 失败: %v", req.Path, target, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "解压文件", fmt.Sprintf("%s -> %s", req.Path, result.Target), result.Size)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "解压成功",
+		"data":    result,
+	})
+}
@@ -1,600 +1,1041 @@
-package controllers
-
-import (
-	"fmt"
-	"gin_cloud_drive/backend/config"
-	"gin_cloud_drive/backend/utils"
-	"gin_cloud_drive/logger"
-	"gin_cloud_drive/system"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strconv"
-	"time"
-
-	"github.com/gin-gonic/gin"
-)
-
-// Home 首页
-func Home(c *gin.Context) {
-	c.File("./frontend/index.html")
-}
-
-// About 关于页面
-func About(c *gin.Context) {
-	c.File("./frontend/about.html")
-}
-
-// SystemStatus 系统状态页面
-func SystemStatus(c *gin.Context) {
-	c.File("./frontend/system.html")
-}
-
-// Login 登录
-func Login(c *gin.Context) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.LogError(ip, userAgent, "登录失败", fmt.Sprintf("请求参数错误: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	cfg := config.GetConfig()
-	if req.Username == cfg.User.AdminUsername && req.Password == cfg.User.AdminPassword {
-		// 设置认证Cookie
-		c.SetCookie("auth_token", "admin_auth_token", 3600, "/", "", false, false)
-		logger.LogUserOperation(ip, userAgent, "登录成功", fmt.Sprintf("用户 %s 登录成功", req.Username))
-		c.JSON(http.StatusOK, gin.H{
-			"code":    200,
-			"message": "登录成功",
-		})
-	} else {
-		logger.LogError(ip, userAgent, "登录失败", fmt.Sprintf("用户名或密码错误，尝试用户名: %s", req.Username))
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"code":    401,
-			"message": "用户名或密码错误",
-		})
-	}
-}
-
-// Logout 退出登录
-func Logout(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	// 删除认证Cookie
-	c.SetCookie("auth_token", "", -1, "/", "", false, false)
-	logger.LogUserOperation(ip, userAgent, "退出登录", "用户退出登录成功")
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "退出成功",
-	})
-}
-
-// GetSystemInfo 获取系统信息
-func GetSystemInfo(c *gin.Context) {
-	info := system.GetSystemInfo()
-	c.JSON(http.StatusOK, info)
-}
-
-// GetSystemHistory 获取系统历史数据
-func GetSystemHistory(c *gin.Context) {
-	hours := 1
-	if h := c.Query("hours"); h != "" {
-		if _, err := fmt.Sscanf(h, "%d", &hours); err != nil {
-			hours = 1
-		}
-	}
-
-	// 限制时间范围
-	if hours < 1 {
-		hours = 1
-	}
-	if hours > 168 { // 7天
-		hours = 168
-	}
-
-	data := system.GetHistoryData(hours)
-	c.JSON(http.StatusOK, gin.H{
-		"data":  data,
-		"hours": hours,
-	})
-}
-
-// ListFiles 列出文件
-func ListFiles(c *gin.Context) {
-	path := c.Query("path")
-	sortBy := c.DefaultQuery("sort_by", "name")
-	sortOrder := c.DefaultQuery("sort_order", "asc")
-	files, err := utils.ListFiles(path, sortBy, sortOrder)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "获取文件列表失败",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": files,
-	})
-}
-
-// UploadFile 上传文件
-func UploadFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	// 获取上传的文件
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		logger.LogError(ip, userAgent, "上传文件失败", fmt.Sprintf("获取上传文件失败: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "获取上传文件失败",
-		})
-		return
-	}
-	defer file.Close()
-
-	// 获取上传路径
-	path := c.PostForm("path")
-	uploadPath := config.GetConfig().File.UploadPath
-	fullPath := filepath.Join(uploadPath, path, header.Filename)
-	relativePath := filepath.Join(path, header.Filename)
-
-	// 创建目标目录
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		logger.LogError(ip, userAgent, "上传文件失败", fmt.Sprintf("创建目录失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "创建目录失败",
-		})
-		return
-	}
-
-	// 创建目标文件
-	dst, err := os.Create(fullPath)
-	if err != nil {
-		logger.LogError(ip, userAgent, "上传文件失败", fmt.Sprintf("创建文件失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "创建文件失败",
-		})
-		return
-	}
-	defer dst.Close()
-
-	// 复制文件内容
-	size, err := io.Copy(dst, file)
-	if err != nil {
-		logger.LogError(ip, userAgent, "上传文件失败", fmt.Sprintf("保存文件失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "保存文件失败",
-		})
-		return
-	}
-
-	logger.LogFileOperation(ip, userAgent, "上传文件", relativePath, size)
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "文件上传成功",
-	})
-}
-
-// DownloadFile 下载文件
-func DownloadFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	// 使用通配符参数，需要去掉前导斜杠
-	filename := c.Param("filename")
-	if filename != "" && filename[0] == '/' {
-		filename = filename[1:]
-	}
-	// 将URL中的正斜杠转换为系统路径分隔符
-	filename = filepath.FromSlash(filename)
-	uploadPath := config.GetConfig().File.UploadPath
-
-	// 获取文件大小
-	fileInfo, err := os.Stat(filepath.Join(uploadPath, filename))
-	var fileSize int64 = 0
-	if err == nil {
-		fileSize = fileInfo.Size()
-	}
-
-	logger.LogFileOperation(ip, userAgent, "下载文件", filename, fileSize)
-	c.FileAttachment(filepath.Join(uploadPath, filename), filepath.Base(filename))
-}
-
-// PreviewFile 预览文件
-func PreviewFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	// 使用通配符参数，需要去掉前导斜杠
-	filename := c.Param("filename")
-	if filename != "" && filename[0] == '/' {
-		filename = filename[1:]
-	}
-	// 将URL中的正斜杠转换为系统路径分隔符
-	filename = filepath.FromSlash(filename)
-	uploadPath := config.GetConfig().File.UploadPath
-
-	logger.LogFileOperation(ip, userAgent, "预览文件", filename, 0)
-	c.File(filepath.Join(uploadPath, filename))
-}
-
-// RenameFile 重命名文件
-func RenameFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	var req struct {
-		OldPath string `json:"old_path"`
-		NewName string `json:"new_name"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.LogError(ip, userAgent, "重命名文件失败", fmt.Sprintf("请求参数错误: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	if err := utils.RenameFile(req.OldPath, req.NewName); err != nil {
-		logger.LogError(ip, userAgent, "重命名文件失败", fmt.Sprintf("重命名文件失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "重命名文件失败",
-		})
-		return
-	}
-
-	logger.LogFileOperation(ip, userAgent, "重命名文件", fmt.Sprintf("%s -> %s", req.OldPath, req.NewName), 0)
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "文件重命名成功",
-	})
-}
-
-// MoveFile 移动文件
-func MoveFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	var req struct {
-		OldPath string `json:"old_path"`
-		NewPath string `json:"new_path"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.LogError(ip, userAgent, "移动文件失败", fmt.Sprintf("请求参数错误: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	if err := utils.MoveFile(req.OldPath, req.NewPath); err != nil {
-		logger.LogError(ip, userAgent, "移动文件失败", fmt.Sprintf("移动文件失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": fmt.Sprintf("移动文件失败: %v", err),
-		})
-		return
-	}
-
-	logger.LogFileOperation(ip, userAgent, "移动文件", fmt.Sprintf("%s -> %s", req.OldPath, req.NewPath), 0)
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "文件移动成功",
-	})
-}
-
-// DeleteFile 删除文件
-func DeleteFile(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	// 使用通配符参数，需要去掉前导斜杠
-	filename := c.Param("filename")
-	if filename != "" && filename[0] == '/' {
-		filename = filename[1:]
-	}
-	// 将URL中的正斜杠转换为系统路径分隔符
-	filename = filepath.FromSlash(filename)
-
-	if err := utils.DeleteFile(filename); err != nil {
-		logger.LogError(ip, userAgent, "删除文件失败", fmt.Sprintf("删除文件失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": fmt.Sprintf("删除文件失败: %v", err),
-		})
-		return
-	}
-
-	logger.LogFileOperation(ip, userAgent, "删除文件", filename, 0)
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "文件删除成功",
-	})
-}
-
-// CreateDirectory 创建目录
-func CreateDirectory(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	var req struct {
-		Path string `json:"path"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.LogError(ip, userAgent, "创建目录失败", fmt.Sprintf("请求参数错误: %v", err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	if err := utils.CreateDirectory(req.Path); err != nil {
-		logger.LogError(ip, userAgent, "创建目录失败", fmt.Sprintf("创建目录失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "创建目录失败",
-		})
-		return
-	}
-
-	logger.LogFileOperation(ip, userAgent, "创建目录", req.Path, 0)
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "目录创建成功",
-	})
-}
-
-// GetCarouselImages 获取轮播图图片
-func GetCarouselImages(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-
-	images, err := utils.ListFiles("carousel", "name", "asc")
-	if err != nil {
-		logger.LogError(ip, userAgent, "获取轮播图失败", fmt.Sprintf("获取轮播图失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "获取轮播图失败",
-		})
-		return
-	}
-
-	logger.LogAccess(ip, userAgent, "获取轮播图", fmt.Sprintf("获取到 %d 张轮播图", len(images)))
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": images,
-	})
-}
-
-// GetUserInfo 获取用户信息
-func GetUserInfo(c *gin.Context) {
-	cfg := config.GetConfig()
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": gin.H{
-			"username": cfg.User.AdminUsername,
-			"role":     "admin",
-			"status":   "online",
-		},
-	})
-}
-
-// UpdateUserInfo 更新用户信息
-func UpdateUserInfo(c *gin.Context) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	// 这里可以添加更新用户信息的逻辑
-	// 目前我们只支持单管理员，所以暂时不允许修改用户名
-	if req.Username != "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "用户名不允许修改",
-		})
-		return
-	}
-
-	// 如果提供了新密码，则更新密码
-	if req.Password != "" {
-		// 这里可以添加更新密码的逻辑
-		// 目前我们只是返回成功，实际项目中应该更新配置文件或数据库
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "用户信息更新成功",
-	})
-}
-
-// GetSettings 获取系统设置
-func GetSettings(c *gin.Context) {
-	cfg := config.GetConfig()
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": gin.H{
-			"server": gin.H{
-				"port": cfg.Server.Port,
-			},
-			"file": gin.H{
-				"max_size": cfg.File.MaxSize,
-			},
-			"system": gin.H{
-				"interval": cfg.System.Interval,
-			},
-		},
-	})
-}
-
-// UpdateSettings 更新系统设置
-func UpdateSettings(c *gin.Context) {
-	var req struct {
-		Server struct {
-			Port string `json:"port"`
-		} `json:"server"`
-		File struct {
-			MaxSize int64 `json:"max_size"`
-		} `json:"file"`
-		System struct {
-			Interval int `json:"interval"`
-		} `json:"system"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-		})
-		return
-	}
-
-	// 这里可以添加更新系统设置的逻辑
-	// 目前我们只是返回成功，实际项目中应该更新配置文件或数据库
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": "系统设置更新成功",
-	})
-}
-
-// GetLogs 查询日志列表
-func GetLogs(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-	logger.LogAccess(ip, userAgent, "查询日志", "用户查询日志列表")
-
-	// 解析查询参数
-	var params logger.LogQueryParams
-
-	// 解析页码和每页大小
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	params.Page = page
-	params.PageSize = pageSize
-
-	// 解析时间范围
-	startDateStr := c.Query("start_date")
-	endDateStr := c.Query("end_date")
-	if startDateStr != "" {
-		if startDate, err := time.Parse("2006-01-02T15:04:05", startDateStr); err == nil {
-			params.StartDate = startDate
-		}
-	}
-	if endDateStr != "" {
-		if endDate, err := time.Parse("2006-01-02T15:04:05", endDateStr); err == nil {
-			params.EndDate = endDate
-		}
-	}
-
-	// 解析其他查询条件
-	params.Level = c.Query("level")
-	params.Type = c.Query("type")
-	params.IP = c.Query("ip")
-	params.Action = c.Query("action")
-	params.File = c.Query("file")
-
-	// 查询日志
-	result, err := logger.QueryLogs(params)
-	if err != nil {
-		logger.LogError(ip, userAgent, "查询日志失败", fmt.Sprintf("查询日志失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": fmt.Sprintf("查询日志失败: %v", err),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": result,
-	})
-}
-
-// GetLogStats 获取日志统计信息
-func GetLogStats(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-	logger.LogAccess(ip, userAgent, "获取日志统计", "用户获取日志统计信息")
-
-	// 获取日志统计信息
-	stats, err := logger.GetLogStats()
-	if err != nil {
-		logger.LogError(ip, userAgent, "获取日志统计失败", fmt.Sprintf("获取日志统计失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": fmt.Sprintf("获取日志统计失败: %v", err),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"data": stats,
-	})
-}
-
-// ClearOldLogs 清理旧日志
-func ClearOldLogs(c *gin.Context) {
-	ip := c.ClientIP()
-	userAgent := c.Request.UserAgent()
-	logger.LogAccess(ip, userAgent, "清理旧日志", "用户清理旧日志")
-
-	// 解析清理天数
-	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
-
-	// 清理旧日志
-	deletedCount, err := logger.ClearOldLogs(days)
-	if err != nil {
-		logger.LogError(ip, userAgent, "清理旧日志失败", fmt.Sprintf("清理旧日志失败: %v", err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": fmt.Sprintf("清理旧日志失败: %v", err),
-		})
-		return
-	}
-
-	logger.LogSystemOperation(ip, userAgent, "清理旧日志", fmt.Sprintf("成功清理了 %d 个旧日志文件", deletedCount))
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": fmt.Sprintf("成功清理了 %d 个旧日志文件", deletedCount),
-		"data": gin.H{
-			"deleted_count": deletedCount,
-		},
-	})
-}
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"gin_cloud_drive/system"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Home 首页
+func Home(c *gin.Context) {
+	c.File("./frontend/index.html")
+}
+
+// About 关于页面
+func About(c *gin.Context) {
+	c.File("./frontend/about.html")
+}
+
+// SystemStatus 系统状态页面
+func SystemStatus(c *gin.Context) {
+	c.File("./frontend/system.html")
+}
+
+// Login 登录
+func Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, "", "登录失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 处于退避或锁定期时不校验密码
+	if block := models.CheckLoginAllowed(ip, req.Username); block != nil {
+		rejectBlockedLogin(c, req.Username, block)
+		return
+	}
+
+	user, source, err := models.AuthenticateUser(req.Username, req.Password)
+	if errors.Is(err, models.ErrAuthUnavailable) {
+		// 认证服务故障不计入失败次数
+		logger.LogError(ip, userAgent, req.Username, "登录失败", fmt.Sprintf("认证服务不可用，尝试用户名: %s: %v", req.Username, err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "认证服务暂时不可用，请稍后重试",
+		})
+		return
+	}
+	if errors.Is(err, models.ErrExternalUserConflict) || errors.Is(err, models.ErrExternalNotProvisioned) {
+		logger.LogError(ip, userAgent, req.Username, "登录失败", fmt.Sprintf("关联LDAP用户失败，尝试用户名: %s: %v", req.Username, err))
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": oidcErrorMessage(err),
+		})
+		return
+	}
+	if err == models.ErrUserDisabled {
+		logger.LogError(ip, userAgent, req.Username, "登录失败", fmt.Sprintf("账号已被禁用，尝试用户名: %s", req.Username))
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "账号已被禁用",
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(ip, userAgent, "", "登录失败", fmt.Sprintf("用户名或密码错误，尝试用户名: %s: %v", req.Username, err))
+		recordLoginFailure(c, req.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "用户名或密码错误",
+		})
+		return
+	}
+
+	// 启用了两步验证时先不创建会话，客户端需再提交验证码
+	if models.TwoFactorEnabled(user.Username) {
+		challenge, err := models.CreateLoginChallenge(user.Username)
+		if err != nil {
+			logger.LogError(ip, userAgent, user.Username, "登录失败", fmt.Sprintf("创建两步验证挑战失败: %v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "登录失败",
+			})
+			return
+		}
+		logger.LogAccess(ip, userAgent, user.Username, "等待两步验证", fmt.Sprintf("用户 %s 密码校验通过，等待输入验证码", user.Username))
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    202,
+			"message": "请输入两步验证码",
+			"data": gin.H{
+				"two_factor_required": true,
+				"challenge":           challenge,
+			},
+		})
+		return
+	}
+
+	details := fmt.Sprintf("用户 %s 登录成功", user.Username)
+	if source == models.AuthenticatorLDAP {
+		details = fmt.Sprintf("用户 %s 通过LDAP登录成功（登录名 %s，角色 %s）", user.Username, req.Username, user.Role)
+	}
+	startSession(c, user.Username, details)
+}
+
+// startSession 登录校验全部通过后创建会话并设置认证Cookie
+func startSession(c *gin.Context, username, details string) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	if err := createLoginSession(c, username); err != nil {
+		logger.LogError(ip, userAgent, username, "登录失败", fmt.Sprintf("创建会话失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "创建会话失败",
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "登录成功", details)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "登录成功",
+	})
+}
+
+// Logout 退出登录
+func Logout(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := ""
+
+	// 服务端销毁会话
+	if token, err := c.Cookie(middleware.SessionCookieName); err == nil && token != "" {
+		username = models.DeleteSession(token)
+	}
+
+	// 删除认证Cookie
+	middleware.ClearSessionCookie(c)
+	logger.LogUserOperation(ip, userAgent, username, "退出登录", "用户退出登录成功")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "退出成功",
+	})
+}
+
+// GetSystemInfo 获取系统信息
+func GetSystemInfo(c *gin.Context) {
+	info := system.GetSystemInfo()
+	c.JSON(http.StatusOK, info)
+}
+
+// GetSystemHistory 获取系统历史数据
+func GetSystemHistory(c *gin.Context) {
+	hours := 1
+	if h := c.Query("hours"); h != "" {
+		if _, err := fmt.Sscanf(h, "%d", &hours); err != nil {
+			hours = 1
+		}
+	}
+
+	// 限制时间范围
+	if hours < 1 {
+		hours = 1
+	}
+	if hours > 168 { // 7天
+		hours = 168
+	}
+
+	data := system.GetHistoryData(hours)
+	c.JSON(http.StatusOK, gin.H{
+		"data":  data,
+		"hours": hours,
+	})
+}
+
+// ListFiles 列出文件
+func ListFiles(c *gin.Context) {
+	path := c.Query("path")
+	sortBy := c.DefaultQuery("sort_by", "name")
+	sortOrder := c.DefaultQuery("sort_order", "asc")
+
+	user, loggedIn := middleware.CurrentUser(c)
+	if loggedIn && !allPermissionPaths(path, func(p string) bool { return models.CanBrowse(user, p) }) {
+		denyPermission(c, models.PermRead, path)
+		return
+	}
+
+	files, err := utils.ListFiles(path, sortBy, sortOrder)
+	if err != nil {
+		status, message := fileErrorStatus(err, "获取文件列表失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 游客只能看到公开的内容和通往公开目录的路径，登录用户只能看到有读取权限的内容
+	canBrowse := models.GuestCanBrowse
+	if loggedIn {
+		canBrowse = func(p string) bool { return models.CanBrowse(user, p) }
+	}
+	visible := files[:0]
+	for _, file := range files {
+		if allPermissionPaths(file.Path, canBrowse) {
+			visible = append(visible, file)
+		}
+	}
+	files = visible
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": files,
+	})
+}
+
+// UploadFile 上传文件
+func UploadFile(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	// 根据Content-Length提前拒绝超出限制的请求，避免接收完整的请求体
+	if c.Request.ContentLength > 0 {
+		if err := utils.CheckUploadSize(c.Request.ContentLength - multipartOverhead); err != nil {
+			rejectUpload(c, err, fmt.Sprintf("请求体大小 %d 超出限制", c.Request.ContentLength))
+			return
+		}
+	}
+
+	// 限制请求体大小，防止Content-Length缺失或不实时持续写入
+	limit, err := utils.UploadLimit()
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "上传文件失败", fmt.Sprintf("获取存储用量失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "获取存储用量失败",
+		})
+		return
+	}
+	if limit >= 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+	}
+
+	// 获取上传的文件
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			// 限制来自剩余配额时提示空间不足，否则提示文件过大
+			limitErr := utils.ErrQuotaExceeded
+			if maxSize := config.GetConfig().File.MaxSize; maxSize > 0 && limit >= maxSize {
+				limitErr = utils.ErrFileTooLarge
+			}
+			rejectUpload(c, limitErr, fmt.Sprintf("请求体超过 %d 字节", maxBytesErr.Limit))
+			return
+		}
+		logger.LogError(ip, userAgent, username, "上传文件失败", fmt.Sprintf("获取上传文件失败: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "获取上传文件失败",
+		})
+		return
+	}
+	defer file.Close()
+
+	// 写入期间预留配额，并发上传不会合计超出配额
+	release, err := utils.ReserveUploadSize(header.Size)
+	if err != nil {
+		rejectUpload(c, err, fmt.Sprintf("文件 %s 大小 %d 超出限制", header.Filename, header.Size))
+		return
+	}
+	defer release()
+
+	// 同名文件的处理策略，默认覆盖以兼容原有行为
+	policy, err := utils.ParseConflictPolicy(c.PostForm("conflict"), utils.ConflictOverwrite)
+	if err != nil {
+		rejectUpload(c, err, fmt.Sprintf("冲突策略不合法: %s", c.PostForm("conflict")))
+		return
+	}
+
+	// 获取上传路径
+	path := c.PostForm("path")
+	relativePath := filepath.Join(path, header.Filename)
+	if _, err := resolveUploadTarget(header.Filename, relativePath); err != nil {
+		status, message := fileErrorStatus(err, "上传路径不合法")
+		logger.LogError(ip, userAgent, username, "上传文件失败", fmt.Sprintf("上传路径不合法: %s, %v", relativePath, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	if !checkPermission(c, models.PermWrite, path) {
+		return
+	}
+
+	// 先写入临时文件再移动到目标位置，上传中断不会留下不完整的文件
+	finalPath, size, err := utils.SaveUpload(relativePath, file, limit, policy)
+	if err != nil {
+		status, message := fileErrorStatus(err, "保存文件失败")
+		logger.LogError(ip, userAgent, username, "上传文件失败", fmt.Sprintf("保存文件失败: %s, %v", relativePath, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "上传文件", finalPath, size)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件上传成功",
+		"data": gin.H{
+			"path": finalPath,
+		},
+	})
+}
+
+// DownloadFile 下载文件，支持Range断点续传和条件请求，目录会被打包下载
+func DownloadFile(c *gin.Context) {
+	serveFile(c, filenameParam(c), "下载文件", true)
+}
+
+// PreviewFile 预览文件，支持Range请求以便视频拖动播放
+func PreviewFile(c *gin.Context) {
+	serveFile(c, filenameParam(c), "预览文件", false)
+}
+
+// filenameParam 获取通配符路由中的文件路径
+func filenameParam(c *gin.Context) string {
+	// 使用通配符参数，需要去掉前导斜杠
+	filename := c.Param("filename")
+	if filename != "" && filename[0] == '/' {
+		filename = filename[1:]
+	}
+	// 将URL中的正斜杠转换为系统路径分隔符
+	return filepath.FromSlash(filename)
+}
+
+// serveFile 返回文件内容，由http.ServeContent处理Range、If-Range、If-None-Match等请求头
+func serveFile(c *gin.Context, filename, action string, attachment bool) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !checkPermission(c, models.PermRead, filename) {
+		return
+	}
+
+	file, info, err := utils.OpenFile(filename)
+	if errors.Is(err, utils.ErrIsDirectory) && attachment {
+		// 下载目录时打包为ZIP
+		streamArchive(c, []string{filename}, c.Query("format"))
+		return
+	}
+	if err != nil {
+		status, message := fileErrorStatus(err, action+"失败")
+		logger.LogError(ip, userAgent, username, action+"失败", fmt.Sprintf("%s失败: %s, %v", action, filename, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	defer file.Close()
+
+	c.Header("ETag", utils.FileETag(info))
+	if attachment {
+		setAttachmentHeader(c, info.Name())
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, action, filename, info.Size())
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// RenameFile 重命名文件
+func RenameFile(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		OldPath  string `json:"old_path"`
+		NewName  string `json:"new_name"`
+		Conflict string `json:"conflict"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "重命名文件失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 重命名和移动默认不覆盖已有文件
+	policy, err := utils.ParseConflictPolicy(req.Conflict, utils.ConflictFail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "冲突策略不合法",
+		})
+		return
+	}
+
+	if !checkPermission(c, models.PermWrite, req.OldPath) {
+		return
+	}
+
+	newPath, err := utils.RenameFile(req.OldPath, req.NewName, policy)
+	if err != nil {
+		status, message := fileErrorStatus(err, "重命名文件失败")
+		logger.LogError(ip, userAgent, username, "重命名文件失败", fmt.Sprintf("重命名文件失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 目录的公开/私有设置、访问权限和分享跟随到新路径
+	if err := models.MoveAccessRules(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新访问规则失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+	if err := models.MoveACLEntries(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新目录权限失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+	if err := models.MoveShares(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新分享失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "重命名文件", fmt.Sprintf("%s -> %s", req.OldPath, newPath), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件重命名成功",
+		"data": gin.H{
+			"path": newPath,
+		},
+	})
+}
+
+// MoveFile 移动文件
+func MoveFile(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		OldPath  string `json:"old_path"`
+		NewPath  string `json:"new_path"`
+		Conflict string `json:"conflict"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "移动文件失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	policy, err := utils.ParseConflictPolicy(req.Conflict, utils.ConflictFail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "冲突策略不合法",
+		})
+		return
+	}
+
+	// 移出需要源路径及其子项的删除权限，移入需要目标目录的写入权限
+	if !checkTreePermission(c, models.PermDelete, req.OldPath) || !checkPermission(c, models.PermWrite, req.NewPath) {
+		return
+	}
+
+	newPath, err := utils.MoveFile(req.OldPath, req.NewPath, policy)
+	if err != nil {
+		status, message := fileErrorStatus(err, "移动文件失败")
+		logger.LogError(ip, userAgent, username, "移动文件失败", fmt.Sprintf("移动文件失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 目录的公开/私有设置、访问权限和分享跟随到新路径
+	if err := models.MoveAccessRules(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新访问规则失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+	if err := models.MoveACLEntries(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新目录权限失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+	if err := models.MoveShares(req.OldPath, newPath); err != nil {
+		logger.LogError(ip, userAgent, username, "更新分享失败", fmt.Sprintf("%s -> %s: %v", req.OldPath, newPath, err))
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "移动文件", fmt.Sprintf("%s -> %s", req.OldPath, newPath), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件移动成功",
+		"data": gin.H{
+			"path": newPath,
+		},
+	})
+}
+
+// DeleteFile 删除文件，文件被移入回收站
+func DeleteFile(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	// 使用通配符参数，需要去掉前导斜杠
+	filename := c.Param("filename")
+	if filename != "" && filename[0] == '/' {
+		filename = filename[1:]
+	}
+	// 将URL中的正斜杠转换为系统路径分隔符
+	filename = filepath.FromSlash(filename)
+
+	if !checkTreePermission(c, models.PermDelete, filename) {
+		return
+	}
+
+	item, err := utils.DeleteFile(filename, username)
+	if err != nil {
+		status, message := fileErrorStatus(err, fmt.Sprintf("删除文件失败: %v", err))
+		logger.LogError(ip, userAgent, username, "删除文件失败", fmt.Sprintf("删除文件失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 从回收站恢复后需要重新创建分享
+	if err := models.DeletePathShares(item.OriginalPath); err != nil {
+		logger.LogError(ip, userAgent, username, "撤销分享失败", fmt.Sprintf("%s: %v", item.OriginalPath, err))
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "删除文件", item.OriginalPath, item.Size)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件已移入回收站",
+		"data":    item,
+	})
+}
+
+// CreateDirectory 创建目录
+func CreateDirectory(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path string `json:"path"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "创建目录失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	if !checkPermission(c, models.PermWrite, req.Path) {
+		return
+	}
+
+	if err := utils.CreateDirectory(req.Path); err != nil {
+		status, message := fileErrorStatus(err, "创建目录失败")
+		logger.LogError(ip, userAgent, username, "创建目录失败", fmt.Sprintf("创建目录失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "创建目录", req.Path, 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "目录创建成功",
+	})
+}
+
+// multipartOverhead 表单上传时除文件内容外的请求体开销（分隔符、表单字段等）
+const multipartOverhead = 1 << 20
+
+// rejectUpload 因大小或配额限制拒绝上传
+func rejectUpload(c *gin.Context, err error, details string) {
+	status, message := fileErrorStatus(err, "上传文件失败")
+	logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "上传文件失败", details)
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+	})
+}
+
+// resolveUploadTarget 校验上传文件名并解析目标路径
+func resolveUploadTarget(filename, relativePath string) (string, error) {
+	if err := utils.ValidateName(filename); err != nil {
+		return "", err
+	}
+	return utils.ResolveEntryPath(relativePath)
+}
+
+// fileErrorStatus 将文件操作错误转换为状态码和提示信息，未识别的错误使用fallback提示
+func fileErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, utils.ErrPathEscape):
+		return http.StatusForbidden, "非法路径：禁止访问上传目录之外的位置"
+	case errors.Is(err, utils.ErrInvalidPath):
+		return http.StatusBadRequest, "路径不合法"
+	case errors.Is(err, utils.ErrInvalidName):
+		return http.StatusBadRequest, "文件名不合法"
+	case errors.Is(err, utils.ErrIsDirectory):
+		return http.StatusBadRequest, "不能直接下载目录"
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound, "文件或目录不存在"
+	case errors.Is(err, utils.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("文件大小超过限制（最大 %s）", formatSize(config.GetConfig().File.MaxSize))
+	case errors.Is(err, utils.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage, "存储空间不足，已超出容量配额"
+	case errors.Is(err, utils.ErrFileExists):
+		return http.StatusConflict, "目标已存在"
+	case errors.Is(err, utils.ErrExtractDenied):
+		return http.StatusForbidden, "没有权限写入压缩包中的部分路径"
+	case errors.Is(err, utils.ErrArchiveLimit):
+		return http.StatusRequestEntityTooLarge, "压缩包内容超出解压限制"
+	case errors.Is(err, utils.ErrInvalidArchiveFormat):
+		return http.StatusBadRequest, "不支持的压缩包格式，仅支持zip、tar.gz、tar"
+	case errors.Is(err, utils.ErrVersionNotFound):
+		return http.StatusNotFound, "历史版本不存在"
+	case errors.Is(err, utils.ErrTrashItemNotFound):
+		return http.StatusNotFound, "回收站中不存在该条目"
+	case errors.Is(err, utils.ErrInvalidConflict):
+		return http.StatusBadRequest, "冲突策略不合法，可选值为overwrite、rename、fail"
+	default:
+		return http.StatusInternalServerError, fallback
+	}
+}
+
+// formatSize 格式化文件大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// GetStorageUsage 获取存储用量
+func GetStorageUsage(c *gin.Context) {
+	usage, err := utils.GetStorageUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "获取存储用量失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": usage,
+	})
+}
+
+// GetCarouselImages 获取轮播图图片
+func GetCarouselImages(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	// 轮播图目录不对游客公开时，游客看不到轮播图
+	if middleware.IsGuest(c) && !models.GuestCanRead("carousel") {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"data": []utils.FileInfo{},
+		})
+		return
+	}
+
+	images, err := utils.ListFiles("carousel", "name", "asc")
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "获取轮播图失败", fmt.Sprintf("获取轮播图失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "获取轮播图失败",
+		})
+		return
+	}
+
+	logger.LogAccess(ip, userAgent, username, "获取轮播图", fmt.Sprintf("获取到 %d 张轮播图", len(images)))
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": images,
+	})
+}
+
+// GetUserInfo 获取用户信息
+func GetUserInfo(c *gin.Context) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "未授权访问",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"username":      user.Username,
+			"role":          user.Role,
+			"status":        "online",
+			"created_at":    user.CreatedAt,
+			"last_login_at": user.LastLoginAt,
+		},
+	})
+}
+
+// createLoginSession 创建会话、记录登录时间并设置认证Cookie
+func createLoginSession(c *gin.Context, username string) error {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	token, session, err := models.CreateSession(username, ip, userAgent)
+	if err != nil {
+		return err
+	}
+	if err := models.RecordLogin(username); err != nil {
+		logger.LogError(ip, userAgent, username, "记录登录时间失败", err.Error())
+	}
+	models.RecordLoginSuccess(username)
+
+	// 设置认证Cookie
+	middleware.SetSessionCookie(c, token, session.ExpiresAt)
+	return nil
+}
+
+// UpdateUserInfo 更新用户信息，目前只支持修改密码，需同时提供当前密码
+func UpdateUserInfo(c *gin.Context) {
+	var req struct {
+		Username        string `json:"username"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 用户名是目录权限、分享等数据的关联键，不允许修改
+	if req.Username != "" && req.Username != c.GetString("username") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "用户名不允许修改",
+		})
+		return
+	}
+
+	if req.Password == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "用户信息更新成功",
+		})
+		return
+	}
+
+	changePassword(c, req.CurrentPassword, req.Password)
+}
+
+// ChangePassword 修改当前用户的密码
+func ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	changePassword(c, req.CurrentPassword, req.NewPassword)
+}
+
+// changePassword 校验当前密码后修改密码，并使该用户的其他会话失效
+// 当前密码错误计入登录失败次数，防止借已登录的会话穷举密码
+func changePassword(c *gin.Context, currentPassword, newPassword string) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+	if models.IsLDAPUser(username) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "LDAP用户的密码由目录服务管理，请在LDAP中修改",
+		})
+		return
+	}
+
+	if block := models.CheckLoginAllowed(ip, username); block != nil {
+		rejectBlockedLogin(c, username, block)
+		return
+	}
+	if _, err := models.Authenticate(username, currentPassword); err != nil {
+		logger.LogError(ip, userAgent, username, "修改密码失败", "当前密码错误")
+		recordLoginFailure(c, username)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "当前密码错误",
+		})
+		return
+	}
+
+	if err := models.SetPassword(username, newPassword); err != nil {
+		status, message := userErrorMessage(err)
+		logger.LogError(ip, userAgent, username, "修改密码失败", fmt.Sprintf("修改密码失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	token, _ := c.Cookie(middleware.SessionCookieName)
+	count := models.DeleteOtherUserSessions(username, token)
+	logger.LogUserOperation(ip, userAgent, username, "修改密码", fmt.Sprintf("用户 %s 修改了密码，%d 个其他会话已失效", username, count))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "密码修改成功，其他设备上的登录已失效",
+	})
+}
+
+// GetSettings 获取系统设置
+func GetSettings(c *gin.Context) {
+	cfg := config.GetConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"server": gin.H{
+				"port": cfg.Server.Port,
+			},
+			"file": gin.H{
+				"max_size": cfg.File.MaxSize,
+				"quota":    cfg.File.Quota,
+			},
+			"system": gin.H{
+				"interval": cfg.System.Interval,
+			},
+		},
+	})
+}
+
+// UpdateSettings 更新系统设置
+func UpdateSettings(c *gin.Context) {
+	var req struct {
+		Server struct {
+			Port string `json:"port"`
+		} `json:"server"`
+		File struct {
+			MaxSize int64 `json:"max_size"`
+		} `json:"file"`
+		System struct {
+			Interval int `json:"interval"`
+		} `json:"system"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 这里可以添加更新系统设置的逻辑
+	// 目前我们只是返回成功，实际项目中应该更新配置文件或数据库
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "系统设置更新成功",
+	})
+}
+
+// GetLogs 查询日志列表
+func GetLogs(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	logger.LogAccess(ip, userAgent, username, "查询日志", "用户查询日志列表")
+
+	// 解析查询参数
+	var params logger.LogQueryParams
+
+	// 解析页码和每页大小
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	params.Page = page
+	params.PageSize = pageSize
+
+	// 解析时间范围
+	startDateStr := c.Query("start_date")
+	endDateStr := c.Query("end_date")
+	if startDateStr != "" {
+		if startDate, err := time.Parse("2006-01-02T15:04:05", startDateStr); err == nil {
+			params.StartDate = startDate
+		}
+	}
+	if endDateStr != "" {
+		if endDate, err := time.Parse("2006-01-02T15:04:05", endDateStr); err == nil {
+			params.EndDate = endDate
+		}
+	}
+
+	// 解析其他查询条件
+	params.Level = c.Query("level")
+	params.Type = c.Query("type")
+	params.IP = c.Query("ip")
+	params.User = c.Query("user")
+	params.Action = c.Query("action")
+	params.File = c.Query("file")
+
+	// 查询日志
+	result, err := logger.QueryLogs(params)
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "查询日志失败", fmt.Sprintf("查询日志失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": fmt.Sprintf("查询日志失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+// GetLogStats 获取日志统计信息
+func GetLogStats(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	logger.LogAccess(ip, userAgent, username, "获取日志统计", "用户获取日志统计信息")
+
+	// 获取日志统计信息
+	stats, err := logger.GetLogStats()
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "获取日志统计失败", fmt.Sprintf("获取日志统计失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": fmt.Sprintf("获取日志统计失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": stats,
+	})
+}
+
+// ClearOldLogs 清理旧日志
+func ClearOldLogs(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	logger.LogAccess(ip, userAgent, username, "清理旧日志", "用户清理旧日志")
+
+	// 解析清理天数
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+
+	// 清理旧日志
+	deletedCount, err := logger.ClearOldLogs(days)
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "清理旧日志失败", fmt.Sprintf("清理旧日志失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": fmt.Sprintf("清理旧日志失败: %v", err),
+		})
+		return
+	}
+
+	logger.LogSystemOperation(ip, userAgent, username, "清理旧日志", fmt.Sprintf("成功清理了 %d 个旧日志文件", deletedCount))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": fmt.Sprintf("成功清理了 %d 个旧日志文件", deletedCount),
+		"data": gin.H{
+			"deleted_count": deletedCount,
+		},
+	})
+}
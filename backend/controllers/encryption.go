@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotateEncryptionKeys 让所有文件改用当前主密钥，更换主密钥并重启服务后调用
+func RotateEncryptionKeys(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	result, err := utils.RotateEncryptionKeys()
+	if errors.Is(err, utils.ErrEncryptionDisabled) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "未开启静态加密",
+		})
+		return
+	}
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "轮换加密密钥失败", fmt.Sprintf("轮换加密密钥失败（已处理 %d 个文件）: %v", result.Files, err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "轮换加密密钥失败",
+			"data":    result,
+		})
+		return
+	}
+
+	details := fmt.Sprintf("检查 %d 个文件，重新加密 %d 个，失败 %d 个", result.Files, result.Rewrapped, len(result.Failed))
+	if len(result.Failed) > 0 {
+		logger.LogError(ip, userAgent, username, "轮换加密密钥", fmt.Sprintf("%s: %v", details, result.Failed))
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "部分文件处理失败，请保留旧主密钥并重试",
+			"data":    result,
+		})
+		return
+	}
+
+	logger.LogSystemOperation(ip, userAgent, username, "轮换加密密钥", details)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "所有文件已改用当前主密钥",
+		"data":    result,
+	})
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/logger"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockoutKindNames 失败记录维度的中文名称，用于日志和提示
+var lockoutKindNames = map[string]string{
+	models.LockoutKindIP:   "IP",
+	models.LockoutKindUser: "用户名",
+}
+
+// rejectBlockedLogin 拒绝处于退避或锁定期的登录请求，返回429和Retry-After
+func rejectBlockedLogin(c *gin.Context, username string, block *models.LoginBlock) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	seconds := int(math.Ceil(block.RetryAfter.Seconds()))
+
+	var message string
+	if errors.Is(block.Err, models.ErrLoginLocked) {
+		message = fmt.Sprintf("登录失败次数过多，已临时锁定，请%d秒后再试", seconds)
+		logger.LogSecurityEvent(ip, userAgent, username, "锁定期间尝试登录", fmt.Sprintf("%s已被锁定，拒绝用户名 %s 的登录请求，剩余%d秒", lockoutKindNames[block.Kind], username, seconds))
+	} else {
+		message = fmt.Sprintf("登录尝试过于频繁，请%d秒后再试", seconds)
+		logger.LogError(ip, userAgent, username, "登录失败", fmt.Sprintf("登录尝试过于频繁，拒绝用户名 %s 的登录请求，需等待%d秒", username, seconds))
+	}
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code":    429,
+		"message": message,
+		"data": gin.H{
+			"retry_after": seconds,
+		},
+	})
+}
+
+// recordLoginFailure 记录登录失败，IP或用户名因此被锁定时写入安全事件
+func recordLoginFailure(c *gin.Context, username string) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	for _, attempt := range models.RecordLoginFailure(ip, username) {
+		logger.LogSecurityEvent(ip, userAgent, username, "登录锁定", fmt.Sprintf("%s %s 连续登录失败%d次，锁定至 %s", lockoutKindNames[attempt.Kind], attempt.Key, attempt.Failures, attempt.LockedUntil.Format("2006-01-02 15:04:05")))
+	}
+}
+
+// ListLoginLockouts 列出登录失败记录和锁定状态
+func ListLoginLockouts(c *gin.Context) {
+	list := models.ListLoginAttempts()
+	views := make([]gin.H, 0, len(list))
+	for _, attempt := range list {
+		views = append(views, gin.H{
+			"kind":         attempt.Kind,
+			"key":          attempt.Key,
+			"failures":     attempt.Failures,
+			"last_failure": attempt.LastFailure,
+			"next_allowed": attempt.NextAllowed,
+			"locked":       attempt.Locked(),
+			"locked_until": attempt.LockedUntil,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": views,
+	})
+}
+
+// ClearLoginLockout 解除IP或用户名的登录锁定
+func ClearLoginLockout(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	kind := c.Query("kind")
+	key := c.Query("key")
+
+	if err := models.ClearLoginAttempt(kind, key); err != nil {
+		status, message := http.StatusInternalServerError, "解除锁定失败"
+		switch {
+		case errors.Is(err, models.ErrInvalidLockoutKind):
+			status, message = http.StatusBadRequest, "kind参数应为ip或user"
+		case errors.Is(err, models.ErrLockoutNotFound):
+			status, message = http.StatusNotFound, "没有该IP或用户名的登录失败记录"
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "解除登录锁定", fmt.Sprintf("解除%s %s 的登录锁定", lockoutKindNames[kind], key))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已解除锁定",
+	})
+}
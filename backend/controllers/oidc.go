@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/logger"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie 保存state的Cookie，回调时校验是同一个浏览器发起的登录
+const oidcStateCookie = "oidc_state"
+
+// oidcErrorMessage 将单点登录错误转换为提示信息
+func oidcErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, models.ErrOIDCDisabled):
+		return "未启用单点登录"
+	case errors.Is(err, models.ErrOIDCInvalidState):
+		return "登录请求已过期，请重新登录"
+	case errors.Is(err, models.ErrOIDCProvider):
+		return "无法连接身份提供方，请稍后重试"
+	case errors.Is(err, models.ErrOIDCInvalidToken):
+		return "身份提供方返回的令牌无效"
+	case errors.Is(err, models.ErrExternalUserConflict):
+		return "已存在同名的本地用户，请联系管理员"
+	case errors.Is(err, models.ErrExternalNotProvisioned):
+		return "该账号尚未开通，请联系管理员"
+	case errors.Is(err, models.ErrInvalidUsername):
+		return "身份提供方返回的用户名不合法"
+	default:
+		return "单点登录失败"
+	}
+}
+
+// GetOIDCInfo 获取单点登录是否启用，供登录框显示单点登录按钮
+func GetOIDCInfo(c *gin.Context) {
+	cfg := config.GetConfig().OIDC
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"enabled":      cfg.Enabled,
+			"display_name": cfg.DisplayName,
+			"login_url":    "/api/auth/oidc/login",
+		},
+	})
+}
+
+// OIDCLogin 跳转到身份提供方进行授权码登录（PKCE）
+func OIDCLogin(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	state, authURL, err := models.BeginOIDCLogin(c.Request.Context())
+	if err != nil {
+		logger.LogError(ip, userAgent, "", "单点登录失败", fmt.Sprintf("发起单点登录失败: %v", err))
+		redirectLoginError(c, oidcErrorMessage(err))
+		return
+	}
+
+	middleware.SetCookie(c, oidcStateCookie, state, 10*60, "/api/auth/oidc")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 身份提供方回调：校验state，换取并校验ID令牌，关联或创建本地用户后登录
+func OIDCCallback(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	middleware.SetCookie(c, oidcStateCookie, "", -1, "/api/auth/oidc")
+
+	if e := c.Query("error"); e != "" {
+		logger.LogError(ip, userAgent, "", "单点登录失败", fmt.Sprintf("身份提供方返回错误: %s %s", e, c.Query("error_description")))
+		redirectLoginError(c, "身份提供方拒绝了登录请求")
+		return
+	}
+	if state == "" || state != cookieState {
+		logger.LogSecurityEvent(ip, userAgent, "", "单点登录state不匹配", "回调中的state与发起登录的浏览器不一致，可能是跨站请求伪造")
+		redirectLoginError(c, oidcErrorMessage(models.ErrOIDCInvalidState))
+		return
+	}
+
+	claims, err := models.CompleteOIDCLogin(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		logger.LogError(ip, userAgent, "", "单点登录失败", fmt.Sprintf("校验身份提供方令牌失败: %v", err))
+		redirectLoginError(c, oidcErrorMessage(err))
+		return
+	}
+
+	user, created, err := models.ResolveOIDCUser(claims)
+	if err != nil {
+		logger.LogError(ip, userAgent, claims.Username, "单点登录失败", fmt.Sprintf("关联本地用户失败（sub: %s）: %v", claims.Subject, err))
+		redirectLoginError(c, oidcErrorMessage(err))
+		return
+	}
+	if created {
+		logger.LogUserOperation(ip, userAgent, user.Username, "自动创建用户", fmt.Sprintf("单点登录首次登录，创建用户 %s，角色 %s", user.Username, user.Role))
+	}
+	if user.Disabled {
+		logger.LogError(ip, userAgent, user.Username, "登录失败", fmt.Sprintf("账号已被禁用，单点登录用户: %s", user.Username))
+		redirectLoginError(c, "账号已被禁用")
+		return
+	}
+
+	if err := createLoginSession(c, user.Username); err != nil {
+		logger.LogError(ip, userAgent, user.Username, "登录失败", fmt.Sprintf("创建会话失败: %v", err))
+		redirectLoginError(c, "创建会话失败")
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, user.Username, "登录成功", fmt.Sprintf("用户 %s 通过单点登录登录成功，组 %v", user.Username, claims.Groups))
+	c.Redirect(http.StatusFound, "/")
+}
+
+// redirectLoginError 跳转回首页并显示登录失败原因
+func redirectLoginError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, "/?login_error="+url.QueryEscape(message))
+}
@@ -0,0 +1,230 @@
+package controllers_test
+
+import (
+	"bytes"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/testenv"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+var env *testenv.Env
+
+func TestMain(m *testing.M) {
+	var err error
+	if env, err = testenv.New(nil); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// serveContent 测试文件内容：0123456789重复100次，共1000字节
+var serveContent = bytes.Repeat([]byte("0123456789"), 100)
+
+const servePath = "serve/data.bin"
+
+func setupServeFile(t *testing.T) *testenv.Client {
+	t.Helper()
+	if err := storage.WriteFile(env.Storage, servePath, serveContent); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// get 发送带请求头的请求
+func get(client *testenv.Client, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return client.Do(req)
+}
+
+func TestServeFileFull(t *testing.T) {
+	admin := setupServeFile(t)
+
+	for _, path := range []string{"/api/file/download/" + servePath, "/api/file/preview/" + servePath, "/upload/" + servePath} {
+		rec := get(admin, http.MethodGet, path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", path, rec.Code, rec.Body)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), serveContent) {
+			t.Fatalf("%s: body differs", path)
+		}
+		if got := rec.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Fatalf("%s: Accept-Ranges = %q", path, got)
+		}
+		if rec.Header().Get("ETag") == "" || rec.Header().Get("Last-Modified") == "" {
+			t.Fatalf("%s: missing validators: %v", path, rec.Header())
+		}
+	}
+}
+
+func TestServeFileSingleRange(t *testing.T) {
+	admin := setupServeFile(t)
+
+	tests := []struct {
+		rangeHeader  string
+		start, end   int // 闭区间
+		contentRange string
+	}{
+		{"bytes=0-9", 0, 9, "bytes 0-9/1000"},
+		{"bytes=995-", 995, 999, "bytes 995-999/1000"},
+		{"bytes=-3", 997, 999, "bytes 997-999/1000"},
+		{"bytes=990-5000", 990, 999, "bytes 990-999/1000"},
+	}
+	for _, tt := range tests {
+		rec := get(admin, http.MethodGet, "/api/file/download/"+servePath, map[string]string{"Range": tt.rangeHeader})
+		if rec.Code != http.StatusPartialContent {
+			t.Fatalf("%s: status = %d, want 206", tt.rangeHeader, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Range"); got != tt.contentRange {
+			t.Fatalf("%s: Content-Range = %q, want %q", tt.rangeHeader, got, tt.contentRange)
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(tt.end-tt.start+1) {
+			t.Fatalf("%s: Content-Length = %q", tt.rangeHeader, got)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), serveContent[tt.start:tt.end+1]) {
+			t.Fatalf("%s: body = %q", tt.rangeHeader, rec.Body)
+		}
+	}
+}
+
+func TestServeFileMultiRange(t *testing.T) {
+	admin := setupServeFile(t)
+
+	rec := get(admin, http.MethodGet, "/api/file/download/"+servePath, map[string]string{"Range": "bytes=0-1, 10-12, 998-"})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+
+	want := []struct {
+		contentRange string
+		body         string
+	}{
+		{"bytes 0-1/1000", "01"},
+		{"bytes 10-12/1000", "012"},
+		{"bytes 998-999/1000", "89"},
+	}
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for i, w := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := part.Header.Get("Content-Range"); got != w.contentRange {
+			t.Fatalf("part %d: Content-Range = %q, want %q", i, got, w.contentRange)
+		}
+		body, _ := io.ReadAll(part)
+		if string(body) != w.body {
+			t.Fatalf("part %d: body = %q, want %q", i, body, w.body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("extra part: %v", err)
+	}
+}
+
+func TestServeFileUnsatisfiableRange(t *testing.T) {
+	admin := setupServeFile(t)
+
+	for _, r := range []string{"bytes=1000-", "bytes=5000-6000"} {
+		rec := get(admin, http.MethodGet, "/api/file/download/"+servePath, map[string]string{"Range": r})
+		if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("%s: status = %d, want 416", r, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Range"); got != "bytes */1000" {
+			t.Fatalf("%s: Content-Range = %q", r, got)
+		}
+	}
+}
+
+func TestServeFileConditional(t *testing.T) {
+	admin := setupServeFile(t)
+	path := "/api/file/download/" + servePath
+
+	etag := get(admin, http.MethodGet, path, nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	// If-None-Match匹配时返回304且没有响应体
+	rec := get(admin, http.MethodGet, path, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("If-None-Match: status = %d, body length = %d", rec.Code, rec.Body.Len())
+	}
+	rec = get(admin, http.MethodGet, path, map[string]string{"If-None-Match": `"other"`})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("If-None-Match mismatch: status = %d, want 200", rec.Code)
+	}
+
+	// If-Range匹配时按Range返回，不匹配时返回完整内容
+	rec = get(admin, http.MethodGet, path, map[string]string{"Range": "bytes=0-4", "If-Range": etag})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "01234" {
+		t.Fatalf("If-Range match: status = %d, body = %q", rec.Code, rec.Body)
+	}
+	rec = get(admin, http.MethodGet, path, map[string]string{"Range": "bytes=0-4", "If-Range": `"stale"`})
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), serveContent) {
+		t.Fatalf("If-Range mismatch: status = %d, body length = %d", rec.Code, rec.Body.Len())
+	}
+
+	// 文件被覆盖后旧的ETag失效
+	if err := storage.WriteFile(env.Storage, servePath, append(serveContent, '!')); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.WriteFile(env.Storage, servePath, serveContent)
+	rec = get(admin, http.MethodGet, path, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Body.Len() != len(serveContent)+1 {
+		t.Fatalf("If-None-Match after overwrite: status = %d, body length = %d", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestServeFileHead(t *testing.T) {
+	admin := setupServeFile(t)
+
+	rec := get(admin, http.MethodHead, "/api/file/download/"+servePath, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("HEAD returned a body of %d bytes", rec.Body.Len())
+	}
+	if got := rec.Header().Get("Content-Length"); got != "1000" {
+		t.Fatalf("Content-Length = %q, want 1000", got)
+	}
+
+	rec = get(admin, http.MethodHead, "/api/file/download/"+servePath, map[string]string{"Range": "bytes=0-9"})
+	if rec.Code != http.StatusPartialContent || rec.Body.Len() != 0 {
+		t.Fatalf("ranged HEAD: status = %d, body length = %d", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestServeFileNotFound(t *testing.T) {
+	admin := setupServeFile(t)
+
+	for _, path := range []string{"/api/file/download/serve/missing.bin", "/api/file/preview/serve/missing.bin", "/upload/serve/missing.bin"} {
+		rec := get(admin, http.MethodGet, path, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: status = %d, want 404", path, rec.Code)
+		}
+	}
+	rec := get(admin, http.MethodGet, "/api/file/download/"+servePath, map[string]string{"Range": "bytes=0-9"})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("existing file after 404: status = %d", rec.Code)
+	}
+}
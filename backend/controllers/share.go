@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sharePasswordHeader 非浏览器客户端可直接通过请求头提交分享密码
+const sharePasswordHeader = "X-Share-Password"
+
+// shareView 返回给分享创建者的分享信息，不包含密码哈希
+func shareView(share models.Share) gin.H {
+	return gin.H{
+		"token":         share.Token,
+		"url":           "/s/" + share.Token,
+		"path":          share.Path,
+		"is_dir":        share.IsDir,
+		"has_password":  share.HasPassword(),
+		"expires_at":    share.ExpiresAt,
+		"max_downloads": share.MaxDownloads,
+		"downloads":     share.Downloads,
+		"visits":        share.Visits,
+		"created_by":    share.CreatedBy,
+		"created_at":    share.CreatedAt,
+	}
+}
+
+// shareErrorStatus 将分享错误转换为状态码和提示信息
+func shareErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrShareNotFound):
+		return http.StatusNotFound, "分享不存在或已被取消"
+	case errors.Is(err, models.ErrShareExpired):
+		return http.StatusGone, "分享已过期"
+	case errors.Is(err, models.ErrShareLimitReached):
+		return http.StatusGone, "分享的下载次数已用完"
+	case errors.Is(err, models.ErrSharePassword):
+		return http.StatusUnauthorized, "需要输入正确的访问密码"
+	default:
+		return fileErrorStatus(err, fallback)
+	}
+}
+
+// CreateShare 创建分享链接
+func CreateShare(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path         string `json:"path"`
+		Password     string `json:"password"`
+		ExpiresIn    int64  `json:"expires_in"`    // 有效期（秒），0表示永不过期
+		MaxDownloads int    `json:"max_downloads"` // 最大下载次数，0表示不限制
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.ExpiresIn < 0 || req.MaxDownloads < 0 {
+		logger.LogError(ip, userAgent, username, "创建分享失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 不能分享整个上传目录
+	sharePath := strings.Trim(path.Clean("/"+strings.ReplaceAll(req.Path, `\`, "/")), "/")
+	if sharePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "不能分享根目录",
+		})
+		return
+	}
+
+	// 分享目录会公开其下所有内容，需要对整个目录都有读取权限
+	if !checkPermission(c, models.PermShare, req.Path) || !checkTreePermission(c, models.PermRead, req.Path) {
+		return
+	}
+
+	info, err := utils.StatEntry(req.Path)
+	if err != nil {
+		status, message := fileErrorStatus(err, "创建分享失败")
+		logger.LogError(ip, userAgent, username, "创建分享失败", fmt.Sprintf("分享 %s 失败: %v", req.Path, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	share, err := models.CreateShare(sharePath, info.IsDir(), req.Password, expiresAt, req.MaxDownloads, username)
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "创建分享失败", fmt.Sprintf("保存分享失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "创建分享失败",
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "创建分享", fmt.Sprintf("%s (%s)", share.Path, share.Token), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "分享创建成功",
+		"data":    shareView(share),
+	})
+}
+
+// ListShares 列出分享，管理员可以看到所有人的分享
+func ListShares(c *gin.Context) {
+	owner := c.GetString("username")
+	if c.GetString("role") == models.RoleAdmin {
+		owner = ""
+	}
+
+	list := models.ListShares(owner)
+	views := make([]gin.H, 0, len(list))
+	for _, share := range list {
+		views = append(views, shareView(share))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": views,
+	})
+}
+
+// RevokeShare 取消分享，普通用户只能取消自己创建的分享
+func RevokeShare(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	token := c.Param("token")
+
+	owner := username
+	if c.GetString("role") == models.RoleAdmin {
+		owner = ""
+	}
+
+	share, err := models.RevokeShare(token, owner)
+	if err != nil {
+		status, message := shareErrorStatus(err, "取消分享失败")
+		logger.LogError(ip, userAgent, username, "取消分享失败", fmt.Sprintf("取消分享 %s 失败: %v", token, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "取消分享", fmt.Sprintf("%s (%s)，共访问 %d 次，下载 %d 次", share.Path, share.Token, share.Visits, share.Downloads), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "分享已取消",
+	})
+}
+
+// SharePage 分享页面
+func SharePage(c *gin.Context) {
+	c.File("./frontend/share.html")
+}
+
+// ShareInfo 获取分享信息，目录分享同时返回path指定的子目录内容
+func ShareInfo(c *gin.Context) {
+	share, ok := loadShare(c)
+	if !ok {
+		return
+	}
+
+	sub := c.Query("path")
+	rel, err := utils.ResolveSubPath(share.Path, sub)
+	if err == nil && !share.IsDir && rel != share.Path {
+		err = utils.ErrInvalidPath
+	}
+	if err != nil {
+		status, message := shareErrorStatus(err, "获取分享内容失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 只统计进入分享首页的次数，浏览子目录不重复计数
+	if sub == "" {
+		visits, err := models.RecordShareVisit(share.Token)
+		if err != nil {
+			logger.LogError(c.ClientIP(), c.Request.UserAgent(), "", "保存分享统计失败", fmt.Sprintf("%s (%s): %v", share.Path, share.Token, err))
+		}
+		logger.LogFileOperation(c.ClientIP(), c.Request.UserAgent(), "", "访问分享", fmt.Sprintf("%s (%s) 第 %d 次访问", share.Path, share.Token, visits), 0)
+	}
+
+	data := gin.H{
+		"name":          path.Base(share.Path),
+		"is_dir":        share.IsDir,
+		"expires_at":    share.ExpiresAt,
+		"max_downloads": share.MaxDownloads,
+		"downloads":     share.Downloads,
+	}
+
+	info, err := utils.StatEntry(rel)
+	if err != nil {
+		status, message := shareErrorStatus(err, "获取分享内容失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	if info.IsDir() {
+		files, err := utils.ListFiles(rel, "name", "asc")
+		if err != nil {
+			status, message := shareErrorStatus(err, "获取分享内容失败")
+			c.JSON(status, gin.H{
+				"code":    status,
+				"message": message,
+			})
+			return
+		}
+		// 只暴露分享内的相对路径
+		for i := range files {
+			files[i].Path = strings.TrimPrefix(files[i].Path, share.Path+"/")
+		}
+		data["files"] = files
+	} else {
+		data["size"] = info.Size()
+		data["modified_time"] = info.ModTime()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": data,
+	})
+}
+
+// ShareAuth 校验分享密码，成功后通过Cookie保存访问凭证
+func ShareAuth(c *gin.Context) {
+	share, err := models.GetShare(c.Param("token"))
+	if err == nil && !shareCreatorAllowed(share) {
+		err = models.ErrShareNotFound
+	}
+	if err != nil {
+		status, message := shareErrorStatus(err, "访问分享失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+	block, ok := checkSharePassword(c, share, req.Password)
+	if block != nil {
+		rejectBlockedLogin(c, shareLockoutKey(share.Token), block)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "访问密码错误",
+		})
+		return
+	}
+
+	middleware.SetCookie(c, shareCookieName(share.Token), models.ShareAccessKey(share), 0, "/s/"+share.Token)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "验证成功",
+	})
+}
+
+// ShareDownload 下载分享的文件，目录打包下载，path指定目录分享中的子路径
+func ShareDownload(c *gin.Context) {
+	share, ok := loadShare(c)
+	if !ok {
+		return
+	}
+
+	rel, err := utils.ResolveSubPath(share.Path, c.Query("path"))
+	if err == nil && !share.IsDir && rel != share.Path {
+		err = utils.ErrInvalidPath
+	}
+	var info fs.FileInfo
+	if err == nil {
+		info, err = utils.StatEntry(rel)
+	}
+	if err != nil {
+		status, message := shareErrorStatus(err, "下载分享文件失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 先预留下载额度再发送，避免并发请求在计数前都通过下载次数检查；HEAD请求不发送内容，不占用额度
+	if c.Request.Method != http.MethodGet {
+		serveFile(c, rel, "下载分享文件", true)
+		return
+	}
+	size, want := info.Size(), info.Size()
+	if info.IsDir() {
+		size, want = 0, 0
+	} else {
+		want = requestedBytes(c.GetHeader("Range"), size)
+	}
+	reservation, err := models.ReserveShareDownload(share.Token, want, size)
+	if err != nil {
+		status, message := shareErrorStatus(err, "下载分享文件失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 按实际发送的字节数计入下载次数，断点续传和视频拖动产生的多个Range请求合计为一次下载
+	var sent int64
+	defer func() {
+		downloads, added, err := models.FinishShareDownload(reservation, sent)
+		if err != nil {
+			logger.LogError(c.ClientIP(), c.Request.UserAgent(), "", "保存分享统计失败", fmt.Sprintf("%s (%s): %v", share.Path, share.Token, err))
+		}
+		if added > 0 {
+			logger.LogFileOperation(c.ClientIP(), c.Request.UserAgent(), "", "下载分享", fmt.Sprintf("%s (%s) 第 %d 次下载", rel, share.Token, downloads), 0)
+		}
+	}()
+	serveFile(c, rel, "下载分享文件", true)
+	if c.Writer.Status() < http.StatusBadRequest {
+		sent = int64(c.Writer.Size())
+	}
+}
+
+// requestedBytes 估算请求要发送的字节数，只解析单个区间，多个区间或无法解析时按整个文件计
+func requestedBytes(rangeHeader string, size int64) int64 {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return size
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return size
+	}
+	if first == "" {
+		// bytes=-n 表示最后n个字节
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return size
+		}
+		return min(n, size)
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return size
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return size
+		}
+		end = min(end, size-1)
+	}
+	return end - start + 1
+}
+
+// loadShare 加载分享并校验有效期、下载次数和访问密码，失败时已写入响应
+func loadShare(c *gin.Context) (models.Share, bool) {
+	share, err := models.GetShare(c.Param("token"))
+	if err == nil && !shareCreatorAllowed(share) {
+		err = models.ErrShareNotFound
+	}
+	if err == nil {
+		key, _ := c.Cookie(shareCookieName(share.Token))
+		if !models.VerifyShareAccess(share, key) {
+			// 未提交密码时只提示需要密码，不计入失败次数
+			password := c.GetHeader(sharePasswordHeader)
+			if share.HasPassword() && password == "" {
+				err = models.ErrSharePassword
+			} else if block, ok := checkSharePassword(c, share, password); block != nil {
+				rejectBlockedLogin(c, shareLockoutKey(share.Token), block)
+				return models.Share{}, false
+			} else if !ok {
+				err = models.ErrSharePassword
+			}
+		}
+	}
+	if err != nil {
+		status, message := shareErrorStatus(err, "访问分享失败")
+		response := gin.H{
+			"code":    status,
+			"message": message,
+		}
+		if errors.Is(err, models.ErrSharePassword) {
+			response["data"] = gin.H{"password_required": true}
+		}
+		c.JSON(status, response)
+		return models.Share{}, false
+	}
+	return share, true
+}
+
+// shareCreatorAllowed 分享创建者是否仍有分享权限和整个分享内容的读取权限，权限被收回后分享随之失效
+func shareCreatorAllowed(share models.Share) bool {
+	owner, err := models.GetUser(share.CreatedBy)
+	if err != nil {
+		return false
+	}
+	return allPermissionPaths(share.Path, func(p string) bool {
+		return models.HasPermission(owner, p, models.PermShare) && models.HasTreePermission(owner, p, models.PermRead)
+	})
+}
+
+// shareCookieName 保存分享访问凭证的Cookie名称
+func shareCookieName(token string) string {
+	return "share_" + token
+}
+
+// shareLockoutKey 分享密码按分享令牌计入登录失败记录，用户名不能包含冒号，不会与真实用户名冲突
+func shareLockoutKey(token string) string {
+	return "share:" + token
+}
+
+// checkSharePassword 校验分享密码，失败次数与登录共用退避和锁定规则，处于限制期时返回限制原因且不校验密码
+func checkSharePassword(c *gin.Context, share models.Share, password string) (*models.LoginBlock, bool) {
+	if !share.HasPassword() {
+		return nil, true
+	}
+	key := shareLockoutKey(share.Token)
+	if block := models.CheckLoginAllowed(c.ClientIP(), key); block != nil {
+		return block, false
+	}
+	if !models.CheckSharePassword(share, password) {
+		logger.LogError(c.ClientIP(), c.Request.UserAgent(), "", "分享密码错误", fmt.Sprintf("分享 %s 密码校验失败", share.Token))
+		recordLoginFailure(c, key)
+		return nil, false
+	}
+	models.RecordLoginSuccess(key)
+	return nil, true
+}
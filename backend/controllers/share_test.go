@@ -0,0 +1,159 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/testenv"
+	"net/http"
+	"testing"
+)
+
+// createShare 以管理员身份创建分享，返回分享令牌
+func createShare(t *testing.T, admin *testenv.Client, req map[string]any) string {
+	t.Helper()
+	rec := admin.JSON(http.MethodPost, "/api/share", req)
+	resp, err := testenv.Decode(rec)
+	if err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("create share: %d %s (%v)", rec.Code, rec.Body, err)
+	}
+	var share struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(resp.Data, &share); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, attempt := range models.ListLoginAttempts() {
+			models.ClearLoginAttempt(attempt.Kind, attempt.Key)
+		}
+	})
+	return share.Token
+}
+
+func TestSharePasswordLockout(t *testing.T) {
+	admin := setupServeFile(t)
+	token := createShare(t, admin, map[string]any{"path": servePath, "password": "secret"})
+	guest := env.Client()
+
+	// 未提交密码只提示需要密码，不计入失败次数
+	for range 10 {
+		if rec := guest.Get("/s/" + token + "/info"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("info without password: status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	maxFailures := env.Config.Login.MaxFailures
+	for i := range maxFailures {
+		rec := guest.JSON(http.MethodPost, "/s/"+token+"/auth", map[string]string{"password": "wrong"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d: %s", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	// 锁定后正确的密码也被拒绝，请求头方式同样受限
+	rec := guest.JSON(http.MethodPost, "/s/"+token+"/auth", map[string]string{"password": "secret"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("auth while locked: status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = get(guest, http.MethodGet, "/s/"+token+"/download", map[string]string{"X-Share-Password": "secret"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("download while locked: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// 锁定只针对这个分享，登录不受影响
+	if _, err := env.Login("admin", "admin123"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.ClearLoginAttempt(models.LockoutKindUser, "share:"+token); err != nil {
+		t.Fatal(err)
+	}
+	rec = guest.JSON(http.MethodPost, "/s/"+token+"/auth", map[string]string{"password": "secret"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("auth after unlock: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec = guest.Get("/s/" + token + "/download"); rec.Code != http.StatusOK {
+		t.Fatalf("download with cookie: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestShareDownloadReservation(t *testing.T) {
+	admin := setupServeFile(t)
+	token := createShare(t, admin, map[string]any{"path": servePath, "max_downloads": 1})
+	guest := env.Client()
+	download := "/s/" + token + "/download"
+	size := int64(len(serveContent))
+
+	// 另一个请求正在发送完整文件时，额度已被预留，不能再下载
+	reservation, err := models.ReserveShareDownload(token, size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := guest.Get(download); rec.Code != http.StatusGone {
+		t.Fatalf("download while reserved: status = %d: %s", rec.Code, rec.Body)
+	}
+	// 发送失败时释放额度，不计入下载次数
+	if downloads, added, err := models.FinishShareDownload(reservation, 0); downloads != 0 || added != 0 || err != nil {
+		t.Fatalf("failed download counted: %d, %d, %v", downloads, added, err)
+	}
+
+	// Range请求只预留所请求的区间，剩余部分仍可并发下载
+	if reservation, err = models.ReserveShareDownload(token, size/2, size); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(guest, http.MethodGet, download, map[string]string{"Range": "bytes=500-"}); rec.Code != http.StatusPartialContent {
+		t.Fatalf("range download: status = %d: %s", rec.Code, rec.Body)
+	}
+	models.FinishShareDownload(reservation, 0)
+
+	if rec := get(guest, http.MethodGet, download, map[string]string{"Range": "bytes=0-499"}); rec.Code != http.StatusPartialContent {
+		t.Fatalf("second range: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := guest.Get(download); rec.Code != http.StatusGone {
+		t.Fatalf("download after limit: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestShareFollowsCreatorPermissions(t *testing.T) {
+	admin := setupServeFile(t)
+	if _, err := models.CreateUser("sharer", "sharer123", models.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		models.DeleteACLEntry("serve", models.UserSubject("sharer"))
+		models.DeleteUserShares("sharer")
+		models.DeleteUser("sharer")
+	})
+	sharer, err := env.Login("sharer", "sharer123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := createShare(t, sharer, map[string]any{"path": servePath})
+	guest := env.Client()
+	if rec := guest.Get("/s/" + token + "/download"); rec.Code != http.StatusOK {
+		t.Fatalf("download: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// 收回创建者的分享权限后，已有的分享链接失效
+	if _, err := models.SetACLEntry("serve", models.UserSubject("sharer"), []string{models.PermRead}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := guest.Get("/s/" + token + "/download"); rec.Code != http.StatusNotFound {
+		t.Fatalf("download after revoking share permission: status = %d: %s", rec.Code, rec.Body)
+	}
+	if err := models.DeleteACLEntry("serve", models.UserSubject("sharer")); err != nil {
+		t.Fatal(err)
+	}
+	if rec := guest.Get("/s/" + token + "/info"); rec.Code != http.StatusOK {
+		t.Fatalf("info after restoring permission: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// 删除文件会撤销分享，之后在同一路径创建的文件不会通过旧链接公开
+	if rec := admin.JSON(http.MethodDelete, "/api/file/delete/"+servePath, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status = %d: %s", rec.Code, rec.Body)
+	}
+	setupServeFile(t)
+	if rec := guest.Get("/s/" + token + "/download"); rec.Code != http.StatusNotFound {
+		t.Fatalf("download after delete: status = %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/logger"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenView API令牌的对外展示信息，不包含密钥哈希
+func tokenView(token models.APIToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix(),
+		"scopes":       token.Scopes,
+		"expires_at":   token.ExpiresAt,
+		"expired":      token.Expired(),
+		"created_at":   token.CreatedAt,
+		"last_used_at": token.LastUsedAt,
+		"last_used_ip": token.LastUsedIP,
+	}
+}
+
+// tokenErrorStatus 将API令牌错误转换为状态码和提示信息
+func tokenErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrTokenNotFound):
+		return http.StatusNotFound, "API令牌不存在"
+	case errors.Is(err, models.ErrInvalidTokenName):
+		return http.StatusBadRequest, "令牌名称不能为空且不能超过64个字符"
+	case errors.Is(err, models.ErrInvalidScope):
+		return http.StatusBadRequest, "权限范围不合法，可选值为read、write、admin"
+	case errors.Is(err, models.ErrAdminScopeDenied):
+		return http.StatusForbidden, "只有管理员可以创建admin权限范围的令牌"
+	case errors.Is(err, models.ErrTokenLimitReached):
+		return http.StatusConflict, "API令牌数量已达上限"
+	default:
+		return http.StatusInternalServerError, fallback
+	}
+}
+
+// requireSession 令牌管理接口只允许通过会话访问，防止泄露的令牌创建新令牌
+func requireSession(c *gin.Context) bool {
+	if _, ok := middleware.CurrentToken(c); !ok {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"code":    403,
+		"message": "请登录后管理API令牌，不能使用API令牌访问",
+	})
+	return false
+}
+
+// ListTokens 列出当前用户的API令牌
+func ListTokens(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+
+	list := models.ListTokens(c.GetString("username"))
+	views := make([]gin.H, 0, len(list))
+	for _, token := range list {
+		views = append(views, tokenView(token))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": views,
+	})
+}
+
+// CreateToken 创建API令牌，令牌明文只在响应中返回一次
+func CreateToken(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"` // 有效期（秒），0表示永不过期
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.ExpiresIn < 0 {
+		logger.LogError(ip, userAgent, username, "创建API令牌失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	raw, token, err := models.CreateToken(user, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		status, message := tokenErrorStatus(err, "创建API令牌失败")
+		logger.LogError(ip, userAgent, username, "创建API令牌失败", fmt.Sprintf("创建API令牌 %s 失败: %v", req.Name, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "创建API令牌", fmt.Sprintf("创建API令牌 %s（%s），权限范围 %v", token.Name, token.Prefix(), token.Scopes))
+	view := tokenView(token)
+	view["token"] = raw
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "API令牌创建成功，请立即保存，令牌只显示一次",
+		"data":    view,
+	})
+}
+
+// RevokeToken 撤销当前用户的API令牌
+func RevokeToken(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	token, err := models.RevokeToken(username, c.Param("id"))
+	if err != nil {
+		status, message := tokenErrorStatus(err, "撤销API令牌失败")
+		logger.LogError(ip, userAgent, username, "撤销API令牌失败", fmt.Sprintf("撤销API令牌 %s 失败: %v", c.Param("id"), err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "撤销API令牌", fmt.Sprintf("撤销API令牌 %s（%s）", token.Name, token.Prefix()))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "API令牌已撤销",
+	})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash 获取回收站条目列表
+func ListTrash(c *gin.Context) {
+	items, err := utils.ListTrash()
+	if err != nil {
+		logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "获取回收站失败", fmt.Sprintf("获取回收站失败: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "获取回收站失败",
+		})
+		return
+	}
+
+	// 只显示原位置有读取权限的条目
+	visible := items[:0]
+	for _, item := range items {
+		if hasPermission(c, models.PermRead, item.OriginalPath) {
+			visible = append(visible, item)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": visible,
+	})
+}
+
+// RestoreTrashItem 将回收站条目恢复到原位置，原位置已存在时默认返回冲突
+func RestoreTrashItem(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	id := c.Param("id")
+
+	policy, err := utils.ParseConflictPolicy(c.Query("conflict"), utils.ConflictFail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "冲突策略不合法",
+		})
+		return
+	}
+
+	if !checkTrashItem(c, id, models.PermWrite) {
+		return
+	}
+
+	path, err := utils.RestoreTrashItem(id, policy)
+	if err != nil {
+		status, message := fileErrorStatus(err, "恢复文件失败")
+		logger.LogError(ip, userAgent, username, "恢复文件失败", fmt.Sprintf("回收站条目 %s 恢复失败: %v", id, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "恢复文件", path, 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件恢复成功",
+		"data": gin.H{
+			"path": path,
+		},
+	})
+}
+
+// PurgeTrashItem 彻底删除回收站条目
+func PurgeTrashItem(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	id := c.Param("id")
+
+	if !checkTrashItem(c, id, models.PermDelete) {
+		return
+	}
+
+	if err := utils.PurgeTrashItem(id); err != nil {
+		status, message := fileErrorStatus(err, "彻底删除失败")
+		logger.LogError(ip, userAgent, username, "彻底删除失败", fmt.Sprintf("回收站条目 %s 删除失败: %v", id, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "彻底删除", id, 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "已彻底删除",
+	})
+}
+
+// EmptyTrash 清空回收站（仅管理员）
+func EmptyTrash(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	count, err := utils.EmptyTrash()
+	if err != nil {
+		logger.LogError(ip, userAgent, username, "清空回收站失败", fmt.Sprintf("清空回收站失败（已删除 %d 项）: %v", count, err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "清空回收站失败",
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "清空回收站", fmt.Sprintf("共 %d 项", count), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "回收站已清空",
+		"data": gin.H{
+			"count": count,
+		},
+	})
+}
+
+// checkTrashItem 检查当前用户对回收站条目原位置的权限，失败时已写入响应
+func checkTrashItem(c *gin.Context, id, perm string) bool {
+	item, err := utils.GetTrashItem(id)
+	if err != nil {
+		status, message := fileErrorStatus(err, "读取回收站条目失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return false
+	}
+	return checkTreePermission(c, perm, item.OriginalPath)
+}
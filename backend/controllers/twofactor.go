@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// twoFactorErrorStatus 将两步验证错误转换为状态码和提示信息
+func twoFactorErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, models.ErrTwoFactorEnabled):
+		return http.StatusConflict, "两步验证已启用，请先关闭后再重新绑定"
+	case errors.Is(err, models.ErrTwoFactorNotEnabled):
+		return http.StatusBadRequest, "未启用两步验证"
+	case errors.Is(err, models.ErrNoPendingEnrollment):
+		return http.StatusBadRequest, "请先获取绑定密钥"
+	case errors.Is(err, models.ErrInvalidTOTPCode):
+		return http.StatusUnauthorized, "验证码错误"
+	case errors.Is(err, models.ErrInvalidChallenge):
+		return http.StatusUnauthorized, "登录已过期，请重新输入用户名和密码"
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return http.StatusUnauthorized, "密码错误"
+	case errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound, "用户不存在"
+	default:
+		return http.StatusInternalServerError, fallback
+	}
+}
+
+// LoginTwoFactor 登录第二步：提交登录挑战和TOTP验证码（或恢复码）
+func LoginTwoFactor(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	var req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, "", "登录失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	// 验证码错误同样计入登录失败次数，防止已知密码时穷举验证码
+	if username, ok := models.LoginChallengeUsername(req.Challenge); ok {
+		if block := models.CheckLoginAllowed(ip, username); block != nil {
+			rejectBlockedLogin(c, username, block)
+			return
+		}
+	}
+
+	username, usedRecovery, err := models.CompleteLoginChallenge(req.Challenge, req.Code)
+	if err != nil {
+		status, message := twoFactorErrorStatus(err, "登录失败")
+		logger.LogError(ip, userAgent, username, "登录失败", fmt.Sprintf("两步验证失败: %v", err))
+		if errors.Is(err, models.ErrInvalidTOTPCode) {
+			recordLoginFailure(c, username)
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	// 输入验证码期间账号可能被禁用或删除
+	user, err := models.GetUser(username)
+	if err != nil || user.Disabled {
+		logger.LogError(ip, userAgent, username, "登录失败", "两步验证期间账号已被禁用或删除")
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "账号已被禁用",
+		})
+		return
+	}
+
+	details := fmt.Sprintf("用户 %s 通过两步验证登录成功", username)
+	if usedRecovery {
+		details = fmt.Sprintf("用户 %s 使用恢复码登录成功", username)
+	}
+	startSession(c, username, details)
+}
+
+// GetTwoFactorStatus 查询当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+
+	enabled, remaining, enabledAt := models.TwoFactorStatus(c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"enabled":                  enabled,
+			"enabled_at":               enabledAt,
+			"recovery_codes_remaining": remaining,
+		},
+	})
+}
+
+// SetupTwoFactor 生成TOTP密钥和otpauth URI，用身份验证器应用扫描或手动输入后确认
+func SetupTwoFactor(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	secret, uri, err := models.BeginTOTPEnrollment(username)
+	if err != nil {
+		status, message := twoFactorErrorStatus(err, "生成绑定密钥失败")
+		logger.LogError(ip, userAgent, username, "绑定两步验证失败", fmt.Sprintf("生成绑定密钥失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "开始绑定两步验证", fmt.Sprintf("用户 %s 生成了新的TOTP绑定密钥", username))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "请用身份验证器应用扫描二维码或输入密钥，然后提交验证码完成绑定",
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_uri": uri,
+		},
+	})
+}
+
+// EnableTwoFactor 提交验证码确认绑定，启用两步验证并返回恢复码
+func EnableTwoFactor(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "绑定两步验证失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	codes, err := models.ConfirmTOTPEnrollment(username, req.Code)
+	if err != nil {
+		status, message := twoFactorErrorStatus(err, "启用两步验证失败")
+		logger.LogError(ip, userAgent, username, "绑定两步验证失败", fmt.Sprintf("确认绑定失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "启用两步验证", fmt.Sprintf("用户 %s 启用了两步验证", username))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "两步验证已启用，请妥善保存恢复码，恢复码只显示一次",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor 关闭两步验证，需要密码和当前验证码（或恢复码）
+func DisableTwoFactor(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "关闭两步验证失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	if err := models.VerifyPassword(username, req.Password); err != nil {
+		status, message := twoFactorErrorStatus(err, "关闭两步验证失败")
+		logger.LogError(ip, userAgent, username, "关闭两步验证失败", fmt.Sprintf("密码校验失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	_, err := models.VerifySecondFactor(username, req.Code)
+	if err == nil {
+		err = models.ResetTwoFactor(username)
+	}
+	if err != nil {
+		status, message := twoFactorErrorStatus(err, "关闭两步验证失败")
+		logger.LogError(ip, userAgent, username, "关闭两步验证失败", fmt.Sprintf("关闭两步验证失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "关闭两步验证", fmt.Sprintf("用户 %s 关闭了两步验证", username))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "两步验证已关闭",
+	})
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码
+func RegenerateRecoveryCodes(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	if !requireSession(c) {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "重新生成恢复码失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(username, req.Code)
+	if err != nil {
+		status, message := twoFactorErrorStatus(err, "重新生成恢复码失败")
+		logger.LogError(ip, userAgent, username, "重新生成恢复码失败", fmt.Sprintf("重新生成恢复码失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "重新生成恢复码", fmt.Sprintf("用户 %s 重新生成了恢复码，旧恢复码已失效", username))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "恢复码已重新生成，请妥善保存，恢复码只显示一次",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// ResetUserTwoFactor 管理员重置用户的两步验证，用于用户丢失身份验证器和恢复码的情况
+func ResetUserTwoFactor(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	target := c.Param("username")
+
+	if _, err := models.GetUser(target); err != nil {
+		status, message := twoFactorErrorStatus(err, "重置两步验证失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	if err := models.ResetTwoFactor(target); err != nil {
+		status, message := twoFactorErrorStatus(err, "重置两步验证失败")
+		logger.LogError(ip, userAgent, username, "重置两步验证失败", fmt.Sprintf("重置用户 %s 的两步验证失败: %v", target, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "重置两步验证", fmt.Sprintf("管理员 %s 重置了用户 %s 的两步验证", username, target))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "两步验证已重置",
+	})
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 分片上传使用的请求/响应头，与tus协议保持一致
+const (
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+)
+
+// uploadErrorStatus 将分片上传错误转换为状态码和提示信息
+func uploadErrorStatus(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, utils.ErrUploadNotFound):
+		return http.StatusNotFound, "上传会话不存在或已过期"
+	case errors.Is(err, utils.ErrUploadOffsetMismatch):
+		return http.StatusConflict, "上传偏移不匹配"
+	case errors.Is(err, utils.ErrUploadIncomplete):
+		return http.StatusConflict, "文件尚未上传完成"
+	case errors.Is(err, utils.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge, "上传数据超出声明的文件大小"
+	case errors.Is(err, utils.ErrChecksumMismatch):
+		return http.StatusUnprocessableEntity, "文件校验和不匹配，请重新上传"
+	case errors.Is(err, utils.ErrInvalidChecksum):
+		return http.StatusBadRequest, "校验和格式错误，应为SHA-256十六进制字符串"
+	default:
+		return fileErrorStatus(err, fallback)
+	}
+}
+
+// uploadSessionView 返回给前端的上传会话信息
+func uploadSessionView(session *utils.UploadSession) gin.H {
+	return gin.H{
+		"id":         session.ID,
+		"path":       session.Path,
+		"filename":   session.Filename,
+		"size":       session.Size,
+		"offset":     session.Offset,
+		"checksum":   session.Checksum,
+		"conflict":   session.Conflict,
+		"created_at": session.CreatedAt,
+		"updated_at": session.UpdatedAt,
+	}
+}
+
+// setUploadHeaders 设置上传进度相关的响应头
+func setUploadHeaders(c *gin.Context, session *utils.UploadSession) {
+	c.Header(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	c.Header(headerUploadLength, strconv.FormatInt(session.Size, 10))
+	c.Header("Cache-Control", "no-store")
+}
+
+// CreateUpload 创建分片上传会话
+func CreateUpload(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Path     string `json:"path"`
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+		Checksum string `json:"checksum"`
+		Conflict string `json:"conflict"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "创建上传会话失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	policy, err := utils.ParseConflictPolicy(req.Conflict, utils.ConflictOverwrite)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "冲突策略不合法",
+		})
+		return
+	}
+
+	if !checkPermission(c, models.PermWrite, req.Path) {
+		return
+	}
+
+	session, err := utils.CreateUploadSession(username, req.Path, req.Filename, req.Size, req.Checksum, policy)
+	if err != nil {
+		status, message := uploadErrorStatus(err, "创建上传会话失败")
+		logger.LogError(ip, userAgent, username, "创建上传会话失败", fmt.Sprintf("创建上传会话失败: %v", err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "创建上传会话", session.RelativePath(), session.Size)
+	setUploadHeaders(c, session)
+	c.Header("Location", "/api/file/uploads/"+session.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "上传会话创建成功",
+		"data":    uploadSessionView(session),
+	})
+}
+
+// GetUploadStatus 查询上传会话的当前偏移，HEAD请求只返回响应头
+func GetUploadStatus(c *gin.Context) {
+	session, err := utils.GetUploadSession(c.Param("id"), c.GetString("username"))
+	if err != nil {
+		status, message := uploadErrorStatus(err, "查询上传会话失败")
+		if c.Request.Method == http.MethodHead {
+			c.Status(status)
+			return
+		}
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	setUploadHeaders(c, session)
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": uploadSessionView(session),
+	})
+}
+
+// PatchUpload 在Upload-Offset指定的偏移处写入一个分片，请求体为原始字节
+func PatchUpload(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	id := c.Param("id")
+
+	offset, err := strconv.ParseInt(c.GetHeader(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "缺少或错误的Upload-Offset请求头",
+		})
+		return
+	}
+
+	session, err := utils.WriteUploadChunk(id, username, offset, c.Request.Body)
+	if session != nil {
+		setUploadHeaders(c, session)
+	}
+	if err != nil {
+		status, message := uploadErrorStatus(err, "写入分片失败")
+		logger.LogError(ip, userAgent, username, "写入分片失败", fmt.Sprintf("上传会话 %s 写入分片失败: %v", id, err))
+		response := gin.H{
+			"code":    status,
+			"message": message,
+		}
+		if session != nil {
+			response["data"] = uploadSessionView(session)
+		}
+		c.JSON(status, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "分片写入成功",
+		"data":    uploadSessionView(session),
+	})
+}
+
+// CompleteUpload 完成分片上传，校验后将文件移动到目标路径
+func CompleteUpload(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	id := c.Param("id")
+
+	// 创建会话后权限可能被收回，完成时重新检查
+	if session, err := utils.GetUploadSession(id, username); err == nil && !checkPermission(c, models.PermWrite, session.Path) {
+		return
+	}
+
+	session, err := utils.FinishUploadSession(id, username)
+	if err != nil {
+		status, message := uploadErrorStatus(err, "完成上传失败")
+		logger.LogError(ip, userAgent, username, "完成上传失败", fmt.Sprintf("上传会话 %s 完成失败: %v", id, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "上传文件", session.RelativePath(), session.Size)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "文件上传成功",
+		"data":    uploadSessionView(session),
+	})
+}
+
+// CancelUpload 取消分片上传
+func CancelUpload(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	id := c.Param("id")
+
+	if err := utils.CancelUploadSession(id, username); err != nil {
+		status, message := uploadErrorStatus(err, "取消上传失败")
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "取消上传", id, 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "上传已取消",
+	})
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userView 返回给前端的用户信息，不包含密码哈希
+func userView(user models.User) gin.H {
+	return gin.H{
+		"username":      user.Username,
+		"role":          user.Role,
+		"disabled":      user.Disabled,
+		"created_at":    user.CreatedAt,
+		"last_login_at": user.LastLoginAt,
+		"two_factor":    models.TwoFactorEnabled(user.Username),
+	}
+}
+
+// userErrorMessage 将用户存储错误转换为提示信息和状态码
+func userErrorMessage(err error) (int, string) {
+	switch err {
+	case models.ErrUserNotFound:
+		return http.StatusNotFound, "用户不存在"
+	case models.ErrUserExists:
+		return http.StatusConflict, "用户已存在"
+	case models.ErrInvalidUsername:
+		return http.StatusBadRequest, "用户名不合法"
+	case models.ErrInvalidRole:
+		return http.StatusBadRequest, "角色不合法"
+	case models.ErrPasswordTooShort:
+		return http.StatusBadRequest, "密码长度不能少于6位"
+	case models.ErrLastAdmin:
+		return http.StatusBadRequest, "不能删除、禁用或降级最后一个管理员"
+	default:
+		return http.StatusInternalServerError, "操作失败"
+	}
+}
+
+// ListUsers 列出所有用户
+func ListUsers(c *gin.Context) {
+	list := models.ListUsers()
+	data := make([]gin.H, 0, len(list))
+	for _, user := range list {
+		data = append(data, userView(user))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": data,
+	})
+}
+
+// CreateUser 创建用户
+func CreateUser(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "创建用户失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleEditor
+	}
+
+	user, err := models.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		status, message := userErrorMessage(err)
+		logger.LogError(ip, userAgent, username, "创建用户失败", fmt.Sprintf("创建用户 %s 失败: %v", req.Username, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "创建用户", fmt.Sprintf("创建用户 %s，角色: %s", user.Username, user.Role))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户创建成功",
+		"data":    userView(user),
+	})
+}
+
+// UpdateUserStatus 启用或禁用用户
+func UpdateUserStatus(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	target := c.Param("username")
+
+	var req struct {
+		Disabled bool `json:"disabled"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "更新用户状态失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	if err := models.SetUserDisabled(target, req.Disabled); err != nil {
+		status, message := userErrorMessage(err)
+		logger.LogError(ip, userAgent, username, "更新用户状态失败", fmt.Sprintf("更新用户 %s 状态失败: %v", target, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	action := "启用用户"
+	if req.Disabled {
+		action = "禁用用户"
+		// 禁用后立即使该用户的会话失效，其创建的分享在重新启用前也无法访问
+		models.DeleteUserSessions(target)
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, action, fmt.Sprintf("%s %s", action, target))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户状态更新成功",
+	})
+}
+
+// UpdateUserRole 修改用户角色，立即对该用户的会话和API令牌生效
+func UpdateUserRole(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	target := c.Param("username")
+
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.LogError(ip, userAgent, username, "修改用户角色失败", fmt.Sprintf("请求参数错误: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+		})
+		return
+	}
+
+	if err := models.SetUserRole(target, req.Role); err != nil {
+		status, message := userErrorMessage(err)
+		logger.LogError(ip, userAgent, username, "修改用户角色失败", fmt.Sprintf("修改用户 %s 的角色为 %s 失败: %v", target, req.Role, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogUserOperation(ip, userAgent, username, "修改用户角色", fmt.Sprintf("将用户 %s 的角色修改为 %s", target, req.Role))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户角色修改成功",
+	})
+}
+
+// DeleteUser 删除用户
+func DeleteUser(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	target := c.Param("username")
+
+	if err := models.DeleteUser(target); err != nil {
+		status, message := userErrorMessage(err)
+		logger.LogError(ip, userAgent, username, "删除用户失败", fmt.Sprintf("删除用户 %s 失败: %v", target, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	models.DeleteUserSessions(target)
+	if err := models.ResetTwoFactor(target); err != nil && err != models.ErrTwoFactorNotEnabled {
+		logger.LogError(ip, userAgent, username, "删除两步验证失败", fmt.Sprintf("删除用户 %s 的两步验证设置失败: %v", target, err))
+	}
+	if err := models.RemoveUserIdentities(target); err != nil {
+		logger.LogError(ip, userAgent, username, "删除单点登录关联失败", fmt.Sprintf("删除用户 %s 的单点登录关联失败: %v", target, err))
+	}
+	if err := models.DeleteUserTokens(target); err != nil {
+		logger.LogError(ip, userAgent, username, "删除API令牌失败", fmt.Sprintf("删除用户 %s 的API令牌失败: %v", target, err))
+	}
+	if err := models.DeleteUserShares(target); err != nil {
+		logger.LogError(ip, userAgent, username, "删除分享失败", fmt.Sprintf("删除用户 %s 创建的分享失败: %v", target, err))
+	}
+	if err := models.RemoveGroupMember(target); err != nil {
+		logger.LogError(ip, userAgent, username, "更新用户组失败", fmt.Sprintf("从用户组中移除 %s 失败: %v", target, err))
+	}
+	if err := models.RemoveACLSubject(models.UserSubject(target)); err != nil {
+		logger.LogError(ip, userAgent, username, "删除权限条目失败", fmt.Sprintf("删除用户 %s 的权限条目失败: %v", target, err))
+	}
+	logger.LogUserOperation(ip, userAgent, username, "删除用户", fmt.Sprintf("删除用户 %s", target))
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "用户删除成功",
+	})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListVersions 获取文件的历史版本列表
+func ListVersions(c *gin.Context) {
+	filePath := c.Query("path")
+	if !checkPermission(c, models.PermRead, filePath) {
+		return
+	}
+
+	versions, err := utils.ListVersions(filePath)
+	if err != nil {
+		status, message := fileErrorStatus(err, "获取历史版本失败")
+		logger.LogError(c.ClientIP(), c.Request.UserAgent(), c.GetString("username"), "获取历史版本失败", fmt.Sprintf("获取 %s 的历史版本失败: %v", filePath, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": versions,
+	})
+}
+
+// DownloadVersion 下载文件的指定历史版本
+func DownloadVersion(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	filePath := c.Query("path")
+	id := c.Param("id")
+
+	if !checkPermission(c, models.PermRead, filePath) {
+		return
+	}
+
+	file, version, err := utils.OpenVersion(filePath, id)
+	if err != nil {
+		status, message := fileErrorStatus(err, "下载历史版本失败")
+		logger.LogError(ip, userAgent, username, "下载历史版本失败", fmt.Sprintf("下载 %s 的版本 %s 失败: %v", filePath, id, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+	defer file.Close()
+
+	logger.LogFileOperation(ip, userAgent, username, "下载历史版本", fmt.Sprintf("%s@%s", filePath, id), version.Size)
+	// 历史版本内容不会再变化，直接使用版本ID作为ETag
+	c.Header("ETag", `"`+version.ID+`"`)
+	setAttachmentHeader(c, path.Base(filePath))
+	http.ServeContent(c.Writer, c.Request, path.Base(filePath), version.ModTime, file)
+}
+
+// RestoreVersion 将指定历史版本恢复为文件的当前内容
+func RestoreVersion(c *gin.Context) {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	username := c.GetString("username")
+	filePath := c.Query("path")
+	id := c.Param("id")
+
+	if !checkPermission(c, models.PermWrite, filePath) {
+		return
+	}
+
+	if err := utils.RestoreVersion(filePath, id); err != nil {
+		status, message := fileErrorStatus(err, "恢复历史版本失败")
+		logger.LogError(ip, userAgent, username, "恢复历史版本失败", fmt.Sprintf("恢复 %s 的版本 %s 失败: %v", filePath, id, err))
+		c.JSON(status, gin.H{
+			"code":    status,
+			"message": message,
+		})
+		return
+	}
+
+	logger.LogFileOperation(ip, userAgent, username, "恢复历史版本", fmt.Sprintf("%s@%s", filePath, id), 0)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "历史版本恢复成功",
+	})
+}
+
+// setAttachmentHeader 设置下载文件名，非ASCII文件名按RFC 2231编码
+func setAttachmentHeader(c *gin.Context, filename string) {
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
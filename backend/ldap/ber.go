@@ -0,0 +1,223 @@
+package ldap
+
+import (
+	"errors"
+	"io"
+)
+
+// BER标识符中的类别
+const (
+	classUniversal   byte = 0x00
+	classApplication byte = 0x40
+	classContext     byte = 0x80
+
+	constructedBit byte = 0x20
+)
+
+// 通用类型标签
+const (
+	tagBoolean     byte = 0x01
+	tagInteger     byte = 0x02
+	tagOctetString byte = 0x04
+	tagNull        byte = 0x05
+	tagEnumerated  byte = 0x0a
+	tagSequence    byte = 0x10
+	tagSet         byte = 0x11
+)
+
+// 单条消息的最大长度，防止恶意对端让我们分配过大的内存
+const maxPacketSize = 16 << 20
+
+var errMalformedPacket = errors.New("ldap: malformed BER packet")
+
+// packet BER编码的一个元素，只支持LDAP用到的单字节标签
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte    // 基本类型的内容
+	children    []*packet // 构造类型的子元素
+}
+
+func newPrimitive(class, tag byte, value []byte) *packet {
+	return &packet{class: class, tag: tag, value: value}
+}
+
+func newConstructed(class, tag byte, children ...*packet) *packet {
+	return &packet{class: class, constructed: true, tag: tag, children: children}
+}
+
+func newSequence(children ...*packet) *packet {
+	return newConstructed(classUniversal, tagSequence, children...)
+}
+
+func newString(s string) *packet {
+	return newPrimitive(classUniversal, tagOctetString, []byte(s))
+}
+
+func newBoolean(v bool) *packet {
+	if v {
+		return newPrimitive(classUniversal, tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(classUniversal, tagBoolean, []byte{0x00})
+}
+
+// newInteger 编码为最短的二进制补码
+func newInteger(class, tag byte, v int64) *packet {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return newPrimitive(class, tag, b)
+}
+
+// is 判断元素的类别和标签
+func (p *packet) is(class, tag byte) bool {
+	return p.class == class && p.tag == tag
+}
+
+// str 以字符串读取内容
+func (p *packet) str() string {
+	return string(p.value)
+}
+
+// int 以整数读取内容
+func (p *packet) int() (int64, error) {
+	if len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errMalformedPacket
+	}
+	v := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// bool 以布尔值读取内容
+func (p *packet) bool() bool {
+	return len(p.value) > 0 && p.value[0] != 0
+}
+
+// encode 编码为BER字节
+func (p *packet) encode() []byte {
+	body := p.value
+	if p.constructed {
+		body = nil
+		for _, child := range p.children {
+			body = append(body, child.encode()...)
+		}
+	}
+
+	id := p.class | p.tag
+	if p.constructed {
+		id |= constructedBit
+	}
+	out := append([]byte{id}, encodeLength(len(body))...)
+	return append(out, body...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// readPacket 从连接中读取一个完整的元素
+func readPacket(r io.Reader) (*packet, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	raw := header
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errMalformedPacket
+		}
+		lenBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range lenBytes {
+			length = length<<8 | int(b)
+		}
+		raw = append(raw, lenBytes...)
+	}
+	if length > maxPacketSize {
+		return nil, errMalformedPacket
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	p, rest, err := parsePacket(append(raw, body...))
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errMalformedPacket
+	}
+	return p, nil
+}
+
+// parsePacket 解析data开头的一个元素，返回剩余的字节
+func parsePacket(data []byte) (*packet, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errMalformedPacket
+	}
+	id := data[0]
+	if id&0x1f == 0x1f {
+		return nil, nil, errMalformedPacket // 不支持多字节标签
+	}
+
+	length := int(data[1])
+	offset := 2
+	if data[1]&0x80 != 0 {
+		n := int(data[1] & 0x7f)
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return nil, nil, errMalformedPacket
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if length < 0 || len(data)-offset < length {
+		return nil, nil, errMalformedPacket
+	}
+
+	p := &packet{
+		class:       id & 0xc0,
+		constructed: id&constructedBit != 0,
+		tag:         id & 0x1f,
+	}
+	body := data[offset : offset+length]
+	if p.constructed {
+		for len(body) > 0 {
+			child, rest, err := parsePacket(body)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.children = append(p.children, child)
+			body = rest
+		}
+	} else {
+		p.value = body
+	}
+	return p, data[offset+length:], nil
+}
@@ -0,0 +1,347 @@
+// Package ldap 最小的LDAPv3客户端（简单绑定、搜索、StartTLS）和用于本地开发测试的内存目录服务
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 协议操作的应用标签（RFC 4511 4.2）
+const (
+	opBindRequest           byte = 0
+	opBindResponse          byte = 1
+	opUnbindRequest         byte = 2
+	opSearchRequest         byte = 3
+	opSearchResultEntry     byte = 4
+	opSearchResultDone      byte = 5
+	opSearchResultReference byte = 19
+	opExtendedRequest       byte = 23
+	opExtendedResponse      byte = 24
+)
+
+// 搜索范围
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// 常用的结果码
+const (
+	ResultSuccess            = 0
+	ResultOperationsError    = 1
+	ResultProtocolError      = 2
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultInsufficientAccess = 50
+)
+
+// startTLSOID StartTLS扩展操作（RFC 4511 4.14）
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+var ErrEmptyPassword = errors.New("ldap: refusing unauthenticated bind with empty password")
+
+// Error 服务器返回的非成功结果
+type Error struct {
+	ResultCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.ResultCode)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.ResultCode, e.Message)
+}
+
+// IsResultCode 判断错误是否为指定结果码
+func IsResultCode(err error, code int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.ResultCode == code
+}
+
+// Entry 搜索结果中的一个条目
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAttributeValues 获取属性值，属性名不区分大小写
+func (e *Entry) GetAttributeValues(name string) []string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// GetAttributeValue 获取属性的第一个值
+func (e *Entry) GetAttributeValue(name string) string {
+	if values := e.GetAttributeValues(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// SearchRequest 搜索参数
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string // 为空表示返回所有属性
+	SizeLimit  int      // 0表示不限制
+}
+
+// Conn 一个LDAP连接，请求按顺序同步处理，不能并发使用
+type Conn struct {
+	conn    net.Conn
+	host    string
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial 连接ldap://或ldaps://地址，timeout同时作为每个请求的超时时间
+func Dial(rawURL string, timeout time.Duration, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid url: %w", err)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported url scheme %q", u.Scheme)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	addr := net.JoinHostPort(host, port)
+	var conn net.Conn
+	if u.Scheme == "ldaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, withServerName(tlsConfig, host))
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, host: host, timeout: timeout}, nil
+}
+
+// StartTLS 在明文连接上升级为TLS
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	req := newConstructed(classApplication, opExtendedRequest,
+		newPrimitive(classContext, 0, []byte(startTLSOID)),
+	)
+	resp, err := c.roundTrip(req, opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err := resultError(resp); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	tlsConn.SetDeadline(time.Now().Add(c.timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	return nil
+}
+
+// Bind 简单绑定，dn和password都为空时为匿名绑定
+// 只有dn没有密码的“未认证绑定”在很多服务器上会直接成功，这里一律拒绝
+func (c *Conn) Bind(dn, password string) error {
+	if dn != "" && password == "" {
+		return ErrEmptyPassword
+	}
+
+	req := newConstructed(classApplication, opBindRequest,
+		newInteger(classUniversal, tagInteger, 3),
+		newString(dn),
+		newPrimitive(classContext, 0, []byte(password)),
+	)
+	resp, err := c.roundTrip(req, opBindResponse)
+	if err != nil {
+		return err
+	}
+	return resultError(resp)
+}
+
+// Search 搜索条目，忽略引用（referral）
+func (c *Conn) Search(req SearchRequest) ([]*Entry, error) {
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := newSequence()
+	for _, attr := range req.Attributes {
+		attributes.children = append(attributes.children, newString(attr))
+	}
+	op := newConstructed(classApplication, opSearchRequest,
+		newString(req.BaseDN),
+		newInteger(classUniversal, tagEnumerated, int64(req.Scope)),
+		newInteger(classUniversal, tagEnumerated, 0), // derefAliases: neverDerefAliases
+		newInteger(classUniversal, tagInteger, int64(req.SizeLimit)),
+		newInteger(classUniversal, tagInteger, int64(c.timeout/time.Second)),
+		newBoolean(false),
+		filter,
+		attributes,
+	)
+
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		resp, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.is(classApplication, opSearchResultEntry):
+			entry, err := parseEntry(resp)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case resp.is(classApplication, opSearchResultReference):
+		case resp.is(classApplication, opSearchResultDone):
+			if err := resultError(resp); err != nil {
+				return entries, err
+			}
+			return entries, nil
+		default:
+			return nil, errMalformedPacket
+		}
+	}
+}
+
+// Close 发送解除绑定请求并关闭连接
+func (c *Conn) Close() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	c.send(newPrimitive(classApplication, opUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// roundTrip 发送请求并等待指定类型的响应
+func (c *Conn) roundTrip(op *packet, respOp byte) (*packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.is(classApplication, respOp) {
+		return nil, errMalformedPacket
+	}
+	return resp, nil
+}
+
+// send 封装为LDAPMessage发送，返回消息ID
+func (c *Conn) send(op *packet) (int64, error) {
+	c.msgID++
+	msg := newSequence(newInteger(classUniversal, tagInteger, c.msgID), op)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(msg.encode()); err != nil {
+		return 0, err
+	}
+	return c.msgID, nil
+}
+
+// receive 读取指定消息ID的下一个响应，返回其中的协议操作
+func (c *Conn) receive(id int64) (*packet, error) {
+	for {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+		msg, err := readPacket(c.conn)
+		if err != nil {
+			return nil, err
+		}
+		if !msg.is(classUniversal, tagSequence) || len(msg.children) < 2 {
+			return nil, errMalformedPacket
+		}
+		msgID, err := msg.children[0].int()
+		if err != nil {
+			return nil, err
+		}
+		// 消息ID为0的是服务器主动发出的通知（如即将断开连接）
+		if msgID == 0 {
+			if err := resultError(msg.children[1]); err != nil {
+				return nil, err
+			}
+			return nil, errMalformedPacket
+		}
+		if msgID == id {
+			return msg.children[1], nil
+		}
+	}
+}
+
+// resultError 解析LDAPResult，结果码非0时返回*Error
+func resultError(resp *packet) error {
+	if len(resp.children) < 3 {
+		return errMalformedPacket
+	}
+	code, err := resp.children[0].int()
+	if err != nil {
+		return err
+	}
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{ResultCode: int(code), Message: resp.children[2].str()}
+}
+
+// parseEntry 解析SearchResultEntry
+func parseEntry(resp *packet) (*Entry, error) {
+	if len(resp.children) != 2 {
+		return nil, errMalformedPacket
+	}
+	entry := &Entry{
+		DN:         resp.children[0].str(),
+		Attributes: make(map[string][]string),
+	}
+	for _, attr := range resp.children[1].children {
+		if len(attr.children) != 2 {
+			return nil, errMalformedPacket
+		}
+		name := attr.children[0].str()
+		for _, value := range attr.children[1].children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.str())
+		}
+	}
+	return entry, nil
+}
+
+// withServerName 未指定ServerName时使用连接的主机名校验证书
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
@@ -0,0 +1,258 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// 过滤器的上下文标签（RFC 4511 4.5.1）
+const (
+	filterAnd            byte = 0
+	filterOr             byte = 1
+	filterNot            byte = 2
+	filterEqualityMatch  byte = 3
+	filterSubstrings     byte = 4
+	filterGreaterOrEqual byte = 5
+	filterLessOrEqual    byte = 6
+	filterPresent        byte = 7
+	filterApproxMatch    byte = 8
+
+	substringInitial byte = 0
+	substringAny     byte = 1
+	substringFinal   byte = 2
+)
+
+var ErrInvalidFilter = errors.New("ldap: invalid search filter")
+
+// EscapeFilter 转义过滤器中的特殊字符（RFC 4515），用于拼接用户输入
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			b.WriteString(`\` + hex.EncodeToString([]byte{c}))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ValidateFilter 检查过滤器语法，用于启动时校验配置
+func ValidateFilter(filter string) error {
+	_, err := compileFilter(filter)
+	return err
+}
+
+// compileFilter 将字符串形式的过滤器编码为BER
+func compileFilter(filter string) (*packet, error) {
+	p, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, ErrInvalidFilter
+	}
+	return p, nil
+}
+
+func parseFilter(s string) (*packet, string, error) {
+	if len(s) < 2 || s[0] != '(' {
+		return nil, "", ErrInvalidFilter
+	}
+	s = s[1:]
+
+	switch s[0] {
+	case '&', '|', '!':
+		tag := map[byte]byte{'&': filterAnd, '|': filterOr, '!': filterNot}[s[0]]
+		s = s[1:]
+		p := newConstructed(classContext, tag)
+		for len(s) > 0 && s[0] == '(' {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+			s = rest
+		}
+		if len(s) == 0 || s[0] != ')' || len(p.children) == 0 || (tag == filterNot && len(p.children) != 1) {
+			return nil, "", ErrInvalidFilter
+		}
+		return p, s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", ErrInvalidFilter
+	}
+	p, err := parseFilterItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return p, s[end+1:], nil
+}
+
+// parseFilterItem 解析attr=value、attr>=value、attr<=value、attr~=value、attr=*和带*的子串匹配
+func parseFilterItem(item string) (*packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, ErrInvalidFilter
+	}
+	attr, value := item[:eq], item[eq+1:]
+
+	tag := filterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	case '~':
+		tag = filterApproxMatch
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" || strings.ContainsAny(attr, "()*\\ ") {
+		return nil, ErrInvalidFilter
+	}
+
+	if tag == filterEqualityMatch && value == "*" {
+		return newPrimitive(classContext, filterPresent, []byte(attr)), nil
+	}
+
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		substrings := newSequence()
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			v, err := unescapeFilterValue(part)
+			if err != nil {
+				return nil, err
+			}
+			kind := substringAny
+			switch i {
+			case 0:
+				kind = substringInitial
+			case len(parts) - 1:
+				kind = substringFinal
+			}
+			substrings.children = append(substrings.children, newPrimitive(classContext, kind, []byte(v)))
+		}
+		if len(substrings.children) == 0 {
+			return nil, ErrInvalidFilter
+		}
+		return newConstructed(classContext, filterSubstrings, newString(attr), substrings), nil
+	}
+
+	v, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return newConstructed(classContext, tag, newString(attr), newString(v)), nil
+}
+
+// unescapeFilterValue 还原\XX形式的转义
+func unescapeFilterValue(s string) (string, error) {
+	if strings.ContainsAny(s, "()") {
+		return "", ErrInvalidFilter
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", ErrInvalidFilter
+		}
+		decoded, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", ErrInvalidFilter
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// matchFilter 在内存目录中按过滤器匹配条目，属性名和值都不区分大小写
+func matchFilter(f *packet, entry *Entry) bool {
+	if f.class != classContext {
+		return false
+	}
+
+	switch f.tag {
+	case filterAnd:
+		for _, child := range f.children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range f.children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(f.children) == 1 && !matchFilter(f.children[0], entry)
+	case filterPresent:
+		return len(entry.GetAttributeValues(f.str())) > 0
+	case filterSubstrings:
+		if len(f.children) != 2 {
+			return false
+		}
+		for _, value := range entry.GetAttributeValues(f.children[0].str()) {
+			if matchSubstrings(strings.ToLower(value), f.children[1].children) {
+				return true
+			}
+		}
+		return false
+	case filterEqualityMatch, filterApproxMatch, filterGreaterOrEqual, filterLessOrEqual:
+		if len(f.children) != 2 {
+			return false
+		}
+		want := strings.ToLower(f.children[1].str())
+		for _, value := range entry.GetAttributeValues(f.children[0].str()) {
+			value = strings.ToLower(value)
+			switch {
+			case f.tag == filterGreaterOrEqual && value >= want,
+				f.tag == filterLessOrEqual && value <= want,
+				(f.tag == filterEqualityMatch || f.tag == filterApproxMatch) && value == want:
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(value string, parts []*packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(part.str())
+		switch part.tag {
+		case substringInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case substringAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case substringFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+			value = ""
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package ldap_test
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/ldap"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"*", `\2a`},
+		{"(", `\28`},
+		{")", `\29`},
+		{`\`, `\5c`},
+		{"\x00", `\00`},
+		{"a*b", `a\2ab`},
+		{"*)(uid=*", `\2a\29\28uid=\2a`},
+		{`admin)(|(password=*`, `admin\29\28|\28password=\2a`},
+		{"张三", "张三"},
+	}
+	for _, tt := range tests {
+		if got := ldap.EscapeFilter(tt.in); got != tt.want {
+			t.Errorf("EscapeFilter(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		// 转义后的值拼入过滤器后语法始终合法
+		if err := ldap.ValidateFilter("(uid=" + ldap.EscapeFilter(tt.in) + ")"); err != nil {
+			t.Errorf("escaped %q does not form a valid filter: %v", tt.in, err)
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	valid := []string{
+		"(uid=alice)",
+		"(uid=*)",
+		"(uid=a*)",
+		"(uid=*a*b*)",
+		"(&(objectClass=person)(uid=alice))",
+		"(|(uid=alice)(mail=alice@example.com))",
+		"(!(uid=alice))",
+		"(uidNumber>=1000)",
+		`(cn=\28x\29)`,
+	}
+	for _, filter := range valid {
+		if err := ldap.ValidateFilter(filter); err != nil {
+			t.Errorf("ValidateFilter(%q) = %v", filter, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"uid=alice",
+		"(uid=alice",
+		"(uid=alice))",
+		"(uid=alice)(uid=bob)",
+		"(=alice)",
+		"(&)",
+		"(!(uid=a)(uid=b))",
+		`(uid=\zz)`,
+		`(uid=\2)`,
+		"(u id=alice)",
+	}
+	for _, filter := range invalid {
+		if err := ldap.ValidateFilter(filter); !errors.Is(err, ldap.ErrInvalidFilter) {
+			t.Errorf("ValidateFilter(%q) = %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+}
+
+func TestEscapedFilterMatchesLiterally(t *testing.T) {
+	server := ldap.NewServer()
+	for _, uid := range []string{"alice", "bob", "a*b", "x)(uid=*", `back\slash`} {
+		server.AddEntry("uid="+uid+",ou=people,dc=example,dc=com", map[string][]string{"uid": {uid}}, "")
+	}
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := ldap.Dial(server.URL(), 5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.Bind("", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(filter string) []string {
+		t.Helper()
+		entries, err := conn.Search(ldap.SearchRequest{
+			BaseDN: "ou=people,dc=example,dc=com",
+			Scope:  ldap.ScopeWholeSubtree,
+			Filter: filter,
+		})
+		if err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+		var uids []string
+		for _, entry := range entries {
+			uids = append(uids, entry.GetAttributeValue("uid"))
+		}
+		sort.Strings(uids)
+		return uids
+	}
+
+	// 未转义时通配符会匹配其他条目，说明测试确实能发现注入
+	if got := search("(uid=a*)"); len(got) != 2 {
+		t.Fatalf("unescaped wildcard matched %q", got)
+	}
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"alice", []string{"alice"}},
+		{"*", nil},
+		{"a*", nil},
+		{"a*b", []string{"a*b"}},
+		{"x)(uid=*", []string{"x)(uid=*"}},
+		{`back\slash`, []string{`back\slash`}},
+		{"alice\x00", nil},
+	}
+	for _, tt := range tests {
+		got := search("(uid=" + ldap.EscapeFilter(tt.input) + ")")
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("escaped %q matched %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
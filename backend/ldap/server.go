@@ -0,0 +1,241 @@
+package ldap
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// Server 内存中的LDAP目录，只支持简单绑定和搜索，用于本地开发和测试LDAP登录
+// 不支持TLS，也不做访问控制：匿名或任何绑定成功的连接都能搜索全部条目
+type Server struct {
+	listener  net.Listener
+	entries   []*Entry
+	passwords map[string]string // 规范化的DN -> 密码
+	conns     map[net.Conn]struct{}
+	mu        sync.RWMutex
+	wg        sync.WaitGroup
+}
+
+// NewServer 创建空目录
+func NewServer() *Server {
+	return &Server{
+		passwords: make(map[string]string),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// AddEntry 添加条目，password不为空时可以用该DN绑定
+func (s *Server) AddEntry(dn string, attributes map[string][]string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, &Entry{DN: dn, Attributes: attributes})
+	if password != "" {
+		s.passwords[normalizeDN(dn)] = password
+	}
+}
+
+// Listen 在addr上监听并在后台处理连接，addr为127.0.0.1:0时使用随机端口
+func (s *Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+		}
+	}()
+	return nil
+}
+
+// URL 连接地址，如ldap://127.0.0.1:3389
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// serve 处理一个连接上的请求，直到客户端解除绑定或发来无法解析的消息
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		msg, err := readPacket(conn)
+		if err != nil || !msg.is(classUniversal, tagSequence) || len(msg.children) < 2 {
+			return
+		}
+		id := msg.children[0]
+		op := msg.children[1]
+		if op.class != classApplication {
+			return
+		}
+
+		var responses []*packet
+		switch op.tag {
+		case opBindRequest:
+			responses = []*packet{s.bind(op)}
+		case opSearchRequest:
+			responses = s.search(op)
+		case opUnbindRequest:
+			return
+		case opExtendedRequest:
+			// 不支持StartTLS等扩展操作
+			responses = []*packet{ldapResult(opExtendedResponse, ResultProtocolError, "unsupported extended operation")}
+		default:
+			return
+		}
+
+		for _, resp := range responses {
+			if _, err := conn.Write(newSequence(id, resp).encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind 校验简单绑定的DN和密码，DN和密码都为空时允许匿名绑定
+func (s *Server) bind(op *packet) *packet {
+	if len(op.children) != 3 || !op.children[2].is(classContext, 0) {
+		return ldapResult(opBindResponse, ResultProtocolError, "only simple bind is supported")
+	}
+	dn, password := op.children[1].str(), op.children[2].str()
+	if dn == "" && password == "" {
+		return ldapResult(opBindResponse, ResultSuccess, "")
+	}
+
+	s.mu.RLock()
+	want, ok := s.passwords[normalizeDN(dn)]
+	s.mu.RUnlock()
+	if !ok || password == "" || want != password {
+		return ldapResult(opBindResponse, ResultInvalidCredentials, "invalid credentials")
+	}
+	return ldapResult(opBindResponse, ResultSuccess, "")
+}
+
+// search 按基准DN、范围和过滤器返回条目，最后是SearchResultDone
+func (s *Server) search(op *packet) []*packet {
+	if len(op.children) != 8 {
+		return []*packet{ldapResult(opSearchResultDone, ResultProtocolError, "malformed search request")}
+	}
+	base := normalizeDN(op.children[0].str())
+	scope, _ := op.children[1].int()
+	sizeLimit, _ := op.children[3].int()
+	filter := op.children[6]
+	var attributes []string
+	for _, attr := range op.children[7].children {
+		attributes = append(attributes, attr.str())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var responses []*packet
+	for _, entry := range s.entries {
+		if !inScope(normalizeDN(entry.DN), base, scope) || !matchFilter(filter, entry) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) >= sizeLimit {
+			return append(responses, ldapResult(opSearchResultDone, ResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, encodeEntry(entry, attributes))
+	}
+	return append(responses, ldapResult(opSearchResultDone, ResultSuccess, ""))
+}
+
+// inScope 判断条目是否在搜索范围内
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ScopeBaseObject:
+		return dn == base
+	case ScopeSingleLevel:
+		parent := ""
+		if i := strings.IndexByte(dn, ','); i >= 0 {
+			parent = dn[i+1:]
+		}
+		return parent == base && dn != base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// encodeEntry 编码SearchResultEntry，attributes为空或包含*时返回所有属性
+func encodeEntry(entry *Entry, attributes []string) *packet {
+	all := len(attributes) == 0
+	for _, attr := range attributes {
+		if attr == "*" {
+			all = true
+		}
+	}
+
+	list := newSequence()
+	for name, values := range entry.Attributes {
+		if !all && !containsFold(attributes, name) {
+			continue
+		}
+		set := newConstructed(classUniversal, tagSet)
+		for _, value := range values {
+			set.children = append(set.children, newString(value))
+		}
+		list.children = append(list.children, newSequence(newString(name), set))
+	}
+	return newConstructed(classApplication, opSearchResultEntry, newString(entry.DN), list)
+}
+
+// ldapResult 编码LDAPResult形式的响应
+func ldapResult(op byte, code int, message string) *packet {
+	return newConstructed(classApplication, op,
+		newInteger(classUniversal, tagEnumerated, int64(code)),
+		newString(""),
+		newString(message),
+	)
+}
+
+// normalizeDN 转为小写并去掉RDN之间的空格，用于比较DN
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
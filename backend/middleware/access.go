@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuestReadMiddleware 游客读取控制中间件，用于下载、预览和打包下载
+// 已登录用户不受限制；游客只能读取公开目录中的内容，打包下载的目录中不能包含私有子目录
+// 路径取自filename路由参数和path查询参数，请求体中的路径由处理函数自行检查
+func GuestReadMiddleware() gin.HandlerFunc {
+	return guestAccess(models.GuestCanReadTree, func(c *gin.Context) []string {
+		paths := c.QueryArray("path")
+		if filename := c.Param("filename"); filename != "" {
+			paths = append(paths, filename)
+		}
+		return paths
+	})
+}
+
+// GuestBrowseMiddleware 游客浏览控制中间件，用于文件列表，path查询参数为空表示根目录
+// 游客可以列出公开目录，以及包含公开子目录的上级目录（列表中只保留能访问的项）
+func GuestBrowseMiddleware() gin.HandlerFunc {
+	return guestAccess(models.GuestCanBrowse, func(c *gin.Context) []string {
+		return []string{c.Query("path")}
+	})
+}
+
+// OptionalAuthMiddleware 可选认证中间件，携带有效会话或API令牌时放入当前用户，否则按游客处理
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticate(c) {
+			if !tokenScopeAllowed(c) {
+				abortScopeDenied(c)
+				return
+			}
+			if !csrfTokenValid(c) {
+				abortCSRF(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// IsGuest 当前请求是否来自未登录的游客，需在游客访问控制或可选认证中间件之后使用
+func IsGuest(c *gin.Context) bool {
+	return c.GetString("username") == ""
+}
+
+// guestAccess 可选认证，游客请求的所有路径（包括解析符号链接后的真实路径）都必须通过allowed检查
+func guestAccess(allowed func(path string) bool, requestPaths func(c *gin.Context) []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticate(c) {
+			if !tokenScopeAllowed(c) {
+				abortScopeDenied(c)
+				return
+			}
+			if !csrfTokenValid(c) {
+				abortCSRF(c)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		for _, path := range requestPaths(c) {
+			for _, p := range utils.PermissionPaths(path) {
+				if !allowed(p) {
+					AbortGuestDenied(c)
+					return
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// AbortGuestDenied 拒绝游客访问非公开内容，提示登录后访问
+func AbortGuestDenied(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"code":    401,
+		"message": "该内容不对游客公开，请登录后访问",
+	})
+	c.Abort()
+}
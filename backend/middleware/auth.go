@@ -1,25 +1,200 @@
-package middleware
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-// AuthMiddleware 认证中间件
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 从Cookie中获取认证信息
-		token, err := c.Cookie("auth_token")
-		if err != nil || token != "admin_auth_token" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "未授权访问",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
+package middleware
+
+import (
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionCookieName 会话Cookie名称
+const SessionCookieName = "auth_token"
+
+// contextUserKey gin上下文中保存当前用户的键
+const contextUserKey = "user"
+
+// contextTokenKey gin上下文中保存当前API令牌的键，使用会话认证时不存在
+const contextTokenKey = "api_token"
+
+// AuthMiddleware 认证中间件，支持会话Cookie和Authorization: Bearer API令牌
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticate(c) {
+			abortUnauthorized(c)
+			return
+		}
+		if !tokenScopeAllowed(c) {
+			abortScopeDenied(c)
+			return
+		}
+		if !csrfTokenValid(c) {
+			abortCSRF(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticate 校验API令牌或会话Cookie，成功时将当前用户放入上下文
+// 携带Authorization头时只按API令牌认证，令牌无效不会回退到Cookie
+func authenticate(c *gin.Context) bool {
+	if raw, ok := bearerToken(c); ok {
+		return authenticateToken(c, raw)
+	}
+
+	// 从Cookie中获取认证信息
+	token, err := c.Cookie(SessionCookieName)
+	if err != nil || token == "" {
+		return false
+	}
+
+	session, err := models.ValidateSession(token)
+	if err != nil {
+		ClearSessionCookie(c)
+		return false
+	}
+
+	// 用户被删除或禁用后会话立即失效
+	user, err := models.GetUser(session.Username)
+	if err != nil || user.Disabled {
+		models.DeleteSession(token)
+		ClearSessionCookie(c)
+		return false
+	}
+
+	// 滑动续期：刷新Cookie有效期与服务端过期时间保持一致
+	SetSessionCookie(c, token, session.ExpiresAt)
+
+	setCurrentUser(c, user)
+	return true
+}
+
+// authenticateToken 校验API令牌，令牌所属用户被删除或禁用后令牌同样失效
+func authenticateToken(c *gin.Context, raw string) bool {
+	token, err := models.ValidateToken(raw, c.ClientIP())
+	if err != nil {
+		return false
+	}
+
+	user, err := models.GetUser(token.Username)
+	if err != nil || user.Disabled {
+		return false
+	}
+
+	c.Set(contextTokenKey, token)
+	setCurrentUser(c, user)
+	return true
+}
+
+// bearerToken 从Authorization头中取出Bearer令牌
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		return "", false
+	}
+	scheme, raw, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(raw), true
+}
+
+// setCurrentUser 将当前用户放入上下文
+func setCurrentUser(c *gin.Context, user models.User) {
+	c.Set(contextUserKey, user)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+}
+
+// tokenScopeAllowed 使用API令牌时检查令牌的权限范围：GET、HEAD需要read，其他请求需要write
+func tokenScopeAllowed(c *gin.Context) bool {
+	token, ok := CurrentToken(c)
+	if !ok {
+		return true
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		return token.HasScope(models.ScopeRead)
+	default:
+		return token.HasScope(models.ScopeWrite)
+	}
+}
+
+// RequireRole 角色权限中间件，需在AuthMiddleware之后使用，当前用户的角色等级低于role时拒绝
+// 要求管理员时，使用API令牌的请求令牌还必须拥有admin权限范围
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.HasRole(c.GetString("role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": fmt.Sprintf("需要%s权限", models.RoleName(role)),
+			})
+			c.Abort()
+			return
+		}
+		if token, ok := CurrentToken(c); ok && role == models.RoleAdmin && !token.HasScope(models.ScopeAdmin) {
+			abortScopeDenied(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CurrentUser 获取AuthMiddleware放入上下文的当前用户
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(contextUserKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// CurrentToken 获取当前请求使用的API令牌，使用会话认证时返回false
+func CurrentToken(c *gin.Context) (models.APIToken, bool) {
+	value, ok := c.Get(contextTokenKey)
+	if !ok {
+		return models.APIToken{}, false
+	}
+	token, ok := value.(models.APIToken)
+	return token, ok
+}
+
+// SetSessionCookie 设置会话Cookie（HttpOnly）和前端需要读取的CSRF令牌Cookie
+func SetSessionCookie(c *gin.Context, token string, expiresAt time.Time) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge <= 0 {
+		maxAge = config.GetConfig().Session.TTL
+	}
+	setCookie(c, SessionCookieName, token, maxAge, "/", true)
+	setCookie(c, CSRFCookieName, models.CSRFToken(token), maxAge, "/", false)
+}
+
+// ClearSessionCookie 删除会话Cookie和CSRF令牌Cookie
+func ClearSessionCookie(c *gin.Context) {
+	setCookie(c, SessionCookieName, "", -1, "/", true)
+	setCookie(c, CSRFCookieName, "", -1, "/", false)
+}
+
+// abortUnauthorized 返回未授权响应并中止请求
+func abortUnauthorized(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"code":    401,
+		"message": "未授权访问",
+	})
+	c.Abort()
+}
+
+// abortScopeDenied 返回API令牌权限范围不足的响应并中止请求
+func abortScopeDenied(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"code":    403,
+		"message": "API令牌没有执行此操作的权限范围",
+	})
+	c.Abort()
+}
@@ -0,0 +1,171 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/testenv"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var env *testenv.Env
+
+func TestMain(m *testing.M) {
+	cfg := testenv.Config()
+	cfg.Session.TrustedOrigins = []string{"https://trusted.example.org"}
+
+	var err error
+	if env, err = testenv.New(cfg); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// httptest.NewRequest的Host为example.com
+const sameOrigin = "http://example.com"
+
+func TestSameOriginMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		referer string
+		want    int
+	}{
+		{"foreign origin", http.MethodPost, "https://evil.example.net", "", http.StatusForbidden},
+		{"foreign referer", http.MethodPost, "", "https://evil.example.net/page", http.StatusForbidden},
+		{"foreign origin wins over same-site referer", http.MethodPost, "https://evil.example.net", sameOrigin + "/disk", http.StatusForbidden},
+		{"null origin", http.MethodPost, "null", "", http.StatusForbidden},
+		{"malformed referer", http.MethodPost, "", "::not a url", http.StatusForbidden},
+		{"same origin", http.MethodPost, sameOrigin, "", http.StatusOK},
+		{"same-site referer", http.MethodPost, "", sameOrigin + "/disk", http.StatusOK},
+		{"trusted origin", http.MethodPost, "https://trusted.example.org", "", http.StatusOK},
+		{"no origin or referer", http.MethodPost, "", "", http.StatusOK},
+		{"safe method from foreign origin", http.MethodGet, "https://evil.example.net", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 退出登录不需要认证，只有来源检查会拒绝它
+			path := "/api/auth/logout"
+			if tt.method == http.MethodGet {
+				path = "/api/auth/oidc"
+			}
+			req := httptest.NewRequest(tt.method, path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+
+			rec := env.Client().Do(req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := admin.Cookie(middleware.SessionCookieName)
+	csrf, _ := admin.Cookie(middleware.CSRFCookieName)
+
+	other, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCSRF, _ := other.Cookie(middleware.CSRFCookieName)
+	if otherCSRF.Value == csrf.Value {
+		t.Fatal("two sessions share a CSRF token")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing", "", http.StatusForbidden},
+		{"wrong", "not-a-token", http.StatusForbidden},
+		{"other session", otherCSRF.Value, http.StatusForbidden},
+		{"session cookie value", session.Value, http.StatusForbidden},
+		{"valid", csrf.Value, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 不经过Client发送，避免自动带上CSRF令牌；同时不带Origin，确认只靠令牌也能拦截
+			body := `{"path": "csrf-` + strings.ReplaceAll(tt.name, " ", "-") + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/file/mkdir", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(session)
+			if tt.token != "" {
+				req.Header.Set(middleware.CSRFHeaderName, tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			env.Engine.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	// 安全方法不需要CSRF令牌
+	req := httptest.NewRequest(http.MethodGet, "/api/file/list", nil)
+	req.AddCookie(session)
+	rec := httptest.NewRecorder()
+	env.Engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET without CSRF token: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBearerTokenIsExemptFromCSRF(t *testing.T) {
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := admin.JSON(http.MethodPost, "/api/user/tokens", map[string]any{
+		"name":   "ci",
+		"scopes": []string{"read", "write"},
+	})
+	resp, err := testenv.Decode(rec)
+	if err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("create token: %d %v %s", rec.Code, err, rec.Body)
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.Token == "" {
+		t.Fatalf("token missing from response: %s", resp.Data)
+	}
+
+	send := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/file/mkdir", strings.NewReader(`{"path": "bearer"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+data.Token)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		env.Engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(""); rec.Code != http.StatusOK {
+		t.Fatalf("bearer request without CSRF token: status = %d: %s", rec.Code, rec.Body)
+	}
+	// 来源检查对所有修改请求生效，与认证方式无关
+	if rec := send("https://evil.example.net"); rec.Code != http.StatusForbidden {
+		t.Fatalf("bearer request from foreign origin: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 游客访问模式
+const (
+	GuestModeOpen          = "open"          // 未设置规则的目录对游客公开
+	GuestModeAuthenticated = "authenticated" // 未设置规则的目录需要登录才能访问
+)
+
+var (
+	ErrInvalidGuestMode   = errors.New("invalid guest mode")
+	ErrAccessRuleNotFound = errors.New("access rule not found")
+)
+
+// AccessRule 目录的公开/私有设置，对目录及其所有子项生效，子目录可以单独设置覆盖
+type AccessRule struct {
+	Path      string    `json:"path"` // 相对上传目录，空字符串表示根目录
+	Public    bool      `json:"public"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type accessStore struct {
+	rules map[string]*AccessRule // 路径 -> 规则
+	mu    sync.RWMutex
+}
+
+var access = &accessStore{
+	rules: make(map[string]*AccessRule),
+}
+
+// InitAccessStore 初始化游客访问规则
+func InitAccessStore() error {
+	if !validGuestMode(config.GetConfig().Access.GuestMode) {
+		return ErrInvalidGuestMode
+	}
+	return loadAccessRulesFromFile()
+}
+
+// GuestMode 获取当前的游客访问模式
+func GuestMode() string {
+	return config.GetConfig().Access.GuestMode
+}
+
+// ListAccessRules 列出所有目录规则，按路径排序
+func ListAccessRules() []AccessRule {
+	access.mu.RLock()
+	defer access.mu.RUnlock()
+
+	list := make([]AccessRule, 0, len(access.rules))
+	for _, rule := range access.rules {
+		list = append(list, *rule)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// SetAccessRule 设置目录对游客公开或私有
+func SetAccessRule(p string, public bool, updatedBy string) (AccessRule, error) {
+	rule := &AccessRule{
+		Path:      accessPath(p),
+		Public:    public,
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now(),
+	}
+
+	access.mu.Lock()
+	defer access.mu.Unlock()
+
+	old, existed := access.rules[rule.Path]
+	access.rules[rule.Path] = rule
+	if err := saveAccessRulesToFile(); err != nil {
+		if existed {
+			access.rules[rule.Path] = old
+		} else {
+			delete(access.rules, rule.Path)
+		}
+		return AccessRule{}, err
+	}
+	return *rule, nil
+}
+
+// DeleteAccessRule 删除目录规则，目录恢复继承上级目录的设置
+func DeleteAccessRule(p string) error {
+	p = accessPath(p)
+
+	access.mu.Lock()
+	defer access.mu.Unlock()
+
+	rule, ok := access.rules[p]
+	if !ok {
+		return ErrAccessRuleNotFound
+	}
+	delete(access.rules, p)
+	if err := saveAccessRulesToFile(); err != nil {
+		access.rules[p] = rule
+		return err
+	}
+	return nil
+}
+
+// MoveAccessRules 文件或目录重命名、移动后，让规则跟随到新路径
+// 否则私有目录改名后会变成继承上级目录的公开设置
+func MoveAccessRules(oldPath, newPath string) error {
+	oldPath, newPath = accessPath(oldPath), accessPath(newPath)
+	if oldPath == "" || oldPath == newPath {
+		return nil
+	}
+
+	access.mu.Lock()
+	defer access.mu.Unlock()
+
+	var moved []*AccessRule
+	for p, rule := range access.rules {
+		if accessWithin(oldPath, p) {
+			delete(access.rules, p)
+			moved = append(moved, rule)
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	for _, rule := range moved {
+		rule.Path = newPath + strings.TrimPrefix(rule.Path, oldPath)
+		access.rules[rule.Path] = rule
+	}
+	return saveAccessRulesToFile()
+}
+
+// GuestCanRead 游客能否读取该路径，取最近的上级目录规则，没有规则时由全局模式决定
+func GuestCanRead(p string) bool {
+	access.mu.RLock()
+	defer access.mu.RUnlock()
+	return guestCanRead(accessPath(p))
+}
+
+// GuestCanBrowse 游客能否列出该目录：目录本身公开，或者其下有公开的子目录（只显示通往公开目录的路径）
+func GuestCanBrowse(p string) bool {
+	p = accessPath(p)
+
+	access.mu.RLock()
+	defer access.mu.RUnlock()
+
+	if guestCanRead(p) {
+		return true
+	}
+	for rp, rule := range access.rules {
+		if rule.Public && rp != p && accessWithin(p, rp) {
+			return true
+		}
+	}
+	return false
+}
+
+// GuestCanReadTree 游客能否读取该路径下的全部内容，用于打包下载目录
+func GuestCanReadTree(p string) bool {
+	p = accessPath(p)
+
+	access.mu.RLock()
+	defer access.mu.RUnlock()
+
+	if !guestCanRead(p) {
+		return false
+	}
+	for rp, rule := range access.rules {
+		if !rule.Public && accessWithin(p, rp) {
+			return false
+		}
+	}
+	return true
+}
+
+// guestCanRead 调用方需持有锁
+func guestCanRead(p string) bool {
+	for {
+		if rule, ok := access.rules[p]; ok {
+			return rule.Public
+		}
+		if p == "" {
+			return GuestMode() == GuestModeOpen
+		}
+		p = parentAccessPath(p)
+	}
+}
+
+// accessPath 将路径统一为不带首尾斜杠的相对路径
+func accessPath(p string) string {
+	return strings.Trim(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/")
+}
+
+// parentAccessPath 获取上级目录，根目录的上级仍为根目录
+func parentAccessPath(p string) string {
+	parent := path.Dir(p)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+// accessWithin 判断p是否为base本身或位于base之下
+func accessWithin(base, p string) bool {
+	return base == "" || p == base || strings.HasPrefix(p, base+"/")
+}
+
+// validGuestMode 检查游客访问模式是否合法
+func validGuestMode(mode string) bool {
+	return mode == GuestModeOpen || mode == GuestModeAuthenticated
+}
+
+// 保存访问规则到文件，调用方需持有锁
+func saveAccessRulesToFile() error {
+	file := config.GetConfig().Access.DataFile
+	if file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(access.rules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+// 从文件加载访问规则
+func loadAccessRulesFromFile() error {
+	file := config.GetConfig().Access.DataFile
+	if file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	access.mu.Lock()
+	defer access.mu.Unlock()
+
+	return json.Unmarshal(data, &access.rules)
+}
@@ -0,0 +1,429 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 目录权限
+const (
+	PermRead   = "read"   // 浏览、下载、预览
+	PermWrite  = "write"  // 上传、新建文件夹、重命名、恢复版本
+	PermDelete = "delete" // 删除、移出
+	PermShare  = "share"  // 创建分享链接
+)
+
+// ACL主体：user:用户名、group:组名，或*表示所有登录用户
+const (
+	SubjectEveryone    = "*"
+	subjectUserPrefix  = "user:"
+	subjectGroupPrefix = "group:"
+)
+
+// allPermissions 权限的规范顺序
+var allPermissions = []string{PermRead, PermWrite, PermDelete, PermShare}
+
+var (
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrInvalidSubject    = errors.New("invalid acl subject")
+	ErrACLEntryNotFound  = errors.New("acl entry not found")
+)
+
+// ACLEntry 目录上授予某个主体的权限，对目录及其所有子项生效
+// 判断权限时从目标路径逐级向上查找，在第一个有匹配条目的目录上确定权限：
+// 同一目录上用户条目优先于用户组条目（多个用户组取并集），用户组条目优先于*条目
+type ACLEntry struct {
+	Path        string    `json:"path"` // 相对上传目录，空字符串表示根目录
+	Subject     string    `json:"subject"`
+	Permissions []string  `json:"permissions"` // 为空表示禁止访问
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type aclStore struct {
+	entries map[string]map[string]*ACLEntry // 路径 -> 主体 -> 条目
+	mu      sync.RWMutex
+}
+
+var acl = &aclStore{
+	entries: make(map[string]map[string]*ACLEntry),
+}
+
+// InitACLStore 初始化目录权限
+func InitACLStore() error {
+	if _, err := normalizePermissions(config.GetConfig().ACL.DefaultPermissions); err != nil {
+		return err
+	}
+	return loadACLFromFile()
+}
+
+// ListACLEntries 列出所有权限条目，按路径和主体排序
+func ListACLEntries() []ACLEntry {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	list := []ACLEntry{}
+	for _, level := range acl.entries {
+		for _, entry := range level {
+			list = append(list, copyACLEntry(entry))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Subject < list[j].Subject
+	})
+	return list
+}
+
+// SetACLEntry 设置目录上某个主体的权限，permissions为空表示禁止访问
+func SetACLEntry(p, subject string, permissions []string, updatedBy string) (ACLEntry, error) {
+	if err := validSubject(subject); err != nil {
+		return ACLEntry{}, err
+	}
+	permissions, err := normalizePermissions(permissions)
+	if err != nil {
+		return ACLEntry{}, err
+	}
+
+	entry := &ACLEntry{
+		Path:        accessPath(p),
+		Subject:     subject,
+		Permissions: permissions,
+		UpdatedBy:   updatedBy,
+		UpdatedAt:   time.Now(),
+	}
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	level, ok := acl.entries[entry.Path]
+	if !ok {
+		level = make(map[string]*ACLEntry)
+		acl.entries[entry.Path] = level
+	}
+	old, existed := level[subject]
+	level[subject] = entry
+	if err := saveACLToFile(); err != nil {
+		if existed {
+			level[subject] = old
+		} else {
+			removeACLEntry(entry.Path, subject)
+		}
+		return ACLEntry{}, err
+	}
+	return copyACLEntry(entry), nil
+}
+
+// DeleteACLEntry 删除权限条目，该主体恢复继承上级目录的权限
+func DeleteACLEntry(p, subject string) error {
+	p = accessPath(p)
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	entry, ok := acl.entries[p][subject]
+	if !ok {
+		return ErrACLEntryNotFound
+	}
+	removeACLEntry(p, subject)
+	if err := saveACLToFile(); err != nil {
+		if acl.entries[p] == nil {
+			acl.entries[p] = make(map[string]*ACLEntry)
+		}
+		acl.entries[p][subject] = entry
+		return err
+	}
+	return nil
+}
+
+// RemoveACLSubject 删除某个主体的所有权限条目，删除用户或用户组时调用
+func RemoveACLSubject(subject string) error {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	changed := false
+	for p, level := range acl.entries {
+		if _, ok := level[subject]; ok {
+			removeACLEntry(p, subject)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveACLToFile()
+}
+
+// MoveACLEntries 文件或目录重命名、移动后，让权限条目跟随到新路径
+func MoveACLEntries(oldPath, newPath string) error {
+	oldPath, newPath = accessPath(oldPath), accessPath(newPath)
+	if oldPath == "" || oldPath == newPath {
+		return nil
+	}
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	moved := make(map[string]map[string]*ACLEntry)
+	for p, level := range acl.entries {
+		if accessWithin(oldPath, p) {
+			delete(acl.entries, p)
+			moved[newPath+strings.TrimPrefix(p, oldPath)] = level
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	for p, level := range moved {
+		for _, entry := range level {
+			entry.Path = p
+		}
+		acl.entries[p] = level
+	}
+	return saveACLToFile()
+}
+
+// DefaultPermissions 没有任何匹配条目时登录用户拥有的权限
+func DefaultPermissions() []string {
+	return append([]string(nil), config.GetConfig().ACL.DefaultPermissions...)
+}
+
+// UserSubject 用户对应的ACL主体
+func UserSubject(username string) string {
+	return subjectUserPrefix + username
+}
+
+// GroupSubject 用户组对应的ACL主体
+func GroupSubject(name string) string {
+	return subjectGroupPrefix + name
+}
+
+// UserPermissions 获取用户对路径的有效权限，管理员拥有全部权限
+func UserPermissions(user User, p string) []string {
+	if user.Role == RoleAdmin {
+		return append([]string(nil), allPermissions...)
+	}
+	groupNames := UserGroups(user.Username)
+
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+	return append([]string{}, effectivePermissions(user.Username, groupNames, accessPath(p))...)
+}
+
+// HasPermission 检查用户对路径是否有指定权限
+func HasPermission(user User, p, perm string) bool {
+	return containsPermission(UserPermissions(user, p), perm)
+}
+
+// HasTreePermission 检查用户对路径及其下所有子项是否都有指定权限，用于删除、移动和打包下载目录
+func HasTreePermission(user User, p, perm string) bool {
+	if user.Role == RoleAdmin {
+		return true
+	}
+	groupNames := UserGroups(user.Username)
+	p = accessPath(p)
+
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if !containsPermission(effectivePermissions(user.Username, groupNames, p), perm) {
+		return false
+	}
+	for sub := range acl.entries {
+		if sub != p && accessWithin(p, sub) && !containsPermission(effectivePermissions(user.Username, groupNames, sub), perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanBrowse 检查用户能否列出目录：有读取权限，或者其下有可以读取的子目录
+func CanBrowse(user User, p string) bool {
+	if user.Role == RoleAdmin {
+		return true
+	}
+	groupNames := UserGroups(user.Username)
+	p = accessPath(p)
+
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	if containsPermission(effectivePermissions(user.Username, groupNames, p), PermRead) {
+		return true
+	}
+	for sub := range acl.entries {
+		if sub != p && accessWithin(p, sub) && containsPermission(effectivePermissions(user.Username, groupNames, sub), PermRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectivePermissions 从p开始逐级向上查找匹配的条目，都没有时使用默认权限，调用方需持有锁
+func effectivePermissions(username string, groupNames []string, p string) []string {
+	for {
+		if permissions, ok := matchACLLevel(acl.entries[p], username, groupNames); ok {
+			return permissions
+		}
+		if p == "" {
+			return config.GetConfig().ACL.DefaultPermissions
+		}
+		p = parentAccessPath(p)
+	}
+}
+
+// matchACLLevel 在同一目录的条目中查找与用户匹配的权限
+func matchACLLevel(level map[string]*ACLEntry, username string, groupNames []string) ([]string, bool) {
+	if len(level) == 0 {
+		return nil, false
+	}
+	if entry, ok := level[UserSubject(username)]; ok {
+		return entry.Permissions, true
+	}
+
+	var union []string
+	matched := false
+	for _, name := range groupNames {
+		if entry, ok := level[GroupSubject(name)]; ok {
+			union = append(union, entry.Permissions...)
+			matched = true
+		}
+	}
+	if matched {
+		return union, true
+	}
+
+	if entry, ok := level[SubjectEveryone]; ok {
+		return entry.Permissions, true
+	}
+	return nil, false
+}
+
+// removeACLEntry 删除条目，目录上没有条目时一并删除，调用方需持有锁
+func removeACLEntry(p, subject string) {
+	delete(acl.entries[p], subject)
+	if len(acl.entries[p]) == 0 {
+		delete(acl.entries, p)
+	}
+}
+
+// validSubject 检查主体格式，用户和用户组必须存在
+func validSubject(subject string) error {
+	switch {
+	case subject == SubjectEveryone:
+		return nil
+	case strings.HasPrefix(subject, subjectUserPrefix):
+		_, err := GetUser(strings.TrimPrefix(subject, subjectUserPrefix))
+		return err
+	case strings.HasPrefix(subject, subjectGroupPrefix):
+		_, err := GetGroup(strings.TrimPrefix(subject, subjectGroupPrefix))
+		return err
+	default:
+		return ErrInvalidSubject
+	}
+}
+
+// normalizePermissions 检查权限名称，去重后按规范顺序排列
+func normalizePermissions(permissions []string) ([]string, error) {
+	for _, perm := range permissions {
+		if !containsPermission(allPermissions, perm) {
+			return nil, ErrInvalidPermission
+		}
+	}
+	list := make([]string, 0, len(allPermissions))
+	for _, perm := range allPermissions {
+		if containsPermission(permissions, perm) {
+			list = append(list, perm)
+		}
+	}
+	return list, nil
+}
+
+// containsPermission 检查权限列表中是否包含指定权限
+func containsPermission(permissions []string, perm string) bool {
+	for _, p := range permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// copyACLEntry 复制条目，避免调用方修改存储中的权限列表
+func copyACLEntry(entry *ACLEntry) ACLEntry {
+	e := *entry
+	e.Permissions = append([]string{}, entry.Permissions...)
+	return e
+}
+
+// 保存权限数据到文件，调用方需持有锁
+func saveACLToFile() error {
+	path := config.GetConfig().ACL.DataFile
+	if path == "" {
+		return nil
+	}
+
+	list := make([]*ACLEntry, 0, len(acl.entries))
+	for _, level := range acl.entries {
+		for _, entry := range level {
+			list = append(list, entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Subject < list[j].Subject
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载权限数据
+func loadACLFromFile() error {
+	path := config.GetConfig().ACL.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var list []*ACLEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	for _, entry := range list {
+		if acl.entries[entry.Path] == nil {
+			acl.entries[entry.Path] = make(map[string]*ACLEntry)
+		}
+		acl.entries[entry.Path][entry.Subject] = entry
+	}
+	return nil
+}
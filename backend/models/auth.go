@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"sync"
+)
+
+// 本地用户认证后端的名称
+const AuthenticatorLocal = "local"
+
+var ErrAuthUnavailable = errors.New("authentication backend unavailable")
+
+// Authenticator 用户名密码认证后端，认证通过后返回对应的本地用户
+// 后端中没有该用户时返回ErrUserNotFound，由下一个后端处理；后端暂时不可用时返回包装了ErrAuthUnavailable的错误
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (User, error)
+}
+
+var (
+	// authenticators 按顺序尝试的认证后端，本地用户始终在最后
+	authenticators   = []Authenticator{localAuthenticator{}}
+	authenticatorsMu sync.RWMutex
+)
+
+// RegisterAuthenticator 添加认证后端，排在已注册的后端之后、本地用户之前
+func RegisterAuthenticator(a Authenticator) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+
+	n := len(authenticators)
+	authenticators = append(authenticators[:n-1:n-1], a, authenticators[n-1])
+}
+
+// AuthenticateUser 依次尝试各认证后端校验用户名和密码，返回用户和认证通过的后端名称
+// 前面的后端不可用且后面的后端都认证失败时返回不可用错误，而不是用户名或密码错误
+func AuthenticateUser(username, password string) (User, string, error) {
+	authenticatorsMu.RLock()
+	list := authenticators
+	authenticatorsMu.RUnlock()
+
+	var unavailable error
+	for _, a := range list {
+		user, err := a.Authenticate(username, password)
+		switch {
+		case err == nil:
+			return user, a.Name(), nil
+		case errors.Is(err, ErrUserNotFound):
+			continue
+		case errors.Is(err, ErrAuthUnavailable):
+			unavailable = err
+			continue
+		case errors.Is(err, ErrInvalidCredentials) && unavailable != nil:
+			return User{}, "", unavailable
+		default:
+			return User{}, "", err
+		}
+	}
+	if unavailable != nil {
+		return User{}, "", unavailable
+	}
+	return User{}, "", ErrInvalidCredentials
+}
+
+// VerifyPassword 校验已登录用户的密码（修改安全设置前确认身份），LDAP用户由LDAP校验
+func VerifyPassword(username, password string) error {
+	var user User
+	var err error
+	if config.GetConfig().LDAP.Enabled && IsLDAPUser(username) {
+		user, err = ldapAuthenticator{}.Authenticate(username, password)
+	} else {
+		user, err = Authenticate(username, password)
+	}
+	if err != nil {
+		return err
+	}
+	if user.Username != username {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// localAuthenticator 校验本地保存的密码哈希
+type localAuthenticator struct{}
+
+func (localAuthenticator) Name() string {
+	return AuthenticatorLocal
+}
+
+func (localAuthenticator) Authenticate(username, password string) (User, error) {
+	return Authenticate(username, password)
+}
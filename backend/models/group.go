@@ -0,0 +1,242 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupExists      = errors.New("group already exists")
+	ErrInvalidGroupName = errors.New("invalid group name")
+)
+
+// Group 用户组，用于批量授予目录权限
+type Group struct {
+	Name      string    `json:"name"`
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type groupStore struct {
+	groups map[string]*Group
+	mu     sync.RWMutex
+}
+
+var groups = &groupStore{
+	groups: make(map[string]*Group),
+}
+
+// InitGroupStore 初始化用户组存储
+func InitGroupStore() error {
+	return loadGroupsFromFile()
+}
+
+// ListGroups 列出所有用户组，按名称排序
+func ListGroups() []Group {
+	groups.mu.RLock()
+	defer groups.mu.RUnlock()
+
+	list := make([]Group, 0, len(groups.groups))
+	for _, group := range groups.groups {
+		list = append(list, copyGroup(group))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// GetGroup 获取用户组
+func GetGroup(name string) (Group, error) {
+	groups.mu.RLock()
+	defer groups.mu.RUnlock()
+
+	group, ok := groups.groups[name]
+	if !ok {
+		return Group{}, ErrGroupNotFound
+	}
+	return copyGroup(group), nil
+}
+
+// CreateGroup 创建用户组，成员必须是已存在的用户
+func CreateGroup(name string, members []string) (Group, error) {
+	name = strings.TrimSpace(name)
+	if !validUsername(name) {
+		return Group{}, ErrInvalidGroupName
+	}
+	members, err := normalizeMembers(members)
+	if err != nil {
+		return Group{}, err
+	}
+
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	if _, ok := groups.groups[name]; ok {
+		return Group{}, ErrGroupExists
+	}
+
+	group := &Group{
+		Name:      name,
+		Members:   members,
+		CreatedAt: time.Now(),
+	}
+	groups.groups[name] = group
+	if err := saveGroupsToFile(); err != nil {
+		delete(groups.groups, name)
+		return Group{}, err
+	}
+	return copyGroup(group), nil
+}
+
+// SetGroupMembers 替换用户组的成员列表
+func SetGroupMembers(name string, members []string) (Group, error) {
+	members, err := normalizeMembers(members)
+	if err != nil {
+		return Group{}, err
+	}
+
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	group, ok := groups.groups[name]
+	if !ok {
+		return Group{}, ErrGroupNotFound
+	}
+	old := group.Members
+	group.Members = members
+	if err := saveGroupsToFile(); err != nil {
+		group.Members = old
+		return Group{}, err
+	}
+	return copyGroup(group), nil
+}
+
+// DeleteGroup 删除用户组
+func DeleteGroup(name string) error {
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	group, ok := groups.groups[name]
+	if !ok {
+		return ErrGroupNotFound
+	}
+	delete(groups.groups, name)
+	if err := saveGroupsToFile(); err != nil {
+		groups.groups[name] = group
+		return err
+	}
+	return nil
+}
+
+// RemoveGroupMember 从所有用户组中移除用户，删除用户时调用
+func RemoveGroupMember(username string) error {
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	changed := false
+	for _, group := range groups.groups {
+		for i, member := range group.Members {
+			if member == username {
+				group.Members = append(group.Members[:i:i], group.Members[i+1:]...)
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveGroupsToFile()
+}
+
+// UserGroups 获取用户所属的用户组名称
+func UserGroups(username string) []string {
+	groups.mu.RLock()
+	defer groups.mu.RUnlock()
+
+	var names []string
+	for _, group := range groups.groups {
+		for _, member := range group.Members {
+			if member == username {
+				names = append(names, group.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeMembers 去重并检查成员是否为已存在的用户
+func normalizeMembers(members []string) ([]string, error) {
+	seen := make(map[string]bool)
+	list := make([]string, 0, len(members))
+	for _, member := range members {
+		member = strings.TrimSpace(member)
+		if seen[member] {
+			continue
+		}
+		if _, err := GetUser(member); err != nil {
+			return nil, err
+		}
+		seen[member] = true
+		list = append(list, member)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// copyGroup 复制用户组，避免调用方修改存储中的成员列表
+func copyGroup(group *Group) Group {
+	g := *group
+	g.Members = append([]string{}, group.Members...)
+	return g
+}
+
+// 保存用户组数据到文件，调用方需持有锁
+func saveGroupsToFile() error {
+	path := config.GetConfig().ACL.GroupFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(groups.groups, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载用户组数据
+func loadGroupsFromFile() error {
+	path := config.GetConfig().ACL.GroupFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	return json.Unmarshal(data, &groups.groups)
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExternalUserConflict   = errors.New("a local user with the same name already exists")
+	ErrExternalNotProvisioned = errors.New("no local user for this external account")
+)
+
+// Identity 外部账号（单点登录的issuer+sub，或LDAP服务器+DN）与本地用户的关联
+type Identity struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// externalAccount 外部认证来源返回的账号信息和该来源的开通策略
+type externalAccount struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	Role          string
+	AutoProvision bool
+	LinkExisting  bool
+}
+
+type identityStore struct {
+	identities map[string]*Identity // issuer|subject -> 关联
+	dataFile   func() string
+	mu         sync.Mutex
+}
+
+var (
+	oidcIdentities = newIdentityStore(func() string { return config.GetConfig().OIDC.DataFile })
+	ldapIdentities = newIdentityStore(func() string { return config.GetConfig().LDAP.DataFile })
+)
+
+func newIdentityStore(dataFile func() string) *identityStore {
+	return &identityStore{
+		identities: make(map[string]*Identity),
+		dataFile:   dataFile,
+	}
+}
+
+// ResolveOIDCUser 查找或创建单点登录账号对应的本地用户，并按组声明同步角色，返回用户和是否为新建
+func ResolveOIDCUser(claims OIDCClaims) (User, bool, error) {
+	cfg := config.GetConfig().OIDC
+	return oidcIdentities.resolve(externalAccount{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Username:      claims.Username,
+		Email:         claims.Email,
+		Role:          OIDCRole(claims.Groups),
+		AutoProvision: cfg.AutoProvision,
+		LinkExisting:  cfg.LinkExistingUsers,
+	})
+}
+
+// mapGroupRole 外部账号属于管理员组时为管理员，属于编辑者组时为编辑者，否则为默认角色
+func mapGroupRole(groups, adminGroups, editorGroups []string, defaultRole string, match func(group, configured string) bool) string {
+	inAny := func(configured []string) bool {
+		for _, c := range configured {
+			for _, group := range groups {
+				if match(group, c) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	switch {
+	case inAny(adminGroups):
+		return RoleAdmin
+	case inAny(editorGroups):
+		return RoleEditor
+	case validRole(defaultRole):
+		return defaultRole
+	default:
+		return RoleViewer
+	}
+}
+
+// resolve 查找或创建外部账号对应的本地用户并同步角色，返回用户和是否为新建
+// 已关联的账号始终登录到原来的本地用户，即使外部的用户名发生了变化
+func (s *identityStore) resolve(account externalAccount) (User, bool, error) {
+	key := account.Issuer + "|" + account.Subject
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, linked := s.identities[key]
+	if linked {
+		if _, err := GetUser(identity.Username); err != nil {
+			linked = false
+		}
+	}
+
+	created := false
+	if !linked {
+		username := strings.TrimSpace(account.Username)
+		if !validUsername(username) {
+			return User{}, false, ErrInvalidUsername
+		}
+		if _, err := GetUser(username); err == nil {
+			if !account.LinkExisting {
+				return User{}, false, ErrExternalUserConflict
+			}
+		} else {
+			if !account.AutoProvision {
+				return User{}, false, ErrExternalNotProvisioned
+			}
+			password, err := randomPassword()
+			if err != nil {
+				return User{}, false, err
+			}
+			if _, err := CreateUser(username, password, account.Role); err != nil {
+				return User{}, false, err
+			}
+			created = true
+		}
+		identity = &Identity{
+			Issuer:    account.Issuer,
+			Subject:   account.Subject,
+			Username:  username,
+			CreatedAt: time.Now(),
+		}
+		s.identities[key] = identity
+	}
+
+	// 角色以外部来源为准，不会降级最后一个管理员
+	if err := SetUserRole(identity.Username, account.Role); err != nil && err != ErrLastAdmin {
+		return User{}, false, err
+	}
+
+	identity.Email = account.Email
+	identity.LastLoginAt = time.Now()
+	if err := s.saveToFile(); err != nil {
+		return User{}, false, err
+	}
+
+	user, err := GetUser(identity.Username)
+	return user, created, err
+}
+
+// shadowed 外部账号尚未关联，但已存在同名的本地用户且不允许关联已有用户
+func (s *identityStore) shadowed(account externalAccount) bool {
+	s.mu.Lock()
+	identity, ok := s.identities[account.Issuer+"|"+account.Subject]
+	s.mu.Unlock()
+
+	if ok {
+		if _, err := GetUser(identity.Username); err == nil {
+			return false
+		}
+	}
+	if account.LinkExisting {
+		return false
+	}
+	_, err := GetUser(strings.TrimSpace(account.Username))
+	return err == nil
+}
+
+// linked 用户是否关联了该来源的外部账号
+func (s *identityStore) linked(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, identity := range s.identities {
+		if identity.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveUserIdentities 删除用户的所有外部账号关联，删除用户时调用
+func RemoveUserIdentities(username string) error {
+	for _, s := range []*identityStore{oidcIdentities, ldapIdentities} {
+		if err := s.remove(username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *identityStore) remove(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for key, identity := range s.identities {
+		if identity.Username == username {
+			delete(s.identities, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.saveToFile()
+}
+
+// 保存账号关联到文件，调用方需持有锁
+func (s *identityStore) saveToFile() error {
+	path := s.dataFile()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.identities, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载账号关联
+func (s *identityStore) loadFromFile() error {
+	path := s.dataFile()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.Unmarshal(data, &s.identities)
+}
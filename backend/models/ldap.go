@@ -0,0 +1,221 @@
+package models
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/ldap"
+	"strings"
+	"time"
+)
+
+// LDAP认证后端的名称
+const AuthenticatorLDAP = "ldap"
+
+var ErrLDAPConfig = errors.New("invalid ldap configuration")
+
+// InitLDAP 检查LDAP配置、加载账号关联，启用时注册为认证后端，服务器暂时不可用不影响启动
+func InitLDAP() error {
+	cfg := config.GetConfig().LDAP
+	if cfg.Enabled {
+		if cfg.URL == "" || cfg.BaseDN == "" || cfg.UserFilter == "" || cfg.UsernameAttribute == "" {
+			return fmt.Errorf("%w: url、base_dn、user_filter和username_attribute不能为空", ErrLDAPConfig)
+		}
+		if !strings.HasPrefix(cfg.URL, "ldap://") && !strings.HasPrefix(cfg.URL, "ldaps://") {
+			return fmt.Errorf("%w: url应以ldap://或ldaps://开头", ErrLDAPConfig)
+		}
+		if !validRole(cfg.DefaultRole) {
+			return fmt.Errorf("%w: default_role应为admin、editor或viewer", ErrLDAPConfig)
+		}
+		if err := ldap.ValidateFilter(strings.ReplaceAll(cfg.UserFilter, "{username}", "x")); err != nil {
+			return fmt.Errorf("%w: user_filter: %v", ErrLDAPConfig, err)
+		}
+		if cfg.GroupBaseDN != "" {
+			filter := strings.NewReplacer("{dn}", "x", "{username}", "x").Replace(cfg.GroupFilter)
+			if err := ldap.ValidateFilter(filter); err != nil {
+				return fmt.Errorf("%w: group_filter: %v", ErrLDAPConfig, err)
+			}
+		}
+	}
+
+	if err := ldapIdentities.loadFromFile(); err != nil {
+		return err
+	}
+	if cfg.Enabled {
+		RegisterAuthenticator(ldapAuthenticator{})
+	}
+	return nil
+}
+
+// IsLDAPUser 用户是否关联了LDAP账号，这类用户的密码由LDAP管理
+func IsLDAPUser(username string) bool {
+	return ldapIdentities.linked(username)
+}
+
+// LDAPRole 按admin_groups和editor_groups把LDAP组映射为角色，组可以用DN或组名配置
+func LDAPRole(groups []string) string {
+	cfg := config.GetConfig().LDAP
+	return mapGroupRole(groups, cfg.AdminGroups, cfg.EditorGroups, cfg.DefaultRole, func(group, configured string) bool {
+		return strings.EqualFold(group, configured) || strings.EqualFold(rdnValue(group), configured)
+	})
+}
+
+// ldapAuthenticator 用服务账号查找用户条目，再以用户DN和密码绑定校验密码
+type ldapAuthenticator struct{}
+
+func (ldapAuthenticator) Name() string {
+	return AuthenticatorLDAP
+}
+
+func (ldapAuthenticator) Authenticate(username, password string) (User, error) {
+	cfg := config.GetConfig().LDAP
+	// 空密码会变成“未认证绑定”，部分服务器会直接返回成功
+	if password == "" {
+		return User{}, ErrInvalidCredentials
+	}
+
+	conn, err := dialLDAP(cfg)
+	if err != nil {
+		return User{}, err
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return User{}, fmt.Errorf("%w: 服务账号绑定失败: %v", ErrAuthUnavailable, err)
+	}
+
+	attributes := []string{cfg.UsernameAttribute}
+	for _, attr := range []string{cfg.EmailAttribute, cfg.GroupAttribute} {
+		if attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	entries, err := conn.Search(ldap.SearchRequest{
+		BaseDN:     cfg.BaseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     strings.ReplaceAll(cfg.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		Attributes: attributes,
+		SizeLimit:  2,
+	})
+	if err != nil && !ldap.IsResultCode(err, ldap.ResultSizeLimitExceeded) {
+		if ldap.IsResultCode(err, ldap.ResultNoSuchObject) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("%w: 查找用户失败: %v", ErrAuthUnavailable, err)
+	}
+	if len(entries) == 0 {
+		return User{}, ErrUserNotFound
+	}
+	if len(entries) > 1 {
+		return User{}, fmt.Errorf("%w: user_filter匹配到多个条目", ErrInvalidCredentials)
+	}
+	entry := entries[0]
+
+	account := externalAccount{
+		Issuer:        cfg.URL,
+		Subject:       strings.ToLower(entry.DN),
+		Username:      entry.GetAttributeValue(cfg.UsernameAttribute),
+		AutoProvision: cfg.AutoProvision,
+		LinkExisting:  cfg.LinkExistingUsers,
+	}
+	if account.Username == "" {
+		account.Username = username
+	}
+	if cfg.EmailAttribute != "" {
+		account.Email = entry.GetAttributeValue(cfg.EmailAttribute)
+	}
+	// 同名的本地用户不归LDAP管理，交给本地认证，避免目录中的同名账号接管本地用户
+	if ldapIdentities.shadowed(account) {
+		return User{}, ErrUserNotFound
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsResultCode(err, ldap.ResultInvalidCredentials) {
+			return User{}, ErrInvalidCredentials
+		}
+		return User{}, fmt.Errorf("%w: 用户绑定失败: %v", ErrAuthUnavailable, err)
+	}
+
+	var groups []string
+	if cfg.GroupAttribute != "" {
+		groups = entry.GetAttributeValues(cfg.GroupAttribute)
+	}
+	if cfg.GroupBaseDN != "" {
+		found, err := searchLDAPGroups(conn, cfg, entry.DN, account.Username)
+		if err != nil {
+			return User{}, fmt.Errorf("%w: 查找用户组失败: %v", ErrAuthUnavailable, err)
+		}
+		groups = append(groups, found...)
+	}
+	account.Role = LDAPRole(groups)
+
+	user, _, err := ldapIdentities.resolve(account)
+	if err != nil {
+		return User{}, err
+	}
+	if user.Disabled {
+		return User{}, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// searchLDAPGroups 用服务账号重新绑定后按group_filter搜索用户所属的组，返回组DN和组名
+func searchLDAPGroups(conn *ldap.Conn, cfg config.LDAPConfig, dn, username string) ([]string, error) {
+	if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return nil, err
+	}
+
+	filter := strings.NewReplacer(
+		"{dn}", ldap.EscapeFilter(dn),
+		"{username}", ldap.EscapeFilter(username),
+	).Replace(cfg.GroupFilter)
+	entries, err := conn.Search(ldap.SearchRequest{
+		BaseDN:     cfg.GroupBaseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     filter,
+		Attributes: []string{cfg.GroupNameAttribute},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+	for _, entry := range entries {
+		groups = append(groups, entry.DN)
+		if cfg.GroupNameAttribute != "" {
+			groups = append(groups, entry.GetAttributeValues(cfg.GroupNameAttribute)...)
+		}
+	}
+	return groups, nil
+}
+
+// dialLDAP 连接LDAP服务器，配置了start_tls时升级为TLS
+func dialLDAP(cfg config.LDAPConfig) (*ldap.Conn, error) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	conn, err := ldap.Dial(cfg.URL, timeout, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 连接LDAP服务器失败: %v", ErrAuthUnavailable, err)
+	}
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: StartTLS失败: %v", ErrAuthUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// rdnValue 取DN第一个RDN的值，如cn=admins,ou=groups,dc=example,dc=com返回admins
+func rdnValue(dn string) string {
+	rdn := strings.SplitN(dn, ",", 2)[0]
+	if i := strings.IndexByte(rdn, '='); i >= 0 {
+		return strings.TrimSpace(rdn[i+1:])
+	}
+	return rdn
+}
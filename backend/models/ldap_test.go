@@ -0,0 +1,126 @@
+package models_test
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/ldap"
+	"gin_cloud_drive/backend/models"
+	"log"
+	"net/http"
+	"testing"
+)
+
+// startLDAPServer 启动内存中的LDAP目录，按memberOf或组条目的member属性表示用户所属的组：
+// ldap_alice属于admins，ldap_bob属于Staff，ldap_carol是editors组条目的成员，ldap_dave不属于任何组
+func startLDAPServer() *ldap.Server {
+	server := ldap.NewServer()
+	server.AddEntry("cn=svc,dc=example,dc=com", map[string][]string{"cn": {"svc"}}, "svc-password")
+
+	users := []struct {
+		uid      string
+		memberOf []string
+	}{
+		{"ldap_alice", []string{"cn=admins,ou=groups,dc=example,dc=com"}},
+		{"ldap_bob", []string{"cn=Staff,ou=groups,dc=example,dc=com"}},
+		{"ldap_carol", nil},
+		{"ldap_dave", nil},
+	}
+	for _, u := range users {
+		attributes := map[string][]string{"uid": {u.uid}, "mail": {u.uid + "@example.com"}}
+		if u.memberOf != nil {
+			attributes["memberOf"] = u.memberOf
+		}
+		server.AddEntry("uid="+u.uid+",ou=people,dc=example,dc=com", attributes, u.uid+"-password")
+	}
+	server.AddEntry("cn=editors,ou=groups,dc=example,dc=com", map[string][]string{
+		"cn":     {"editors"},
+		"member": {"uid=ldap_carol,ou=people,dc=example,dc=com"},
+	}, "")
+
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		log.Fatal(err)
+	}
+	return server
+}
+
+// configureLDAP 启用LDAP登录：admins组为管理员，Staff组（按DN配置）和editors组为编辑者，其余为只读
+func configureLDAP(cfg *config.Config, server *ldap.Server) {
+	cfg.LDAP.Enabled = true
+	cfg.LDAP.URL = server.URL()
+	cfg.LDAP.BindDN = "cn=svc,dc=example,dc=com"
+	cfg.LDAP.BindPassword = "svc-password"
+	cfg.LDAP.BaseDN = "ou=people,dc=example,dc=com"
+	cfg.LDAP.GroupBaseDN = "ou=groups,dc=example,dc=com"
+	cfg.LDAP.AdminGroups = []string{"admins"}
+	cfg.LDAP.EditorGroups = []string{"cn=staff,ou=groups,dc=example,dc=com", "editors"}
+	cfg.LDAP.DefaultRole = models.RoleViewer
+}
+
+func TestLDAPLoginMapsGroupsToRoles(t *testing.T) {
+	tests := []struct {
+		username string
+		role     string
+	}{
+		{"ldap_alice", models.RoleAdmin},  // memberOf中的组名
+		{"ldap_bob", models.RoleEditor},   // memberOf中的组DN，大小写不敏感
+		{"ldap_carol", models.RoleEditor}, // 按group_filter搜索到的组
+		{"ldap_dave", models.RoleViewer},  // 默认角色
+	}
+
+	for _, tt := range tests {
+		user, backend, err := models.AuthenticateUser(tt.username, tt.username+"-password")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.username, err)
+		}
+		if backend != models.AuthenticatorLDAP || user.Username != tt.username || user.Role != tt.role {
+			t.Fatalf("%s: backend = %s, user = %s, role = %s, want role %s", tt.username, backend, user.Username, user.Role, tt.role)
+		}
+		if !models.IsLDAPUser(tt.username) {
+			t.Fatalf("%s is not linked to LDAP", tt.username)
+		}
+	}
+
+	// 通过登录接口登录
+	if _, err := env.Login("ldap_alice", "ldap_alice-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Login("ldap_alice", "ldap_bob-password"); err == nil {
+		t.Fatal("login with another user's password succeeded")
+	}
+}
+
+func TestLDAPFilterInjection(t *testing.T) {
+	// 用户名未经转义拼入过滤器时，这些用户名都能匹配到ldap_alice并以她的密码登录
+	for _, username := range []string{"ldap_ali*", "*alice", "*", "ldap_alice)(uid=*", "*)(|(uid=ldap_alice"} {
+		user, _, err := models.AuthenticateUser(username, "ldap_alice-password")
+		if !errors.Is(err, models.ErrInvalidCredentials) {
+			t.Fatalf("login as %q: user = %q, err = %v, want ErrInvalidCredentials", username, user.Username, err)
+		}
+	}
+}
+
+func TestLDAPRejectsEmptyPassword(t *testing.T) {
+	for _, username := range []string{"ldap_alice", "ldap_nobody"} {
+		if _, _, err := models.AuthenticateUser(username, ""); !errors.Is(err, models.ErrInvalidCredentials) {
+			t.Fatalf("%s with empty password: err = %v, want ErrInvalidCredentials", username, err)
+		}
+	}
+
+	// 空密码在连接服务器之前就被拒绝：即使服务器不可用也返回密码错误而不是服务不可用
+	cfg := &config.GetConfig().LDAP
+	url := cfg.URL
+	cfg.URL = "ldap://127.0.0.1:1"
+	defer func() { cfg.URL = url }()
+
+	if _, _, err := models.AuthenticateUser("ldap_alice", "ldap_alice-password"); !errors.Is(err, models.ErrAuthUnavailable) {
+		t.Fatalf("unreachable server: err = %v, want ErrAuthUnavailable", err)
+	}
+	if _, _, err := models.AuthenticateUser("ldap_alice", ""); !errors.Is(err, models.ErrInvalidCredentials) || errors.Is(err, models.ErrAuthUnavailable) {
+		t.Fatalf("empty password reached the server: err = %v", err)
+	}
+
+	rec := env.Client().JSON(http.MethodPost, "/api/auth/login", map[string]string{"username": "ldap_alice", "password": ""})
+	if rec.Code == http.StatusOK {
+		t.Fatalf("login with an empty password: status = %d", rec.Code)
+	}
+}
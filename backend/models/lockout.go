@@ -0,0 +1,219 @@
+package models
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 登录失败计数的维度
+const (
+	LockoutKindIP   = "ip"
+	LockoutKindUser = "user"
+)
+
+var (
+	ErrLoginThrottled     = errors.New("too many login attempts, retry later")
+	ErrLoginLocked        = errors.New("login temporarily locked")
+	ErrInvalidLockoutKind = errors.New("invalid lockout kind")
+	ErrLockoutNotFound    = errors.New("lockout not found")
+)
+
+// LoginAttempt 某个IP或用户名的登录失败记录，只保存在内存中
+type LoginAttempt struct {
+	Kind        string     `json:"kind"` // ip或user
+	Key         string     `json:"key"`  // IP地址或用户名
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	NextAllowed time.Time  `json:"next_allowed"`           // 指数退避，在此之前的登录请求直接拒绝
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // 失败次数达到上限后的锁定截止时间
+}
+
+// Locked 是否处于锁定状态
+func (a LoginAttempt) Locked() bool {
+	return a.LockedUntil != nil && time.Now().Before(*a.LockedUntil)
+}
+
+// LoginBlock 登录被拒绝的原因和需要等待的时间
+type LoginBlock struct {
+	Err        error
+	Kind       string
+	RetryAfter time.Duration
+}
+
+type lockoutStore struct {
+	attempts map[string]*LoginAttempt // kind:key -> 失败记录
+	mu       sync.Mutex
+}
+
+var lockouts = &lockoutStore{
+	attempts: make(map[string]*LoginAttempt),
+}
+
+// CheckLoginAllowed 登录前检查IP和用户名是否处于退避或锁定期，返回nil表示允许尝试
+func CheckLoginAllowed(ip, username string) *LoginBlock {
+	lockouts.mu.Lock()
+	defer lockouts.mu.Unlock()
+
+	now := time.Now()
+	var block *LoginBlock
+	for _, attempt := range []*LoginAttempt{lockouts.get(LockoutKindIP, ip, now), lockouts.get(LockoutKindUser, username, now)} {
+		if attempt == nil {
+			continue
+		}
+		var b *LoginBlock
+		switch {
+		case attempt.Locked():
+			b = &LoginBlock{Err: ErrLoginLocked, Kind: attempt.Kind, RetryAfter: attempt.LockedUntil.Sub(now)}
+		case now.Before(attempt.NextAllowed):
+			b = &LoginBlock{Err: ErrLoginThrottled, Kind: attempt.Kind, RetryAfter: attempt.NextAllowed.Sub(now)}
+		default:
+			continue
+		}
+		// 同时被限制时返回等待时间更长的
+		if block == nil || b.RetryAfter > block.RetryAfter {
+			block = b
+		}
+	}
+	return block
+}
+
+// RecordLoginFailure 记录一次登录失败（密码错误或两步验证码错误），计算退避时间，达到上限时锁定
+// 返回因本次失败而被锁定的记录
+func RecordLoginFailure(ip, username string) []LoginAttempt {
+	cfg := config.GetConfig().Login
+
+	lockouts.mu.Lock()
+	defer lockouts.mu.Unlock()
+
+	now := time.Now()
+	lockouts.prune(now)
+
+	var locked []LoginAttempt
+	for _, target := range []struct {
+		kind, key string
+		limit     int
+	}{
+		{LockoutKindIP, ip, cfg.IPMaxFailures},
+		{LockoutKindUser, username, cfg.MaxFailures},
+	} {
+		if target.key == "" {
+			continue
+		}
+		attempt := lockouts.get(target.kind, target.key, now)
+		if attempt == nil {
+			attempt = &LoginAttempt{Kind: target.kind, Key: target.key}
+			lockouts.attempts[lockoutKey(target.kind, target.key)] = attempt
+		}
+		attempt.Failures++
+		attempt.LastFailure = now
+		attempt.NextAllowed = now.Add(loginBackoff(attempt.Failures))
+		if target.limit > 0 && attempt.Failures >= target.limit && !attempt.Locked() {
+			until := now.Add(time.Duration(cfg.LockoutDuration) * time.Second)
+			attempt.LockedUntil = &until
+			locked = append(locked, *attempt)
+		}
+	}
+	return locked
+}
+
+// RecordLoginSuccess 登录成功后清零该用户名的失败次数，IP的失败次数按时间窗口自然清零
+func RecordLoginSuccess(username string) {
+	lockouts.mu.Lock()
+	defer lockouts.mu.Unlock()
+	delete(lockouts.attempts, lockoutKey(LockoutKindUser, username))
+}
+
+// ListLoginAttempts 列出仍在计数窗口或锁定期内的失败记录，锁定中的排在前面
+func ListLoginAttempts() []LoginAttempt {
+	lockouts.mu.Lock()
+	defer lockouts.mu.Unlock()
+
+	now := time.Now()
+	lockouts.prune(now)
+
+	list := make([]LoginAttempt, 0, len(lockouts.attempts))
+	for _, attempt := range lockouts.attempts {
+		list = append(list, *attempt)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Locked() != list[j].Locked() {
+			return list[i].Locked()
+		}
+		return list[i].LastFailure.After(list[j].LastFailure)
+	})
+	return list
+}
+
+// ClearLoginAttempt 管理员解除IP或用户名的锁定并清零失败次数
+func ClearLoginAttempt(kind, key string) error {
+	if kind != LockoutKindIP && kind != LockoutKindUser {
+		return ErrInvalidLockoutKind
+	}
+
+	lockouts.mu.Lock()
+	defer lockouts.mu.Unlock()
+
+	k := lockoutKey(kind, key)
+	if _, ok := lockouts.attempts[k]; !ok {
+		return ErrLockoutNotFound
+	}
+	delete(lockouts.attempts, k)
+	return nil
+}
+
+// get 获取有效的失败记录，过期记录会被删除，调用方需持有锁
+func (s *lockoutStore) get(kind, key string, now time.Time) *LoginAttempt {
+	k := lockoutKey(kind, key)
+	attempt, ok := s.attempts[k]
+	if !ok {
+		return nil
+	}
+	if attempt.expired(now) {
+		delete(s.attempts, k)
+		return nil
+	}
+	return attempt
+}
+
+// prune 删除所有过期记录，防止随机用户名占满内存，调用方需持有锁
+func (s *lockoutStore) prune(now time.Time) {
+	for k, attempt := range s.attempts {
+		if attempt.expired(now) {
+			delete(s.attempts, k)
+		}
+	}
+}
+
+// expired 锁定已结束，或者未锁定且超过计数窗口没有新的失败
+func (a *LoginAttempt) expired(now time.Time) bool {
+	if a.LockedUntil != nil {
+		return !now.Before(*a.LockedUntil)
+	}
+	window := time.Duration(config.GetConfig().Login.FailureWindow) * time.Second
+	return now.Sub(a.LastFailure) > window && !now.Before(a.NextAllowed)
+}
+
+// loginBackoff 第n次失败后需要等待的时间：backoff_base * 2^(n-1)，backoff_max大于0时不超过该值
+func loginBackoff(failures int) time.Duration {
+	cfg := config.GetConfig().Login
+	if cfg.BackoffBase <= 0 || failures <= 0 {
+		return 0
+	}
+	shift := failures - 1
+	if shift > 16 {
+		shift = 16
+	}
+	backoff := time.Duration(cfg.BackoffBase) * time.Second << shift
+	if limit := time.Duration(cfg.BackoffMax) * time.Second; limit > 0 && backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
+
+// lockoutKey 失败记录的存储键
+func lockoutKey(kind, key string) string {
+	return kind + ":" + key
+}
@@ -0,0 +1,32 @@
+package models_test
+
+import (
+	"gin_cloud_drive/backend/testenv"
+	"log"
+	"os"
+	"testing"
+)
+
+var env *testenv.Env
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	cfg := testenv.Config()
+
+	provider := startOIDCProvider()
+	defer provider.Close()
+	provider.configure(cfg)
+
+	directory := startLDAPServer()
+	defer directory.Close()
+	configureLDAP(cfg, directory)
+
+	var err error
+	if env, err = testenv.New(cfg); err != nil {
+		log.Fatal(err)
+	}
+	return m.Run()
+}
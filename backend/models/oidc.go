@@ -0,0 +1,540 @@
+package models
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录请求（state）的有效期
+const oidcStateTTL = 10 * time.Minute
+
+// 允许的时钟偏差
+const oidcClockSkew = time.Minute
+
+var (
+	ErrOIDCDisabled     = errors.New("oidc login is disabled")
+	ErrOIDCConfig       = errors.New("invalid oidc configuration")
+	ErrOIDCInvalidState = errors.New("invalid or expired oidc state")
+	ErrOIDCProvider     = errors.New("oidc provider request failed")
+	ErrOIDCInvalidToken = errors.New("invalid oidc id token")
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCClaims 从ID令牌（以及UserInfo端点）中取出的用户信息
+type OIDCClaims struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// oidcDiscovery 身份提供方的端点信息
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcPending 已跳转到身份提供方、等待回调的登录请求
+type oidcPending struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type oidcClient struct {
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey // kid -> 公钥
+	pending   map[string]*oidcPending     // state -> 登录请求
+	mu        sync.Mutex
+}
+
+var oidc = &oidcClient{
+	keys:    make(map[string]crypto.PublicKey),
+	pending: make(map[string]*oidcPending),
+}
+
+// InitOIDC 检查单点登录配置并加载账号关联，端点在首次登录时再发现，身份提供方暂时不可用不影响启动
+func InitOIDC() error {
+	cfg := config.GetConfig().OIDC
+	if cfg.Enabled && (cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "") {
+		return fmt.Errorf("%w: issuer、client_id和redirect_url不能为空", ErrOIDCConfig)
+	}
+	if cfg.Enabled && !validRole(cfg.DefaultRole) {
+		return fmt.Errorf("%w: default_role应为admin、editor或viewer", ErrOIDCConfig)
+	}
+	return oidcIdentities.loadFromFile()
+}
+
+// OIDCEnabled 是否启用了单点登录
+func OIDCEnabled() bool {
+	return config.GetConfig().OIDC.Enabled
+}
+
+// BeginOIDCLogin 生成state、nonce和PKCE参数，返回state和身份提供方的授权地址
+func BeginOIDCLogin(ctx context.Context) (string, string, error) {
+	cfg := config.GetConfig().OIDC
+	if !cfg.Enabled {
+		return "", "", ErrOIDCDisabled
+	}
+	discovery, err := oidc.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLString(48)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", cfg.RedirectURL)
+	query.Set("scope", strings.Join(oidcScopes(cfg.Scopes), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	for key, values := range authURL.Query() {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	authURL.RawQuery = query.Encode()
+
+	oidc.mu.Lock()
+	defer oidc.mu.Unlock()
+
+	now := time.Now()
+	for s, p := range oidc.pending {
+		if now.After(p.ExpiresAt) {
+			delete(oidc.pending, s)
+		}
+	}
+	oidc.pending[state] = &oidcPending{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}
+	return state, authURL.String(), nil
+}
+
+// CompleteOIDCLogin 用授权码换取令牌并校验ID令牌，state只能使用一次
+func CompleteOIDCLogin(ctx context.Context, state, code string) (OIDCClaims, error) {
+	cfg := config.GetConfig().OIDC
+	if !cfg.Enabled {
+		return OIDCClaims{}, ErrOIDCDisabled
+	}
+
+	oidc.mu.Lock()
+	pending, ok := oidc.pending[state]
+	delete(oidc.pending, state)
+	oidc.mu.Unlock()
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return OIDCClaims{}, ErrOIDCInvalidState
+	}
+
+	discovery, err := oidc.discover(ctx)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	tokens, err := exchangeOIDCCode(ctx, discovery, code, pending.CodeVerifier)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	raw, err := oidc.verifyIDToken(ctx, discovery, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	// ID令牌中没有邮箱或组信息时从UserInfo端点补充
+	if discovery.UserinfoEndpoint != "" && tokens.AccessToken != "" &&
+		(raw[cfg.EmailClaim] == nil || raw[cfg.GroupsClaim] == nil) {
+		if info, err := fetchOIDCUserinfo(ctx, discovery.UserinfoEndpoint, tokens.AccessToken); err == nil && info["sub"] == raw["sub"] {
+			for key, value := range info {
+				if raw[key] == nil {
+					raw[key] = value
+				}
+			}
+		}
+	}
+
+	claims := OIDCClaims{
+		Issuer:   discovery.Issuer,
+		Subject:  claimString(raw, "sub"),
+		Username: claimString(raw, cfg.UsernameClaim),
+		Email:    claimString(raw, cfg.EmailClaim),
+		Groups:   claimStrings(raw, cfg.GroupsClaim),
+	}
+	if claims.Subject == "" {
+		return OIDCClaims{}, fmt.Errorf("%w: 缺少sub", ErrOIDCInvalidToken)
+	}
+	if claims.Username == "" {
+		claims.Username = claims.Email
+	}
+	return claims, nil
+}
+
+// OIDCRole 根据组声明映射本地角色
+func OIDCRole(groups []string) string {
+	cfg := config.GetConfig().OIDC
+	return mapGroupRole(groups, cfg.AdminGroups, cfg.EditorGroups, cfg.DefaultRole, func(group, configured string) bool {
+		return group == configured
+	})
+}
+
+// discover 获取并缓存身份提供方的端点信息
+func (o *oidcClient) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	discovery := o.discovery
+	o.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(config.GetConfig().OIDC.Issuer, "/")
+	discovery = &oidcDiscovery{}
+	if err := getOIDCJSON(ctx, issuer+"/.well-known/openid-configuration", "", discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: 发现文档中的issuer %s 与配置不一致", ErrOIDCProvider, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: 发现文档缺少必要的端点", ErrOIDCProvider)
+	}
+
+	o.mu.Lock()
+	o.discovery = discovery
+	o.mu.Unlock()
+	return discovery, nil
+}
+
+// oidcTokenResponse 令牌端点的响应
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// exchangeOIDCCode 用授权码和PKCE校验值换取令牌
+func exchangeOIDCCode(ctx context.Context, discovery *oidcDiscovery, code, verifier string) (*oidcTokenResponse, error) {
+	cfg := config.GetConfig().OIDC
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	tokens := &oidcTokenResponse{}
+	if err := doOIDCRequest(req, tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: 令牌响应中没有id_token", ErrOIDCProvider)
+	}
+	return tokens, nil
+}
+
+// fetchOIDCUserinfo 从UserInfo端点获取用户声明
+func fetchOIDCUserinfo(ctx context.Context, endpoint, accessToken string) (map[string]any, error) {
+	info := make(map[string]any)
+	if err := getOIDCJSON(ctx, endpoint, accessToken, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// verifyIDToken 校验ID令牌的签名、签发方、受众、有效期和nonce，返回全部声明
+func (o *oidcClient) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, token, nonce string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: 格式错误", ErrOIDCInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: 签名格式错误", ErrOIDCInvalidToken)
+	}
+
+	key, err := o.publicKey(ctx, discovery, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifyJWTSignature(header.Alg, key, digest[:], signature) {
+		return nil, fmt.Errorf("%w: 签名校验失败", ErrOIDCInvalidToken)
+	}
+
+	claims := make(map[string]any)
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	cfg := config.GetConfig().OIDC
+	now := time.Now()
+	if strings.TrimSuffix(claimString(claims, "iss"), "/") != strings.TrimSuffix(discovery.Issuer, "/") {
+		return nil, fmt.Errorf("%w: issuer不匹配", ErrOIDCInvalidToken)
+	}
+	audiences := claimStrings(claims, "aud")
+	if !containsPermission(audiences, cfg.ClientID) {
+		return nil, fmt.Errorf("%w: audience不匹配", ErrOIDCInvalidToken)
+	}
+	if azp := claimString(claims, "azp"); len(audiences) > 1 && azp != cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp不匹配", ErrOIDCInvalidToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("%w: 已过期", ErrOIDCInvalidToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claimString(claims, "nonce")), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce不匹配", ErrOIDCInvalidToken)
+	}
+	return claims, nil
+}
+
+// publicKey 按kid查找签名公钥，找不到时重新获取JWKS（身份提供方可能已轮换密钥）
+func (o *oidcClient) publicKey(ctx context.Context, discovery *oidcDiscovery, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.lookupKey(kid)
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getOIDCJSON(ctx, discovery.JWKSURI, "", &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil || k.Crv != "P-256" {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.keys = keys
+	if key, ok := o.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: 找不到签名公钥 %s", ErrOIDCInvalidToken, kid)
+}
+
+// lookupKey 查找公钥，令牌没有kid且只有一个公钥时使用该公钥，调用方需持有锁
+func (o *oidcClient) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := o.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// verifyJWTSignature 校验RS256或ES256签名
+func verifyJWTSignature(alg string, key crypto.PublicKey, digest, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// decodeJWTPart 解码JWT的头部或载荷
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: 格式错误", ErrOIDCInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: 格式错误", ErrOIDCInvalidToken)
+	}
+	return nil
+}
+
+// getOIDCJSON 发送GET请求并解析JSON响应，accessToken不为空时作为Bearer令牌发送
+func getOIDCJSON(ctx context.Context, endpoint, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return doOIDCRequest(req, v)
+}
+
+// doOIDCRequest 发送请求，非2xx响应视为失败
+func doOIDCRequest(req *http.Request, v any) error {
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s 返回 %d: %s", ErrOIDCProvider, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+	return nil
+}
+
+// oidcScopes 确保scope中包含openid
+func oidcScopes(scopes []string) []string {
+	if containsPermission(scopes, "openid") {
+		return scopes
+	}
+	return append([]string{"openid"}, scopes...)
+}
+
+// claimString 取字符串声明
+func claimString(claims map[string]any, name string) string {
+	if name == "" {
+		return ""
+	}
+	s, _ := claims[name].(string)
+	return s
+}
+
+// claimStrings 取字符串或字符串数组声明
+func claimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// randomURLString 生成URL安全的随机字符串
+func randomURLString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// randomPassword 为自动创建的用户生成随机密码，这些用户只能通过单点登录
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,400 @@
+package models_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/testenv"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	oidcClientID     = "drive"
+	oidcClientSecret = "s3cret"
+	oidcRedirectURL  = "http://example.com/api/auth/oidc/callback"
+	oidcKeyID        = "test-key"
+)
+
+// oidcProvider 测试用的身份提供方，授权步骤由测试直接调用authorize完成
+type oidcProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]oidcCode
+	claims map[string]any              // 下一次签发的用户声明
+	tamper func(claims map[string]any) // 签名前修改ID令牌的声明
+	signer *rsa.PrivateKey             // 不为nil时用该密钥签名，模拟伪造的令牌
+}
+
+// oidcCode 已签发的授权码
+type oidcCode struct {
+	nonce     string
+	challenge string
+}
+
+var idp *oidcProvider
+
+func startOIDCProvider() *oidcProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	idp = &oidcProvider{key: key, codes: make(map[string]oidcCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// configure 启用单点登录并指向测试身份提供方：ops组为管理员，dev组为编辑者，其余为只读
+func (p *oidcProvider) configure(cfg *config.Config) {
+	cfg.OIDC.Enabled = true
+	cfg.OIDC.Issuer = p.URL
+	cfg.OIDC.ClientID = oidcClientID
+	cfg.OIDC.ClientSecret = oidcClientSecret
+	cfg.OIDC.RedirectURL = oidcRedirectURL
+	cfg.OIDC.AdminGroups = []string{"ops"}
+	cfg.OIDC.EditorGroups = []string{"dev"}
+	cfg.OIDC.DefaultRole = models.RoleViewer
+}
+
+// reset 设置下一次登录的用户声明，清除之前测试的篡改
+func (p *oidcProvider) reset(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+	p.tamper = nil
+	p.signer = nil
+}
+
+// authorize 模拟用户在身份提供方同意授权，返回授权码
+func (p *oidcProvider) authorize(t *testing.T, authURL *url.URL) string {
+	t.Helper()
+	q := authURL.Query()
+	if q.Get("client_id") != oidcClientID || q.Get("redirect_uri") != oidcRedirectURL || q.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	return p.issueCode(q.Get("nonce"), q.Get("code_challenge"))
+}
+
+func (p *oidcProvider) issueCode(nonce, challenge string) string {
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = oidcCode{nonce: nonce, challenge: challenge}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *oidcProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *oidcProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"kid": oidcKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token 校验客户端、授权码和PKCE后签发ID令牌
+func (p *oidcProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if r.ParseForm() != nil || id != oidcClientID || secret != oidcClientSecret || r.PostForm.Get("redirect_uri") != oidcRedirectURL {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.URL,
+		"aud":   oidcClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": code.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	if p.tamper != nil {
+		p.tamper(claims)
+	}
+	signer := p.key
+	if p.signer != nil {
+		signer = p.signer
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signJWT(signer, claims)})
+}
+
+func signJWT(key *rsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": oidcKeyID})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// beginOIDCLogin 发起单点登录，返回身份提供方的授权地址
+func beginOIDCLogin(t *testing.T, client *testenv.Client) *url.URL {
+	t.Helper()
+	rec := client.Get("/api/auth/oidc/login")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status = %d: %s", rec.Code, rec.Body)
+	}
+	authURL, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || authURL.Host != mustParse(idp.URL).Host || authURL.Path != "/authorize" {
+		t.Fatalf("login redirected to %q", rec.Header().Get("Location"))
+	}
+	if cookie, ok := client.Cookie("oidc_state"); !ok || cookie.Value != authURL.Query().Get("state") {
+		t.Fatalf("state cookie does not match the authorization request")
+	}
+	return authURL
+}
+
+// oidcCallback 访问回调地址，返回跳转的错误信息，登录成功时为空
+func oidcCallback(t *testing.T, client *testenv.Client, query url.Values) string {
+	t.Helper()
+	rec := client.Get("/api/auth/oidc/callback?" + query.Encode())
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status = %d: %s", rec.Code, rec.Body)
+	}
+	location := mustParse(rec.Header().Get("Location"))
+	if location.Path != "/" {
+		t.Fatalf("callback redirected to %s", location)
+	}
+	if _, ok := client.Cookie("oidc_state"); ok {
+		t.Fatal("state cookie was not cleared")
+	}
+	message := location.Query().Get("login_error")
+	_, loggedIn := client.Cookie(middleware.SessionCookieName)
+	if loggedIn == (message != "") {
+		t.Fatalf("login_error = %q but session cookie present = %v", message, loggedIn)
+	}
+	return message
+}
+
+// completeOIDCLogin 走完整的单点登录流程，返回跳转的错误信息
+func completeOIDCLogin(t *testing.T) (*testenv.Client, string) {
+	t.Helper()
+	client := env.Client()
+	authURL := beginOIDCLogin(t, client)
+	code := idp.authorize(t, authURL)
+	return client, oidcCallback(t, client, url.Values{"state": {authURL.Query().Get("state")}, "code": {code}})
+}
+
+func mustParse(raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestOIDCLoginMapsGroupsToRoles(t *testing.T) {
+	tests := []struct {
+		groups []string
+		role   string
+	}{
+		{[]string{"dev"}, models.RoleEditor},
+		{[]string{"dev", "ops"}, models.RoleAdmin},
+		{[]string{"Ops"}, models.RoleViewer}, // 组名区分大小写
+		{nil, models.RoleViewer},
+	}
+
+	for _, tt := range tests {
+		claims := map[string]any{"sub": "oidc-alice", "preferred_username": "oidc_alice", "email": "alice@example.com"}
+		if tt.groups != nil {
+			claims["groups"] = tt.groups
+		}
+		idp.reset(claims)
+
+		client, message := completeOIDCLogin(t)
+		if message != "" {
+			t.Fatalf("groups %v: login failed: %s", tt.groups, message)
+		}
+		if rec := client.Get("/api/user/info"); rec.Code != http.StatusOK {
+			t.Fatalf("groups %v: user info: status = %d", tt.groups, rec.Code)
+		}
+		// 每次登录都按组同步角色
+		user, err := models.GetUser("oidc_alice")
+		if err != nil || user.Role != tt.role {
+			t.Fatalf("groups %v: role = %q, %v, want %q", tt.groups, user.Role, err, tt.role)
+		}
+	}
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	idp.reset(map[string]any{"sub": "oidc-pkce", "preferred_username": "oidc_pkce"})
+
+	first := beginOIDCLogin(t, env.Client()).Query()
+	second := beginOIDCLogin(t, env.Client()).Query()
+	if first.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", first.Get("code_challenge_method"))
+	}
+	// S256的challenge为32字节摘要的base64url编码
+	if challenge, err := base64.RawURLEncoding.DecodeString(first.Get("code_challenge")); err != nil || len(challenge) != sha256.Size {
+		t.Fatalf("code_challenge = %q", first.Get("code_challenge"))
+	}
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if first.Get(param) == "" || first.Get(param) == second.Get(param) {
+			t.Fatalf("%s is empty or reused: %q", param, first.Get(param))
+		}
+	}
+
+	// 攻击者注入为其他challenge签发的授权码，换取令牌时PKCE校验失败
+	client := env.Client()
+	authURL := beginOIDCLogin(t, client)
+	code := idp.issueCode(authURL.Query().Get("nonce"), second.Get("code_challenge"))
+	if message := oidcCallback(t, client, url.Values{"state": {authURL.Query().Get("state")}, "code": {code}}); message == "" {
+		t.Fatal("login with a code bound to another PKCE challenge succeeded")
+	}
+
+	// 正常的授权码可以换取令牌，说明发送的code_verifier与challenge对应
+	if _, message := completeOIDCLogin(t); message != "" {
+		t.Fatalf("login failed: %s", message)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	idp.reset(map[string]any{"sub": "oidc-state", "preferred_username": "oidc_state"})
+
+	tests := []struct {
+		name  string
+		query func(state, code string) url.Values
+		fresh bool // 换一个没有state Cookie的客户端访问回调
+	}{
+		{"different state", func(state, code string) url.Values {
+			return url.Values{"state": {state + "x"}, "code": {code}}
+		}, false},
+		{"missing state", func(state, code string) url.Values {
+			return url.Values{"code": {code}}
+		}, false},
+		{"no state cookie", func(state, code string) url.Values {
+			return url.Values{"state": {state}, "code": {code}}
+		}, true},
+		{"provider error", func(state, code string) url.Values {
+			return url.Values{"state": {state}, "error": {"access_denied"}}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := env.Client()
+			authURL := beginOIDCLogin(t, client)
+			code := idp.authorize(t, authURL)
+			if tt.fresh {
+				client = env.Client()
+			}
+			if message := oidcCallback(t, client, tt.query(authURL.Query().Get("state"), code)); message == "" {
+				t.Fatal("login succeeded")
+			}
+		})
+	}
+
+	// Cookie和参数一致但state不是服务端签发的
+	forged := env.Client()
+	forged.Do(func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?state=forged&code=x", nil)
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: "forged"})
+		return req
+	}())
+	if _, ok := forged.Cookie(middleware.SessionCookieName); ok {
+		t.Fatal("login with a forged state succeeded")
+	}
+
+	// state只能使用一次
+	client := env.Client()
+	authURL := beginOIDCLogin(t, client)
+	state := authURL.Query().Get("state")
+	if message := oidcCallback(t, client, url.Values{"state": {state}, "code": {idp.authorize(t, authURL)}}); message != "" {
+		t.Fatalf("login failed: %s", message)
+	}
+	replay := env.Client()
+	rec := replay.Do(func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"state": {state}, "code": {idp.authorize(t, authURL)}}.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: state})
+		return req
+	}())
+	if mustParse(rec.Header().Get("Location")).Query().Get("login_error") == "" {
+		t.Fatal("replayed state was accepted")
+	}
+}
+
+func TestOIDCRejectsInvalidIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]any)
+		signer *rsa.PrivateKey
+	}{
+		{"nonce mismatch", func(c map[string]any) { c["nonce"] = "attacker-nonce" }, nil},
+		{"missing nonce", func(c map[string]any) { delete(c, "nonce") }, nil},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other-client" }, nil},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.net" }, nil},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, nil},
+		{"missing subject", func(c map[string]any) { delete(c, "sub") }, nil},
+		{"forged signature", nil, otherKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.reset(map[string]any{"sub": "oidc-token", "preferred_username": "oidc_token"})
+			idp.mu.Lock()
+			idp.tamper, idp.signer = tt.tamper, tt.signer
+			idp.mu.Unlock()
+
+			if _, message := completeOIDCLogin(t); message != "身份提供方返回的令牌无效" {
+				t.Fatalf("login_error = %q", message)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// Session 登录会话
+type Session struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type sessionStore struct {
+	sessions map[string]*Session // 会话ID -> 会话
+	secret   []byte
+	mu       sync.RWMutex
+}
+
+var sessions = &sessionStore{
+	sessions: make(map[string]*Session),
+}
+
+// InitSessionStore 初始化会话存储
+func InitSessionStore() error {
+	secret := []byte(config.GetConfig().Session.Secret)
+	if len(secret) == 0 {
+		// 未配置密钥时随机生成，重启后旧令牌全部失效
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+	}
+
+	sessions.mu.Lock()
+	sessions.secret = secret
+	sessions.mu.Unlock()
+
+	// 启动过期会话清理协程
+	go cleanSessionsPeriodically()
+
+	return nil
+}
+
+// CreateSession 为用户创建会话，返回签名后的令牌
+func CreateSession(username, ip, userAgent string) (string, Session, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", Session{}, err
+	}
+	id := hex.EncodeToString(buf)
+
+	now := time.Now()
+	session := &Session{
+		ID:         id,
+		Username:   username,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiryFrom(now, now),
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	sessions.sessions[id] = session
+
+	return id + "." + sessions.sign(id), *session, nil
+}
+
+// ValidateSession 校验令牌并滑动续期，返回续期后的会话
+func ValidateSession(token string) (Session, error) {
+	id, ok := sessions.verify(token)
+	if !ok {
+		return Session{}, ErrInvalidSession
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	session, ok := sessions.sessions[id]
+	if !ok {
+		return Session{}, ErrInvalidSession
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		delete(sessions.sessions, id)
+		return Session{}, ErrInvalidSession
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = expiryFrom(session.CreatedAt, now)
+	return *session, nil
+}
+
+// DeleteSession 根据令牌删除会话，返回被删除会话的用户名
+func DeleteSession(token string) string {
+	id, ok := sessions.verify(token)
+	if !ok {
+		return ""
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	session, ok := sessions.sessions[id]
+	if !ok {
+		return ""
+	}
+	delete(sessions.sessions, id)
+	return session.Username
+}
+
+// DeleteUserSessions 删除用户的所有会话
+func DeleteUserSessions(username string) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	for id, session := range sessions.sessions {
+		if session.Username == username {
+			delete(sessions.sessions, id)
+		}
+	}
+}
+
+// DeleteOtherUserSessions 删除用户除keepToken对应会话以外的所有会话，修改密码后调用
+func DeleteOtherUserSessions(username, keepToken string) int {
+	keepID, ok := sessions.verify(keepToken)
+	if !ok {
+		keepID = ""
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+
+	count := 0
+	for id, session := range sessions.sessions {
+		if session.Username == username && id != keepID {
+			delete(sessions.sessions, id)
+			count++
+		}
+	}
+	return count
+}
+
+// expiryFrom 计算会话过期时间：空闲超时与最长有效期取较早者
+func expiryFrom(createdAt, now time.Time) time.Time {
+	cfg := config.GetConfig().Session
+	expiresAt := now.Add(time.Duration(cfg.TTL) * time.Second)
+	if cfg.MaxLifetime > 0 {
+		if limit := createdAt.Add(time.Duration(cfg.MaxLifetime) * time.Second); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+	}
+	return expiresAt
+}
+
+// CSRFToken 根据会话令牌派生CSRF令牌，会话失效后随之失效，无需单独保存
+func CSRFToken(token string) string {
+	id, _, _ := strings.Cut(token, ".")
+
+	sessions.mu.RLock()
+	defer sessions.mu.RUnlock()
+	return sessions.sign("csrf|" + id)
+}
+
+// ValidCSRFToken 校验请求携带的CSRF令牌是否属于该会话
+func ValidCSRFToken(token, csrfToken string) bool {
+	return csrfToken != "" && hmac.Equal([]byte(csrfToken), []byte(CSRFToken(token)))
+}
+
+// sign 计算会话ID的HMAC签名
+func (s *sessionStore) sign(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify 校验令牌签名，返回会话ID
+func (s *sessionStore) verify(token string) (string, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+
+	s.mu.RLock()
+	expected := s.sign(id)
+	s.mu.RUnlock()
+
+	return id, hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// 定期清理过期会话
+func cleanSessionsPeriodically() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		sessions.mu.Lock()
+		for id, session := range sessions.sessions {
+			if now.After(session.ExpiresAt) {
+				delete(sessions.sessions, id)
+			}
+		}
+		sessions.mu.Unlock()
+	}
+}
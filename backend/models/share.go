@@ -0,0 +1,384 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareNotFound     = errors.New("share not found")
+	ErrShareExpired      = errors.New("share has expired")
+	ErrShareLimitReached = errors.New("share download limit reached")
+	ErrSharePassword     = errors.New("share password required or incorrect")
+)
+
+// Share 分享链接
+type Share struct {
+	Token        string     `json:"token"`
+	Path         string     `json:"path"` // 分享的文件或目录（相对上传目录）
+	IsDir        bool       `json:"is_dir"`
+	PasswordHash string     `json:"password_hash,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // 为空表示永不过期
+	MaxDownloads int        `json:"max_downloads"`        // 0表示不限制下载次数
+	Downloads    int        `json:"downloads"`
+	Transferred  int64      `json:"transferred,omitempty"` // 不足一次完整下载的已发送字节数
+	Visits       int        `json:"visits"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	pending int64 // 正在发送的请求预留的下载量，单位为1/shareUnit次，不持久化
+}
+
+// shareUnit 预留下载量的精度，Range请求只预留所请求区间占文件大小的比例
+const shareUnit = 1 << 20
+
+// ShareReservation 发送前预留的下载额度，发送结束后必须调用FinishShareDownload释放
+type ShareReservation struct {
+	token string
+	units int64
+	size  int64
+}
+
+// HasPassword 是否设置了访问密码
+func (s Share) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// Expired 是否已过期
+func (s Share) Expired() bool {
+	return s.ExpiresAt != nil && time.Now().After(*s.ExpiresAt)
+}
+
+// Exhausted 下载次数是否已用完
+func (s Share) Exhausted() bool {
+	return s.MaxDownloads > 0 && s.Downloads >= s.MaxDownloads
+}
+
+// 访问次数和不足一次下载的已发送字节数的持久化间隔，避免每次访问和每个Range请求都写文件
+const shareStatsInterval = time.Minute
+
+type shareStore struct {
+	shares    map[string]*Share // 令牌 -> 分享
+	lastSaved time.Time         // 上次写入文件的时间
+	mu        sync.RWMutex
+}
+
+var shares = &shareStore{
+	shares: make(map[string]*Share),
+}
+
+// InitShareStore 初始化分享存储
+func InitShareStore() error {
+	return loadSharesFromFile()
+}
+
+// CreateShare 创建分享链接，password为空表示不需要密码
+func CreateShare(path string, isDir bool, password string, expiresAt *time.Time, maxDownloads int, createdBy string) (Share, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Share{}, err
+	}
+
+	share := &Share{
+		Token:        base64.RawURLEncoding.EncodeToString(buf),
+		Path:         path,
+		IsDir:        isDir,
+		ExpiresAt:    expiresAt,
+		MaxDownloads: maxDownloads,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return Share{}, err
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	shares.shares[share.Token] = share
+	if err := saveSharesToFile(); err != nil {
+		delete(shares.shares, share.Token)
+		return Share{}, err
+	}
+	return *share, nil
+}
+
+// GetShare 获取仍然有效的分享，创建者被禁用或删除后分享失效
+func GetShare(token string) (Share, error) {
+	shares.mu.RLock()
+	share, ok := shares.shares[token]
+	var s Share
+	if ok {
+		s = *share
+	}
+	shares.mu.RUnlock()
+
+	if !ok {
+		return Share{}, ErrShareNotFound
+	}
+	if owner, err := GetUser(s.CreatedBy); err != nil || owner.Disabled {
+		return Share{}, ErrShareNotFound
+	}
+	if s.Expired() {
+		return Share{}, ErrShareExpired
+	}
+	if s.Exhausted() {
+		return Share{}, ErrShareLimitReached
+	}
+	return s, nil
+}
+
+// ListShares 列出分享，owner为空时列出全部，最新创建的在前
+func ListShares(owner string) []Share {
+	shares.mu.RLock()
+	defer shares.mu.RUnlock()
+
+	list := make([]Share, 0, len(shares.shares))
+	for _, share := range shares.shares {
+		if owner == "" || share.CreatedBy == owner {
+			list = append(list, *share)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// RevokeShare 撤销分享，owner非空时只能撤销自己创建的分享
+func RevokeShare(token, owner string) (Share, error) {
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	share, ok := shares.shares[token]
+	if !ok || (owner != "" && share.CreatedBy != owner) {
+		return Share{}, ErrShareNotFound
+	}
+	delete(shares.shares, token)
+	if err := saveSharesToFile(); err != nil {
+		shares.shares[token] = share
+		return Share{}, err
+	}
+	return *share, nil
+}
+
+// MoveShares 文件或目录重命名、移动后，让分享跟随到新路径，否则分享链接会失效
+func MoveShares(oldPath, newPath string) error {
+	oldPath, newPath = accessPath(oldPath), accessPath(newPath)
+	if oldPath == "" || oldPath == newPath {
+		return nil
+	}
+
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	changed := false
+	for _, share := range shares.shares {
+		if accessWithin(oldPath, share.Path) {
+			share.Path = newPath + strings.TrimPrefix(share.Path, oldPath)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveSharesToFile()
+}
+
+// DeletePathShares 删除文件或目录时撤销其中的分享，否则之后在同一路径创建的文件会通过旧链接公开
+func DeletePathShares(p string) error {
+	p = accessPath(p)
+	if p == "" {
+		return nil
+	}
+
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	changed := false
+	for token, share := range shares.shares {
+		if accessWithin(p, share.Path) {
+			delete(shares.shares, token)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveSharesToFile()
+}
+
+// DeleteUserShares 删除用户创建的所有分享，删除用户时调用
+func DeleteUserShares(username string) error {
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	changed := false
+	for token, share := range shares.shares {
+		if share.CreatedBy == username {
+			delete(shares.shares, token)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveSharesToFile()
+}
+
+// RecordShareVisit 记录一次访问，返回累计访问次数，访问次数按间隔写入文件
+func RecordShareVisit(token string) (int, error) {
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	share, ok := shares.shares[token]
+	if !ok {
+		return 0, nil
+	}
+	share.Visits++
+	return share.Visits, saveShareStats(false)
+}
+
+// ReserveShareDownload 在发送前预留下载额度，want为本次请求要发送的字节数，size为文件大小
+// 已下载、未满一次的已发送字节和其他请求已预留的额度合计用完时返回ErrShareLimitReached，
+// 这样并发请求不会在各自发送完之前都通过下载次数检查；size不大于0（如打包下载）时每次预留一次
+func ReserveShareDownload(token string, want, size int64) (ShareReservation, error) {
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	share, ok := shares.shares[token]
+	if !ok {
+		return ShareReservation{}, ErrShareNotFound
+	}
+
+	units := int64(shareUnit)
+	if size > 0 {
+		want = min(max(want, 1), size)
+		units = (want*shareUnit + size - 1) / size
+	}
+	if share.MaxDownloads > 0 {
+		used := int64(share.Downloads)*shareUnit + share.pending
+		if size > 0 {
+			used += share.Transferred * shareUnit / size
+		}
+		if used >= int64(share.MaxDownloads)*shareUnit {
+			return ShareReservation{}, ErrShareLimitReached
+		}
+	}
+	share.pending += units
+	return ShareReservation{token: token, units: units, size: size}, nil
+}
+
+// FinishShareDownload 释放预留的额度，并按实际发送的字节数n计入下载次数，发送失败时n为0
+// 每累计满size字节计为一次下载，这样无论分几个Range请求、从哪里开始，取得完整内容都会用掉下载次数
+// 返回累计下载次数和本次新增的下载次数；下载次数增加时立即写入文件，其余按间隔写入
+func FinishShareDownload(r ShareReservation, n int64) (int, int, error) {
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	share, ok := shares.shares[r.token]
+	if !ok {
+		return 0, 0, nil
+	}
+	share.pending = max(share.pending-r.units, 0)
+	if n <= 0 {
+		return share.Downloads, 0, nil
+	}
+
+	added := 1
+	if r.size > 0 {
+		share.Transferred += n
+		added = int(share.Transferred / r.size)
+		share.Transferred %= r.size
+	}
+	share.Downloads += added
+	return share.Downloads, added, saveShareStats(added > 0)
+}
+
+// CheckSharePassword 校验分享密码
+func CheckSharePassword(share Share, password string) bool {
+	if !share.HasPassword() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) == nil
+}
+
+// ShareAccessKey 生成通过密码校验后的访问凭证，修改密码或撤销分享后凭证失效
+func ShareAccessKey(share Share) string {
+	sessions.mu.RLock()
+	defer sessions.mu.RUnlock()
+	return sessions.sign("share:" + share.Token + ":" + share.PasswordHash)
+}
+
+// VerifyShareAccess 校验访问凭证
+func VerifyShareAccess(share Share, key string) bool {
+	if !share.HasPassword() {
+		return true
+	}
+	return hmac.Equal([]byte(key), []byte(ShareAccessKey(share)))
+}
+
+// saveShareStats 保存访问统计，force为false时距上次写入不足shareStatsInterval则跳过，调用方需持有写锁
+func saveShareStats(force bool) error {
+	if !force && time.Since(shares.lastSaved) < shareStatsInterval {
+		return nil
+	}
+	return saveSharesToFile()
+}
+
+// 保存分享数据到文件，调用方需持有写锁
+func saveSharesToFile() error {
+	shares.lastSaved = time.Now()
+
+	path := config.GetConfig().Share.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(shares.shares, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载分享数据
+func loadSharesFromFile() error {
+	path := config.GetConfig().Share.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	shares.mu.Lock()
+	defer shares.mu.Unlock()
+
+	return json.Unmarshal(data, &shares.shares)
+}
@@ -0,0 +1,63 @@
+package models_test
+
+import (
+	"encoding/json"
+	"gin_cloud_drive/backend/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// savedShare 读取分享数据文件中保存的分享
+func savedShare(t *testing.T, path, token string) models.Share {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]models.Share
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	return saved[token]
+}
+
+func TestShareStatsSaveInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shares.json")
+	env.Config.Share.DataFile = path
+	t.Cleanup(func() { env.Config.Share.DataFile = "" })
+
+	share, err := models.CreateShare("docs/report.pdf", false, "", nil, 0, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { models.RevokeShare(share.Token, "") })
+
+	// 刚写入过文件，访问次数和不足一次下载的字节数暂不写入
+	for range 3 {
+		if _, err := models.RecordShareVisit(share.Token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reservation, err := models.ReserveShareDownload(share.Token, 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := models.FinishShareDownload(reservation, 100); err != nil {
+		t.Fatal(err)
+	}
+	if saved := savedShare(t, path, share.Token); saved.Visits != 0 || saved.Transferred != 0 {
+		t.Fatalf("stats saved on every request: %+v", saved)
+	}
+
+	// 下载次数增加时立即写入，同时带上之前的统计
+	if reservation, err = models.ReserveShareDownload(share.Token, 900, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if downloads, added, err := models.FinishShareDownload(reservation, 900); downloads != 1 || added != 1 || err != nil {
+		t.Fatalf("finish = %d, %d, %v", downloads, added, err)
+	}
+	if saved := savedShare(t, path, share.Token); saved.Visits != 3 || saved.Downloads != 1 || saved.Transferred != 0 {
+		t.Fatalf("saved = %+v", saved)
+	}
+}
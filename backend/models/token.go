@@ -0,0 +1,311 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API令牌权限范围
+const (
+	ScopeRead  = "read"  // GET、HEAD请求
+	ScopeWrite = "write" // 其他修改数据的请求
+	ScopeAdmin = "admin" // 管理员接口，仅管理员可以授予
+)
+
+// allScopes 权限范围的规范顺序
+var allScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// tokenPrefix API令牌前缀，便于在日志和代码中识别泄露的令牌
+const tokenPrefix = "gcd_"
+
+// 最后使用时间的持久化间隔，避免每个请求都写文件
+const tokenTouchInterval = time.Minute
+
+var (
+	ErrInvalidToken      = errors.New("invalid or expired api token")
+	ErrTokenNotFound     = errors.New("api token not found")
+	ErrInvalidScope      = errors.New("invalid token scope")
+	ErrInvalidTokenName  = errors.New("invalid token name")
+	ErrAdminScopeDenied  = errors.New("only admins can grant the admin scope")
+	ErrTokenLimitReached = errors.New("too many api tokens")
+)
+
+// 每个用户最多拥有的令牌数
+const maxTokensPerUser = 50
+
+// APIToken 个人API令牌，令牌明文只在创建时返回一次，服务端只保存哈希
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	SecretHash string     `json:"secret_hash"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // 为空表示永不过期
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// Prefix 令牌的公开部分，用于在列表中辨认令牌
+func (t APIToken) Prefix() string {
+	return tokenPrefix + t.ID
+}
+
+// Expired 是否已过期
+func (t APIToken) Expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// HasScope 是否拥有指定权限范围
+func (t APIToken) HasScope(scope string) bool {
+	return containsPermission(t.Scopes, scope)
+}
+
+type tokenStore struct {
+	tokens    map[string]*APIToken // 令牌ID -> 令牌
+	lastSaved map[string]time.Time // 令牌ID -> 最后使用时间上次写入文件的时间
+	mu        sync.Mutex
+}
+
+var tokens = &tokenStore{
+	tokens:    make(map[string]*APIToken),
+	lastSaved: make(map[string]time.Time),
+}
+
+// InitTokenStore 初始化API令牌存储
+func InitTokenStore() error {
+	return loadTokensFromFile()
+}
+
+// CreateToken 为用户创建API令牌，返回令牌明文
+func CreateToken(user User, name string, scopes []string, expiresAt *time.Time) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", APIToken{}, ErrInvalidTokenName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	for _, scope := range scopes {
+		if scope == ScopeAdmin && user.Role != RoleAdmin {
+			return "", APIToken{}, ErrAdminScopeDenied
+		}
+	}
+
+	idBuf := make([]byte, 8)
+	secretBuf := make([]byte, 32)
+	if _, err := rand.Read(idBuf); err != nil {
+		return "", APIToken{}, err
+	}
+	if _, err := rand.Read(secretBuf); err != nil {
+		return "", APIToken{}, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBuf)
+
+	token := &APIToken{
+		ID:         hex.EncodeToString(idBuf),
+		Name:       name,
+		Username:   user.Username,
+		SecretHash: hashTokenSecret(secret),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now(),
+	}
+
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	count := 0
+	for _, t := range tokens.tokens {
+		if t.Username == user.Username {
+			count++
+		}
+	}
+	if count >= maxTokensPerUser {
+		return "", APIToken{}, ErrTokenLimitReached
+	}
+
+	tokens.tokens[token.ID] = token
+	if err := saveTokensToFile(); err != nil {
+		delete(tokens.tokens, token.ID)
+		return "", APIToken{}, err
+	}
+	return token.Prefix() + "_" + secret, copyToken(token), nil
+}
+
+// ValidateToken 校验令牌明文并记录使用时间和来源IP
+func ValidateToken(raw, ip string) (APIToken, error) {
+	id, secret, ok := parseToken(raw)
+	if !ok {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	token, ok := tokens.tokens[id]
+	if !ok || !hmac.Equal([]byte(token.SecretHash), []byte(hashTokenSecret(secret))) || token.Expired() {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	now := time.Now()
+	token.LastUsedAt = &now
+	token.LastUsedIP = ip
+	if now.Sub(tokens.lastSaved[id]) >= tokenTouchInterval {
+		tokens.lastSaved[id] = now
+		saveTokensToFile()
+	}
+	return copyToken(token), nil
+}
+
+// ListTokens 列出用户的API令牌，最新创建的在前
+func ListTokens(username string) []APIToken {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	list := []APIToken{}
+	for _, token := range tokens.tokens {
+		if token.Username == username {
+			list = append(list, copyToken(token))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// RevokeToken 撤销用户的API令牌
+func RevokeToken(username, id string) (APIToken, error) {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	token, ok := tokens.tokens[id]
+	if !ok || token.Username != username {
+		return APIToken{}, ErrTokenNotFound
+	}
+	delete(tokens.tokens, id)
+	delete(tokens.lastSaved, id)
+	if err := saveTokensToFile(); err != nil {
+		tokens.tokens[id] = token
+		return APIToken{}, err
+	}
+	return copyToken(token), nil
+}
+
+// DeleteUserTokens 删除用户的所有API令牌，删除用户时调用
+func DeleteUserTokens(username string) error {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	changed := false
+	for id, token := range tokens.tokens {
+		if token.Username == username {
+			delete(tokens.tokens, id)
+			delete(tokens.lastSaved, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveTokensToFile()
+}
+
+// IsAPIToken 判断字符串是否具有API令牌的格式
+func IsAPIToken(raw string) bool {
+	return strings.HasPrefix(raw, tokenPrefix)
+}
+
+// parseToken 将令牌明文拆分为ID和密钥
+func parseToken(raw string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(raw, tokenPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, "_")
+}
+
+// hashTokenSecret 计算令牌密钥的哈希，令牌本身是高熵随机值，不需要慢哈希
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes 检查权限范围，去重后按规范顺序排列，至少需要一个权限范围
+func normalizeScopes(scopes []string) ([]string, error) {
+	for _, scope := range scopes {
+		if !containsPermission(allScopes, scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+	list := make([]string, 0, len(allScopes))
+	for _, scope := range allScopes {
+		if containsPermission(scopes, scope) {
+			list = append(list, scope)
+		}
+	}
+	if len(list) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return list, nil
+}
+
+// copyToken 复制令牌，避免调用方修改存储中的数据
+func copyToken(token *APIToken) APIToken {
+	t := *token
+	t.Scopes = append([]string{}, token.Scopes...)
+	return t
+}
+
+// 保存令牌数据到文件，调用方需持有锁
+func saveTokensToFile() error {
+	path := config.GetConfig().Token.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(tokens.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载令牌数据
+func loadTokensFromFile() error {
+	path := config.GetConfig().Token.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	return json.Unmarshal(data, &tokens.tokens)
+}
@@ -0,0 +1,426 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TOTP参数（RFC 6238），与常见身份验证器应用的默认值一致
+const (
+	totpPeriod = 30 // 时间步长（秒）
+	totpDigits = 6  // 验证码位数
+	totpSkew   = 1  // 允许前后偏差的时间步数，容忍客户端时钟误差
+)
+
+// 恢复码数量
+const recoveryCodeCount = 10
+
+// 登录第二步的有效期和最多尝试次数
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingEnrollment = errors.New("no pending two-factor enrollment")
+	ErrInvalidTOTPCode     = errors.New("invalid verification code")
+	ErrInvalidChallenge    = errors.New("invalid or expired login challenge")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactor 用户的两步验证设置
+type TwoFactor struct {
+	Secret        string     `json:"secret,omitempty"`         // 已启用的TOTP密钥（base32）
+	PendingSecret string     `json:"pending_secret,omitempty"` // 绑定中、尚未确认的密钥
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"` // 恢复码哈希，使用后删除
+	LastCounter   int64      `json:"last_counter"`             // 最后使用的时间步，防止验证码重放
+	EnabledAt     *time.Time `json:"enabled_at,omitempty"`
+}
+
+// loginChallenge 密码校验通过、等待输入验证码的登录请求
+type loginChallenge struct {
+	Username  string
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+type twoFactorStore struct {
+	users      map[string]*TwoFactor      // 用户名 -> 两步验证设置
+	challenges map[string]*loginChallenge // 登录挑战ID -> 挑战
+	mu         sync.Mutex
+}
+
+var twoFactor = &twoFactorStore{
+	users:      make(map[string]*TwoFactor),
+	challenges: make(map[string]*loginChallenge),
+}
+
+// InitTwoFactorStore 初始化两步验证存储
+func InitTwoFactorStore() error {
+	return loadTwoFactorFromFile()
+}
+
+// TwoFactorEnabled 用户是否已启用两步验证
+func TwoFactorEnabled(username string) bool {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	tf, ok := twoFactor.users[username]
+	return ok && tf.Secret != ""
+}
+
+// TwoFactorStatus 获取两步验证状态和剩余恢复码数量
+func TwoFactorStatus(username string) (bool, int, *time.Time) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	tf, ok := twoFactor.users[username]
+	if !ok || tf.Secret == "" {
+		return false, 0, nil
+	}
+	return true, len(tf.RecoveryCodes), tf.EnabledAt
+}
+
+// BeginTOTPEnrollment 生成新的TOTP密钥，返回base32密钥和otpauth URI，需确认验证码后才启用
+func BeginTOTPEnrollment(username string) (string, string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	secret := totpEncoding.EncodeToString(buf)
+
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	tf, ok := twoFactor.users[username]
+	if ok && tf.Secret != "" {
+		return "", "", ErrTwoFactorEnabled
+	}
+	if !ok {
+		tf = &TwoFactor{}
+		twoFactor.users[username] = tf
+	}
+	tf.PendingSecret = secret
+	if err := saveTwoFactorToFile(); err != nil {
+		return "", "", err
+	}
+	return secret, otpauthURI(username, secret), nil
+}
+
+// ConfirmTOTPEnrollment 用验证码确认绑定并启用两步验证，返回恢复码明文
+func ConfirmTOTPEnrollment(username, code string) ([]string, error) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	tf, ok := twoFactor.users[username]
+	if ok && tf.Secret != "" {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !ok || tf.PendingSecret == "" {
+		return nil, ErrNoPendingEnrollment
+	}
+	counter, ok := matchTOTP(tf.PendingSecret, code, 0)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	old := *tf
+	tf.Secret = tf.PendingSecret
+	tf.PendingSecret = ""
+	tf.RecoveryCodes = hashes
+	tf.LastCounter = counter
+	tf.EnabledAt = &now
+	if err := saveTwoFactorToFile(); err != nil {
+		*tf = old
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor 校验TOTP验证码或恢复码，恢复码只能使用一次，返回是否使用了恢复码
+func VerifySecondFactor(username, code string) (bool, error) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+	return verifySecondFactor(username, code)
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(username, code string) ([]string, error) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	if _, err := verifySecondFactor(username, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	tf := twoFactor.users[username]
+	old := tf.RecoveryCodes
+	tf.RecoveryCodes = hashes
+	if err := saveTwoFactorToFile(); err != nil {
+		tf.RecoveryCodes = old
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ResetTwoFactor 关闭用户的两步验证并清除未完成的绑定，用于用户自行关闭、管理员重置和删除用户
+func ResetTwoFactor(username string) error {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	tf, ok := twoFactor.users[username]
+	if !ok {
+		return ErrTwoFactorNotEnabled
+	}
+	delete(twoFactor.users, username)
+	for id, challenge := range twoFactor.challenges {
+		if challenge.Username == username {
+			delete(twoFactor.challenges, id)
+		}
+	}
+	if err := saveTwoFactorToFile(); err != nil {
+		twoFactor.users[username] = tf
+		return err
+	}
+	if tf.Secret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	return nil
+}
+
+// CreateLoginChallenge 密码校验通过后创建登录挑战，客户端需提交挑战ID和验证码完成登录
+func CreateLoginChallenge(username string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	now := time.Now()
+	for cid, challenge := range twoFactor.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(twoFactor.challenges, cid)
+		}
+	}
+	twoFactor.challenges[id] = &loginChallenge{
+		Username:  username,
+		ExpiresAt: now.Add(loginChallengeTTL),
+	}
+	return id, nil
+}
+
+// LoginChallengeUsername 获取有效登录挑战对应的用户名，用于校验验证码前检查锁定状态
+func LoginChallengeUsername(id string) (string, bool) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	challenge, ok := twoFactor.challenges[id]
+	if !ok || time.Now().After(challenge.ExpiresAt) {
+		return "", false
+	}
+	return challenge.Username, true
+}
+
+// CompleteLoginChallenge 校验登录挑战的验证码，成功后挑战失效，返回用户名和是否使用了恢复码
+// 验证码错误次数过多时挑战作废，需要重新输入密码
+func CompleteLoginChallenge(id, code string) (string, bool, error) {
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	challenge, ok := twoFactor.challenges[id]
+	if !ok || time.Now().After(challenge.ExpiresAt) {
+		delete(twoFactor.challenges, id)
+		return "", false, ErrInvalidChallenge
+	}
+
+	usedRecovery, err := verifySecondFactor(challenge.Username, code)
+	if err != nil {
+		challenge.Attempts++
+		if challenge.Attempts >= loginChallengeMaxAttempts {
+			delete(twoFactor.challenges, id)
+		}
+		return challenge.Username, false, err
+	}
+	delete(twoFactor.challenges, id)
+	return challenge.Username, usedRecovery, nil
+}
+
+// verifySecondFactor 调用方需持有锁
+func verifySecondFactor(username, code string) (bool, error) {
+	tf, ok := twoFactor.users[username]
+	if !ok || tf.Secret == "" {
+		return false, ErrTwoFactorNotEnabled
+	}
+
+	if counter, ok := matchTOTP(tf.Secret, code, tf.LastCounter); ok {
+		old := tf.LastCounter
+		tf.LastCounter = counter
+		if err := saveTwoFactorToFile(); err != nil {
+			tf.LastCounter = old
+			return false, err
+		}
+		return false, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range tf.RecoveryCodes {
+		if hmac.Equal([]byte(stored), []byte(hash)) {
+			old := tf.RecoveryCodes
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+			if err := saveTwoFactorToFile(); err != nil {
+				tf.RecoveryCodes = old
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, ErrInvalidTOTPCode
+}
+
+// matchTOTP 在允许的时钟偏差内查找匹配的时间步，只接受大于lastCounter的时间步
+func matchTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	now := time.Now().Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		counter := now + offset
+		if counter <= lastCounter {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, counter)), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode 计算指定时间步的验证码（HMAC-SHA1，动态截断）
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// otpauthURI 生成身份验证器应用识别的otpauth URI，可直接生成二维码扫描
+func otpauthURI(username, secret string) string {
+	issuer := config.GetConfig().TwoFactor.Issuer
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + username,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// generateRecoveryCodes 生成恢复码，返回明文和哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(buf)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 计算恢复码哈希，忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// 保存两步验证数据到文件，调用方需持有锁
+func saveTwoFactorToFile() error {
+	path := config.GetConfig().TwoFactor.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(twoFactor.users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载两步验证数据
+func loadTwoFactorFromFile() error {
+	path := config.GetConfig().TwoFactor.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	twoFactor.mu.Lock()
+	defer twoFactor.mu.Unlock()
+
+	return json.Unmarshal(data, &twoFactor.users)
+}
@@ -0,0 +1,417 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户角色，高等级的角色拥有低等级角色的全部权限
+const (
+	RoleAdmin  = "admin"  // 管理员：删除文件、系统设置、日志和用户管理
+	RoleEditor = "editor" // 编辑者：上传、重命名、移动、新建目录、分享
+	RoleViewer = "viewer" // 只读用户：浏览和下载
+)
+
+// legacyRoleUser 旧版本的普通用户角色，加载时迁移为编辑者
+const legacyRoleUser = "user"
+
+// roleLevels 角色的权限等级
+var roleLevels = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// roleNames 角色的中文名称
+var roleNames = map[string]string{
+	RoleViewer: "只读用户",
+	RoleEditor: "编辑者",
+	RoleAdmin:  "管理员",
+}
+
+// 密码最小长度
+const minPasswordLength = 6
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidUsername    = errors.New("invalid username")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrPasswordTooShort   = errors.New("password is too short")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrLastAdmin          = errors.New("cannot remove the last active admin")
+)
+
+// User 用户信息
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastLoginAt  time.Time `json:"last_login_at"`
+}
+
+type userStore struct {
+	users map[string]*User
+	mu    sync.RWMutex
+}
+
+var users = &userStore{
+	users: make(map[string]*User),
+}
+
+// dummyHash 用户不存在时参与比较，避免通过响应时间探测用户名
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// InitUserStore 初始化用户存储
+func InitUserStore() error {
+	if err := migrateAdminPassword(); err != nil {
+		return err
+	}
+	if err := loadUsersFromFile(); err != nil {
+		return err
+	}
+
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	if migrateLegacyRoles() {
+		if err := saveUsersToFile(); err != nil {
+			return err
+		}
+	}
+
+	// 首次启动时根据配置创建管理员账号
+	if len(users.users) == 0 {
+		cfg := config.GetConfig()
+		hash := cfg.User.AdminPassword
+		if !isPasswordHash(hash) {
+			var err error
+			if hash, err = hashPassword(hash); err != nil {
+				return err
+			}
+		}
+		users.users[cfg.User.AdminUsername] = &User{
+			Username:     cfg.User.AdminUsername,
+			PasswordHash: hash,
+			Role:         RoleAdmin,
+			CreatedAt:    time.Now(),
+		}
+		return saveUsersToFile()
+	}
+
+	return nil
+}
+
+// Authenticate 校验用户名和密码，登录成功后需调用RecordLogin记录登录时间
+func Authenticate(username, password string) (User, error) {
+	// bcrypt很慢，取得用户副本后不持有锁校验，避免登录请求阻塞用户的修改
+	user, err := GetUser(username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return User{}, ErrUserDisabled
+	}
+
+	return user, nil
+}
+
+// RecordLogin 记录用户的最后登录时间
+func RecordLogin(username string) error {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.LastLoginAt = time.Now()
+	return saveUsersToFile()
+}
+
+// GetUser 获取用户
+func GetUser(username string) (User, error) {
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// ListUsers 列出所有用户，按用户名排序
+func ListUsers() []User {
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+
+	list := make([]User, 0, len(users.users))
+	for _, user := range users.users {
+		list = append(list, *user)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+	return list
+}
+
+// CreateUser 创建用户
+func CreateUser(username, password, role string) (User, error) {
+	username = strings.TrimSpace(username)
+	if !validUsername(username) {
+		return User{}, ErrInvalidUsername
+	}
+	if !validRole(role) {
+		return User{}, ErrInvalidRole
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	if _, ok := users.users[username]; ok {
+		return User{}, ErrUserExists
+	}
+
+	user := &User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    time.Now(),
+	}
+	users.users[username] = user
+	if err := saveUsersToFile(); err != nil {
+		delete(users.users, username)
+		return User{}, err
+	}
+
+	return *user, nil
+}
+
+// SetPassword 修改用户密码
+func SetPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	old := user.PasswordHash
+	user.PasswordHash = hash
+	if err := saveUsersToFile(); err != nil {
+		user.PasswordHash = old
+		return err
+	}
+	return nil
+}
+
+// SetUserRole 修改用户角色，不能降级最后一个未禁用的管理员
+func SetUserRole(username, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.Role == role {
+		return nil
+	}
+	if user.Role == RoleAdmin && !user.Disabled && countActiveAdmins() <= 1 {
+		return ErrLastAdmin
+	}
+
+	old := user.Role
+	user.Role = role
+	if err := saveUsersToFile(); err != nil {
+		user.Role = old
+		return err
+	}
+	return nil
+}
+
+// SetUserDisabled 启用或禁用用户
+func SetUserDisabled(username string, disabled bool) error {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if disabled && user.Role == RoleAdmin && !user.Disabled && countActiveAdmins() <= 1 {
+		return ErrLastAdmin
+	}
+
+	user.Disabled = disabled
+	return saveUsersToFile()
+}
+
+// DeleteUser 删除用户
+func DeleteUser(username string) error {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	user, ok := users.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.Role == RoleAdmin && !user.Disabled && countActiveAdmins() <= 1 {
+		return ErrLastAdmin
+	}
+
+	delete(users.users, username)
+	return saveUsersToFile()
+}
+
+// countActiveAdmins 统计未禁用的管理员数量，调用方需持有锁
+func countActiveAdmins() int {
+	count := 0
+	for _, user := range users.users {
+		if user.Role == RoleAdmin && !user.Disabled {
+			count++
+		}
+	}
+	return count
+}
+
+// hashPassword 生成密码哈希
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// isPasswordHash 判断字符串是否为bcrypt哈希
+func isPasswordHash(s string) bool {
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil
+}
+
+// migrateAdminPassword 将配置文件中明文的admin_password替换为bcrypt哈希
+// admin_password只在首次启动创建管理员账号时使用，此后修改密码不会写回配置文件
+func migrateAdminPassword() error {
+	password := config.GetConfig().User.AdminPassword
+	if password == "" || isPasswordHash(password) {
+		return nil
+	}
+	// 不检查长度，已有的短密码也要迁移
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return config.SetAdminPasswordHash(string(hash))
+}
+
+// validUsername 检查用户名是否合法
+func validUsername(username string) bool {
+	if username == "" || len(username) > 32 {
+		return false
+	}
+	return !strings.ContainsAny(username, " \t\r\n/\\:")
+}
+
+// validRole 检查角色是否合法
+func validRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole 角色的等级是否不低于required
+func HasRole(role, required string) bool {
+	return roleLevels[role] > 0 && roleLevels[role] >= roleLevels[required]
+}
+
+// RoleName 角色的中文名称
+func RoleName(role string) string {
+	if name, ok := roleNames[role]; ok {
+		return name
+	}
+	return role
+}
+
+// migrateLegacyRoles 把旧版本的普通用户迁移为编辑者，保持原有的上传和修改权限，调用方需持有锁
+func migrateLegacyRoles() bool {
+	changed := false
+	for _, user := range users.users {
+		if user.Role == legacyRoleUser {
+			user.Role = RoleEditor
+			changed = true
+		}
+	}
+	return changed
+}
+
+// 保存用户数据到文件，调用方需持有锁
+func saveUsersToFile() error {
+	path := config.GetConfig().User.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(users.users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// 从文件加载用户数据
+func loadUsersFromFile() error {
+	path := config.GetConfig().User.DataFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	return json.Unmarshal(data, &users.users)
+}
@@ -1,76 +1,205 @@
-package routes
-
-import (
-	"gin_cloud_drive/backend/controllers"
-	"gin_cloud_drive/backend/middleware"
-
-	"github.com/gin-gonic/gin"
-)
-
-// RegisterRoutes 注册所有路由
-func RegisterRoutes(r *gin.Engine) {
-	// 首页
-	r.GET("/", controllers.Home)
-
-	// API路由组
-	api := r.Group("/api")
-	{
-		// 认证路由
-		auth := api.Group("/auth")
-		{
-			auth.POST("/login", controllers.Login)
-			auth.POST("/logout", controllers.Logout)
-		}
-
-		// 用户中心路由（需要认证）
-		user := api.Group("/user")
-		user.Use(middleware.AuthMiddleware())
-		{
-			user.GET("/info", controllers.GetUserInfo)
-			user.PUT("/info", controllers.UpdateUserInfo)
-			user.GET("/settings", controllers.GetSettings)
-			user.PUT("/settings", controllers.UpdateSettings)
-		}
-
-		// 文件管理路由
-		file := api.Group("/file")
-		{
-			// 游客可访问的路由
-			file.GET("/list", controllers.ListFiles)
-			file.GET("/download/*filename", controllers.DownloadFile)
-			file.GET("/preview/*filename", controllers.PreviewFile)
-			file.GET("/carousel", controllers.GetCarouselImages)
-
-			// 管理员可访问的路由（需要认证）
-			adminFile := file.Group("/")
-			adminFile.Use(middleware.AuthMiddleware())
-			{
-				adminFile.POST("/upload", controllers.UploadFile)
-				adminFile.PUT("/rename", controllers.RenameFile)
-				adminFile.PUT("/move", controllers.MoveFile)
-				adminFile.DELETE("/delete/*filename", controllers.DeleteFile)
-				adminFile.POST("/mkdir", controllers.CreateDirectory)
-			}
-		}
-
-		// 系统状态路由
-		system := api.Group("/system")
-		{
-			system.GET("/info", controllers.GetSystemInfo)
-			system.GET("/history", controllers.GetSystemHistory)
-		}
-
-		// 日志管理路由（需要认证）
-		log := api.Group("/log")
-		log.Use(middleware.AuthMiddleware())
-		{
-			log.GET("/list", controllers.GetLogs)
-			log.GET("/stats", controllers.GetLogStats)
-			log.DELETE("/clear", controllers.ClearOldLogs)
-		}
-	}
-
-	// 关于页面
-	r.GET("/about", controllers.About)
-	r.GET("/about/system", controllers.SystemStatus)
-}
+package routes
+
+import (
+	"gin_cloud_drive/backend/controllers"
+	"gin_cloud_drive/backend/middleware"
+	"gin_cloud_drive/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 注册所有路由
+func RegisterRoutes(r *gin.Engine) {
+	// 拒绝其他站点发起的修改请求
+	r.Use(middleware.SameOriginMiddleware())
+
+	// 首页
+	r.GET("/", controllers.Home)
+
+	// API路由组
+	api := r.Group("/api")
+	{
+		// 认证路由
+		auth := api.Group("/auth")
+		{
+			auth.POST("/login", controllers.Login)
+			auth.POST("/logout", controllers.Logout)
+			auth.POST("/2fa", controllers.LoginTwoFactor)
+
+			// 单点登录（OpenID Connect）
+			auth.GET("/oidc", controllers.GetOIDCInfo)
+			auth.GET("/oidc/login", controllers.OIDCLogin)
+			auth.GET("/oidc/callback", controllers.OIDCCallback)
+		}
+
+		// 用户中心路由（需要认证，所有角色）
+		user := api.Group("/user")
+		user.Use(middleware.AuthMiddleware())
+		{
+			user.GET("/info", controllers.GetUserInfo)
+			user.PUT("/info", controllers.UpdateUserInfo)
+			user.PUT("/password", controllers.ChangePassword)
+
+			// API令牌（只能通过会话管理）
+			user.GET("/tokens", controllers.ListTokens)
+			user.POST("/tokens", controllers.CreateToken)
+			user.DELETE("/tokens/:id", controllers.RevokeToken)
+
+			// 两步验证（只能通过会话管理）
+			user.GET("/2fa", controllers.GetTwoFactorStatus)
+			user.POST("/2fa/setup", controllers.SetupTwoFactor)
+			user.POST("/2fa/enable", controllers.EnableTwoFactor)
+			user.POST("/2fa/disable", controllers.DisableTwoFactor)
+			user.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+
+			// 系统设置（需要管理员权限）
+			settings := user.Group("/settings")
+			settings.Use(middleware.RequireRole(models.RoleAdmin))
+			{
+				settings.GET("", controllers.GetSettings)
+				settings.PUT("", controllers.UpdateSettings)
+			}
+		}
+
+		// 用户管理路由（需要管理员权限）
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleAdmin))
+		{
+			admin.GET("/users", controllers.ListUsers)
+			admin.POST("/users", controllers.CreateUser)
+			admin.PUT("/users/:username/status", controllers.UpdateUserStatus)
+			admin.PUT("/users/:username/role", controllers.UpdateUserRole)
+			admin.DELETE("/users/:username", controllers.DeleteUser)
+			admin.DELETE("/users/:username/2fa", controllers.ResetUserTwoFactor)
+
+			// 登录锁定
+			admin.GET("/lockouts", controllers.ListLoginLockouts)
+			admin.DELETE("/lockouts", controllers.ClearLoginLockout)
+
+			// 用户组
+			admin.GET("/groups", controllers.ListGroups)
+			admin.POST("/groups", controllers.CreateGroup)
+			admin.PUT("/groups/:name", controllers.UpdateGroupMembers)
+			admin.DELETE("/groups/:name", controllers.DeleteGroup)
+
+			// 目录权限
+			admin.GET("/acl", controllers.ListACL)
+			admin.GET("/acl/effective", controllers.GetEffectivePermissions)
+			admin.PUT("/acl", controllers.SetACLEntry)
+			admin.DELETE("/acl", controllers.DeleteACLEntry)
+
+			// 游客访问规则
+			admin.GET("/access", controllers.GetAccessRules)
+			admin.PUT("/access", controllers.SetAccessRule)
+			admin.DELETE("/access", controllers.DeleteAccessRule)
+
+			// 静态加密
+			admin.POST("/encryption/rotate", controllers.RotateEncryptionKeys)
+		}
+
+		// 文件管理路由
+		file := api.Group("/file")
+		{
+			// 游客可访问的路由，游客只能访问公开目录（见access配置）
+			file.GET("/list", middleware.GuestBrowseMiddleware(), controllers.ListFiles)
+			file.GET("/carousel", middleware.OptionalAuthMiddleware(), controllers.GetCarouselImages)
+
+			guestFile := file.Group("/")
+			guestFile.Use(middleware.GuestReadMiddleware())
+			{
+				guestFile.GET("/download/*filename", controllers.DownloadFile)
+				guestFile.HEAD("/download/*filename", controllers.DownloadFile)
+				guestFile.GET("/preview/*filename", controllers.PreviewFile)
+				guestFile.HEAD("/preview/*filename", controllers.PreviewFile)
+				guestFile.GET("/archive", controllers.DownloadArchive)
+				guestFile.POST("/archive", controllers.DownloadArchive)
+			}
+
+			// 只读路由（需要认证，所有角色）
+			viewerFile := file.Group("/")
+			viewerFile.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleViewer))
+			{
+				viewerFile.GET("/usage", controllers.GetStorageUsage)
+				viewerFile.GET("/archive/list", controllers.ListArchive)
+				viewerFile.GET("/versions", controllers.ListVersions)
+				viewerFile.GET("/versions/:id", controllers.DownloadVersion)
+			}
+
+			// 修改文件的路由（需要编辑者权限）
+			editorFile := file.Group("/")
+			editorFile.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleEditor))
+			{
+				editorFile.POST("/upload", controllers.UploadFile)
+				editorFile.PUT("/rename", controllers.RenameFile)
+				editorFile.PUT("/move", controllers.MoveFile)
+				editorFile.POST("/mkdir", controllers.CreateDirectory)
+				editorFile.POST("/extract", controllers.ExtractArchive)
+
+				// 分片上传（断点续传）
+				editorFile.POST("/uploads", controllers.CreateUpload)
+				editorFile.HEAD("/uploads/:id", controllers.GetUploadStatus)
+				editorFile.GET("/uploads/:id", controllers.GetUploadStatus)
+				editorFile.PATCH("/uploads/:id", controllers.PatchUpload)
+				editorFile.POST("/uploads/:id/complete", controllers.CompleteUpload)
+				editorFile.DELETE("/uploads/:id", controllers.CancelUpload)
+
+				// 回收站和历史版本的恢复
+				editorFile.GET("/trash", controllers.ListTrash)
+				editorFile.POST("/trash/:id/restore", controllers.RestoreTrashItem)
+				editorFile.POST("/versions/:id/restore", controllers.RestoreVersion)
+			}
+
+			// 删除文件的路由（需要管理员权限）
+			adminFile := file.Group("/")
+			adminFile.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleAdmin))
+			{
+				adminFile.DELETE("/delete/*filename", controllers.DeleteFile)
+				adminFile.DELETE("/trash/:id", controllers.PurgeTrashItem)
+				adminFile.DELETE("/trash", controllers.EmptyTrash)
+			}
+		}
+
+		// 分享管理路由（需要编辑者权限）
+		share := api.Group("/share")
+		share.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleEditor))
+		{
+			share.POST("", controllers.CreateShare)
+			share.GET("", controllers.ListShares)
+			share.DELETE("/:token", controllers.RevokeShare)
+		}
+
+		// 系统状态路由
+		system := api.Group("/system")
+		{
+			system.GET("/info", controllers.GetSystemInfo)
+			system.GET("/history", controllers.GetSystemHistory)
+		}
+
+		// 日志管理路由（需要管理员权限）
+		log := api.Group("/log")
+		log.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleAdmin))
+		{
+			log.GET("/list", controllers.GetLogs)
+			log.GET("/stats", controllers.GetLogStats)
+			log.DELETE("/clear", controllers.ClearOldLogs)
+		}
+	}
+
+	// 上传文件直接访问（经过路径校验，不跟随指向上传目录外的符号链接）
+	r.GET("/upload/*filename", middleware.GuestReadMiddleware(), controllers.PreviewFile)
+	r.HEAD("/upload/*filename", middleware.GuestReadMiddleware(), controllers.PreviewFile)
+
+	// 公开分享链接，无需登录
+	s := r.Group("/s/:token")
+	{
+		s.GET("", controllers.SharePage)
+		s.GET("/info", controllers.ShareInfo)
+		s.POST("/auth", controllers.ShareAuth)
+		s.GET("/download", controllers.ShareDownload)
+		s.HEAD("/download", controllers.ShareDownload)
+	}
+
+	// 关于页面
+	r.GET("/about", controllers.About)
+	r.GET("/about/system", controllers.SystemStatus)
+}
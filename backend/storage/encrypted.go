@@ -0,0 +1,538 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// 加密文件的格式（版本1）：
+//
+//	头部 73字节：魔数"GCDE"(4) | 版本(1) | 主密钥ID(8) | 包装数据密钥的随机数(12) | 包装后的数据密钥(32+16)
+//	数据 按64KiB分帧，每帧用数据密钥以AES-256-GCM加密，帧长为明文长度+16字节的认证标签
+//
+// 每个文件有独立的随机数据密钥，帧的随机数由帧序号确定，附加数据包含帧序号和是否为最后一帧，
+// 帧被调换、删除或文件被截断都会导致解密失败。轮换主密钥时只需重新包装头部的数据密钥，不用重新加密数据
+const (
+	encMagic      = "GCDE"
+	encVersion    = 1
+	encKeyIDSize  = 8
+	encHeaderSize = 4 + 1 + encKeyIDSize + 12 + 32 + 16
+	encFrameSize  = 64 << 10
+	encTagSize    = 16
+)
+
+var (
+	ErrEncryptionKey = errors.New("storage: master key must be 32 bytes")
+	ErrUnknownKey    = errors.New("storage: file was encrypted with an unknown master key")
+	ErrCorrupted     = errors.New("storage: encrypted file is corrupted")
+)
+
+// Encrypted 在内层驱动之上透明地加密文件内容，目录结构和文件名不加密
+// 启用前已存在的明文文件仍可读取，但列出的大小可能不准确，需要调用Rewrap加密
+type Encrypted struct {
+	inner   Storage
+	current masterKey
+	keys    map[[encKeyIDSize]byte]cipher.AEAD // 包括当前主密钥
+}
+
+// masterKey 用于包装数据密钥的主密钥
+type masterKey struct {
+	id   [encKeyIDSize]byte
+	aead cipher.AEAD
+}
+
+// NewEncrypted 创建加密驱动，key为当前主密钥，previous为轮换前的旧主密钥，只用于解开旧文件的数据密钥
+func NewEncrypted(inner Storage, key []byte, previous ...[]byte) (*Encrypted, error) {
+	current, err := newMasterKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Encrypted{
+		inner:   inner,
+		current: current,
+		keys:    map[[encKeyIDSize]byte]cipher.AEAD{current.id: current.aead},
+	}
+	for _, k := range previous {
+		old, err := newMasterKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := e.keys[old.id]; !ok {
+			e.keys[old.id] = old.aead
+		}
+	}
+	return e, nil
+}
+
+// newMasterKey 主密钥的ID取SHA-256的前8字节，用于在解密时找到对应的主密钥
+func newMasterKey(key []byte) (masterKey, error) {
+	if len(key) != 32 {
+		return masterKey{}, ErrEncryptionKey
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return masterKey{}, err
+	}
+	sum := sha256.Sum256(key)
+	mk := masterKey{aead: aead}
+	copy(mk.id[:], sum[:encKeyIDSize])
+	return mk, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Stat 返回明文的大小
+func (e *Encrypted) Stat(name string) (fs.FileInfo, error) {
+	info, err := e.inner.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return plainInfo(info), nil
+}
+
+func (e *Encrypted) List(name string) ([]fs.FileInfo, error) {
+	infos, err := e.inner.List(name)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		infos[i] = plainInfo(info)
+	}
+	return infos, nil
+}
+
+func (e *Encrypted) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	file, _, err := e.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Open 打开文件用于随机读取，每次只解密用到的帧；没有加密头部的明文文件原样返回
+func (e *Encrypted) Open(name string) (File, fs.FileInfo, error) {
+	raw, info, err := Open(e.inner, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, encHeaderSize)
+	if _, err := raw.ReadAt(header, 0); err != nil || string(header[:4]) != encMagic {
+		// 启用加密前写入的文件
+		if _, err := raw.Seek(0, io.SeekStart); err != nil {
+			raw.Close()
+			return nil, nil, err
+		}
+		return raw, info, nil
+	}
+
+	aead, err := e.dataKey(header)
+	if err != nil {
+		raw.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	size, ok := plainSize(info.Size())
+	if !ok {
+		raw.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrCorrupted)
+	}
+	file := &encFile{
+		raw:        raw,
+		aead:       aead,
+		cipherSize: info.Size(),
+		size:       size,
+		cached:     -1,
+	}
+	return file, plainInfo(info), nil
+}
+
+// Write 用新的随机数据密钥加密后写入，返回写入的明文字节数
+func (e *Encrypted) Write(name string, r io.Reader) (int64, error) {
+	header, aead, err := e.newHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	enc := &encryptReader{
+		src:  bufio.NewReaderSize(r, encFrameSize),
+		aead: aead,
+		out:  header,
+		buf:  make([]byte, encFrameSize),
+	}
+	if _, err := e.inner.Write(name, enc); err != nil {
+		return 0, err
+	}
+	return enc.n, nil
+}
+
+func (e *Encrypted) Rename(oldName, newName string) error {
+	return e.inner.Rename(oldName, newName)
+}
+
+func (e *Encrypted) Remove(name string) error {
+	return e.inner.Remove(name)
+}
+
+func (e *Encrypted) MkdirAll(name string) error {
+	return e.inner.MkdirAll(name)
+}
+
+// Copy 直接复制密文，数据密钥保存在头部中，复制出的文件同样可以解密
+func (e *Encrypted) Copy(src, dst string) error {
+	return Copy(e.inner, src, dst)
+}
+
+func (e *Encrypted) Chtimes(name string, modTime time.Time) error {
+	return Chtimes(e.inner, name, modTime)
+}
+
+// RealPath 内层驱动存在符号链接时解析真实路径，否则返回名称本身
+func (e *Encrypted) RealPath(name string) (string, error) {
+	if r, ok := e.inner.(Resolver); ok {
+		return r.RealPath(name)
+	}
+	return name, nil
+}
+
+// Rewrap 用当前主密钥重新包装文件的数据密钥，只改写头部，数据帧原样复制；明文文件会被加密
+// 返回文件是否被改写，已使用当前主密钥的文件不做修改，修改时间保持不变
+func (e *Encrypted) Rewrap(name string) (bool, error) {
+	raw, info, err := Open(e.inner, name)
+	if err != nil {
+		return false, err
+	}
+	defer raw.Close()
+
+	header := make([]byte, encHeaderSize)
+	if _, err := raw.ReadAt(header, 0); err != nil || string(header[:4]) != encMagic {
+		if _, err := raw.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		if _, err := e.Write(name, raw); err != nil {
+			return false, err
+		}
+	} else {
+		if bytes.Equal(header[5:5+encKeyIDSize], e.current.id[:]) {
+			return false, nil
+		}
+		key, err := e.unwrapKey(header)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+		newHeader, err := e.wrapKey(key)
+		if err != nil {
+			return false, err
+		}
+		if _, err := raw.Seek(encHeaderSize, io.SeekStart); err != nil {
+			return false, err
+		}
+		if _, err := e.inner.Write(name, io.MultiReader(bytes.NewReader(newHeader), raw)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := Chtimes(e.inner, name, info.ModTime()); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// newHeader 生成新的数据密钥和包含包装后数据密钥的头部
+func (e *Encrypted) newHeader() ([]byte, cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := e.wrapKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, aead, nil
+}
+
+// wrapKey 用当前主密钥包装数据密钥，生成头部
+func (e *Encrypted) wrapKey(key []byte) ([]byte, error) {
+	header := make([]byte, 0, encHeaderSize)
+	header = append(header, encMagic...)
+	header = append(header, encVersion)
+	header = append(header, e.current.id[:]...)
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// 头部的固定部分作为附加数据，主密钥ID被篡改时无法解开
+	aad := header[:5+encKeyIDSize]
+	header = append(header, nonce...)
+	return e.current.aead.Seal(header, nonce, key, aad), nil
+}
+
+// unwrapKey 从头部解开数据密钥
+func (e *Encrypted) unwrapKey(header []byte) ([]byte, error) {
+	if header[4] != encVersion {
+		return nil, ErrCorrupted
+	}
+	var id [encKeyIDSize]byte
+	copy(id[:], header[5:5+encKeyIDSize])
+	kek, ok := e.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	nonce := header[5+encKeyIDSize : 5+encKeyIDSize+12]
+	key, err := kek.Open(nil, nonce, header[5+encKeyIDSize+12:], header[:5+encKeyIDSize])
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return key, nil
+}
+
+// dataKey 从头部解开数据密钥并创建用于解密数据帧的AEAD
+func (e *Encrypted) dataKey(header []byte) (cipher.AEAD, error) {
+	key, err := e.unwrapKey(header)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// plainSize 根据密文大小计算明文大小，大小不符合加密格式时返回false
+func plainSize(cipherSize int64) (int64, bool) {
+	body := cipherSize - encHeaderSize
+	if body < encTagSize {
+		return 0, false
+	}
+	frames, rem := body/(encFrameSize+encTagSize), body%(encFrameSize+encTagSize)
+	if rem == 0 {
+		return frames * encFrameSize, true
+	}
+	if rem < encTagSize {
+		return 0, false
+	}
+	return frames*encFrameSize + rem - encTagSize, true
+}
+
+// plainInfo 将普通文件的大小换算为明文大小，目录、符号链接和不符合加密格式的文件保持不变
+func plainInfo(info fs.FileInfo) fs.FileInfo {
+	if !info.Mode().IsRegular() {
+		return info
+	}
+	size, ok := plainSize(info.Size())
+	if !ok {
+		return info
+	}
+	return &plainFileInfo{FileInfo: info, size: size}
+}
+
+// plainFileInfo 只替换大小，保留内层驱动的其余信息
+type plainFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi *plainFileInfo) Size() int64 { return fi.size }
+
+// frameNonce 帧的随机数：4字节0加8字节帧序号，每个文件的数据密钥都不同，不会重复使用
+func frameNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+// frameAAD 帧的附加数据：帧序号和是否为最后一帧
+func frameAAD(index int64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, uint64(index))
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// encryptReader 按帧加密src，先输出头部
+type encryptReader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	out   []byte // 待输出的密文
+	buf   []byte
+	index int64
+	done  bool
+	n     int64 // 已读取的明文字节数
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// nextFrame 读取并加密下一帧，读到数据末尾时标记为最后一帧；空文件也有一个空的最后一帧
+func (r *encryptReader) nextFrame() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	final := false
+	switch err {
+	case nil:
+		if _, err := r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+
+	r.n += int64(n)
+	r.out = r.aead.Seal(r.out[:0], frameNonce(r.index), r.buf[:n], frameAAD(r.index, final))
+	r.index++
+	r.done = final
+	return nil
+}
+
+// encFile 加密文件的随机读取句柄，缓存最近解密的一帧，顺序读取时每帧只解密一次
+type encFile struct {
+	mu         sync.Mutex
+	raw        File
+	aead       cipher.AEAD
+	cipherSize int64
+	size       int64 // 明文大小
+	offset     int64
+	cached     int64 // 缓存的帧序号，-1表示没有
+	plain      []byte
+	buf        []byte
+}
+
+func (f *encFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *encFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+// readAt 调用方需持有锁
+func (f *encFile) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("storage: negative offset")
+	}
+	n := 0
+	for n < len(p) && off < f.size {
+		index := off / encFrameSize
+		frame, err := f.frame(index)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], frame[off-index*encFrameSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// frame 解密第index帧，顺序读取相邻的帧时内层驱动可以复用同一个读取流
+func (f *encFile) frame(index int64) ([]byte, error) {
+	if index == f.cached {
+		return f.plain, nil
+	}
+
+	start := encHeaderSize + index*(encFrameSize+encTagSize)
+	length := min(encFrameSize+encTagSize, f.cipherSize-start)
+	if length < encTagSize {
+		return nil, ErrCorrupted
+	}
+	if f.buf == nil {
+		f.buf = make([]byte, encFrameSize+encTagSize)
+	}
+	if _, err := f.raw.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(f.raw, f.buf[:length]); err != nil {
+		return nil, err
+	}
+
+	plain, err := f.aead.Open(f.plain[:0], frameNonce(index), f.buf[:length], frameAAD(index, start+length == f.cipherSize))
+	if err != nil {
+		f.cached = -1
+		return nil, ErrCorrupted
+	}
+	f.plain, f.cached = plain, index
+	return plain, nil
+}
+
+func (f *encFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *encFile) Close() error {
+	return f.raw.Close()
+}
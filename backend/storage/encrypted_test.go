@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEncrypted(t *testing.T, inner Storage, key []byte, previous ...[]byte) *Encrypted {
+	t.Helper()
+	e, err := NewEncrypted(inner, key, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// pattern 可识别的明文，用于确认密文中不含明文且范围读取的位置正确
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	return data
+}
+
+// cipherSize 明文大小为n时密文的大小
+func cipherSize(n int64) int64 {
+	frames := n/encFrameSize + 1
+	if n > 0 && n%encFrameSize == 0 {
+		frames--
+	}
+	return encHeaderSize + n + frames*encTagSize
+}
+
+func readAll(s Storage, name string) ([]byte, error) {
+	rc, err := s.OpenRange(name, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	mem := NewMemory()
+	e := newEncrypted(t, mem, newKey(t))
+
+	sizes := []int{0, 1, 100, encFrameSize - 1, encFrameSize, encFrameSize + 1, 2 * encFrameSize, 3*encFrameSize + 17}
+	for _, size := range sizes {
+		plain := pattern(size)
+		n, err := e.Write("f.bin", bytes.NewReader(plain))
+		if err != nil || n != int64(size) {
+			t.Fatalf("size %d: write = %d, %v", size, n, err)
+		}
+
+		raw, err := ReadFile(mem, "f.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(raw)) != cipherSize(int64(size)) || string(raw[:4]) != encMagic {
+			t.Fatalf("size %d: ciphertext is %d bytes, want %d", size, len(raw), cipherSize(int64(size)))
+		}
+		if size >= 26 && bytes.Contains(raw, plain[:26]) {
+			t.Fatalf("size %d: ciphertext contains plaintext", size)
+		}
+
+		got, err := readAll(e, "f.bin")
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: read back %d bytes, %v", size, len(got), err)
+		}
+		info, err := e.Stat("f.bin")
+		if err != nil || info.Size() != int64(size) {
+			t.Fatalf("size %d: stat size = %v, %v", size, info, err)
+		}
+		infos, err := e.List("")
+		if err != nil || len(infos) != 1 || infos[0].Size() != int64(size) {
+			t.Fatalf("size %d: list = %v, %v", size, infos, err)
+		}
+	}
+
+	// 每个文件使用独立的数据密钥，相同内容的密文不同
+	WriteFile(e, "a.txt", []byte("same"))
+	WriteFile(e, "b.txt", []byte("same"))
+	a, _ := ReadFile(mem, "a.txt")
+	b, _ := ReadFile(mem, "b.txt")
+	if bytes.Equal(a, b) {
+		t.Fatal("identical plaintexts produced identical ciphertexts")
+	}
+
+	// 复制和重命名直接操作密文，结果仍可解密
+	if err := Copy(e, "a.txt", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Rename("b.txt", "d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "c.txt", "d.txt"} {
+		if got, err := ReadFile(e, name); err != nil || string(got) != "same" {
+			t.Fatalf("%s = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestEncryptedRangeReads(t *testing.T) {
+	e := newEncrypted(t, NewMemory(), newKey(t))
+	size := 3*encFrameSize + 100
+	plain := pattern(size)
+	if err := WriteFile(e, "f.bin", plain); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, 10},
+		{encFrameSize - 3, 10},               // 跨越第一、二帧
+		{encFrameSize, 1},                    // 第二帧开头
+		{2*encFrameSize - 1, 2},              // 跨越第二、三帧
+		{encFrameSize - 1, encFrameSize + 2}, // 跨越三帧
+		{3*encFrameSize - 5, 200},            // 跨越到最后一帧并超出文件末尾
+		{int64(size) - 1, 1},
+		{int64(size), 10}, // 从文件末尾开始
+		{int64(size) + 50, -1},
+		{100, -1},
+	}
+	for _, tt := range tests {
+		rc, err := e.OpenRange("f.bin", tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("OpenRange(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+
+		start := min(tt.offset, int64(size))
+		end := int64(size)
+		if tt.length >= 0 {
+			end = min(start+tt.length, int64(size))
+		}
+		if err != nil || !bytes.Equal(got, plain[start:end]) {
+			t.Fatalf("OpenRange(%d, %d) = %d bytes, %v, want %d bytes", tt.offset, tt.length, len(got), err, end-start)
+		}
+	}
+
+	// 随机读取和Seek
+	file, info, err := e.Open("f.bin")
+	if err != nil || info.Size() != int64(size) {
+		t.Fatalf("open: %v, %v", info, err)
+	}
+	defer file.Close()
+	buf := make([]byte, 8)
+	for _, off := range []int64{2*encFrameSize - 4, 5, encFrameSize - 4} {
+		if n, err := file.ReadAt(buf, off); err != nil || !bytes.Equal(buf[:n], plain[off:off+8]) {
+			t.Fatalf("ReadAt(%d) = %q, %v", off, buf[:n], err)
+		}
+	}
+	if n, err := file.ReadAt(buf, int64(size)-3); err != io.EOF || !bytes.Equal(buf[:n], plain[size-3:]) {
+		t.Fatalf("ReadAt near end = %q, %v", buf[:n], err)
+	}
+	if pos, err := file.Seek(-10, io.SeekEnd); err != nil || pos != int64(size)-10 {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	if rest, err := io.ReadAll(file); err != nil || !bytes.Equal(rest, plain[size-10:]) {
+		t.Fatalf("read after seek = %q, %v", rest, err)
+	}
+}
+
+// tamper 修改内层驱动中的密文
+func tamper(t *testing.T, mem *Memory, name string, fn func(raw []byte) []byte) {
+	t.Helper()
+	raw, err := ReadFile(mem, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(mem, name, fn(append([]byte(nil), raw...))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedDetectsTampering(t *testing.T) {
+	frame := encFrameSize + encTagSize
+	size := 3*encFrameSize + 100 // 三个完整帧加一个100字节的最后一帧
+
+	tests := []struct {
+		name    string
+		modify  func(raw []byte) []byte
+		wantErr error
+	}{
+		{"truncated inside last frame", func(raw []byte) []byte { return raw[:len(raw)-1] }, ErrCorrupted},
+		{"last frame removed", func(raw []byte) []byte { return raw[:encHeaderSize+3*frame] }, ErrCorrupted},
+		{"last two frames removed", func(raw []byte) []byte { return raw[:encHeaderSize+2*frame] }, ErrCorrupted},
+		{"truncated to a partial tag", func(raw []byte) []byte { return raw[:encHeaderSize+3*frame+encTagSize-1] }, ErrCorrupted},
+		{"truncated to header", func(raw []byte) []byte { return raw[:encHeaderSize] }, ErrCorrupted},
+		{"frames swapped", func(raw []byte) []byte {
+			first := append([]byte(nil), raw[encHeaderSize:encHeaderSize+frame]...)
+			copy(raw[encHeaderSize:], raw[encHeaderSize+frame:encHeaderSize+2*frame])
+			copy(raw[encHeaderSize+frame:], first)
+			return raw
+		}, ErrCorrupted},
+		{"frame duplicated", func(raw []byte) []byte {
+			body := raw[encHeaderSize:]
+			out := append([]byte(nil), raw[:encHeaderSize]...)
+			out = append(out, body[:frame]...)
+			return append(out, body...)
+		}, ErrCorrupted},
+		{"ciphertext bit flipped", func(raw []byte) []byte { raw[encHeaderSize+2*frame+10] ^= 1; return raw }, ErrCorrupted},
+		{"tag bit flipped", func(raw []byte) []byte { raw[len(raw)-1] ^= 1; return raw }, ErrCorrupted},
+		{"wrapped key bit flipped", func(raw []byte) []byte { raw[encHeaderSize-1] ^= 1; return raw }, ErrCorrupted},
+		{"unknown version", func(raw []byte) []byte { raw[4] = 2; return raw }, ErrCorrupted},
+		{"key id changed", func(raw []byte) []byte { raw[5] ^= 1; return raw }, ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemory()
+			e := newEncrypted(t, mem, newKey(t))
+			if err := WriteFile(e, "f.bin", pattern(size)); err != nil {
+				t.Fatal(err)
+			}
+			tamper(t, mem, "f.bin", tt.modify)
+
+			if _, err := readAll(e, "f.bin"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 帧在文件之间调换也会被发现：不同文件的数据密钥不同
+	mem := NewMemory()
+	e := newEncrypted(t, mem, newKey(t))
+	WriteFile(e, "a.bin", pattern(size))
+	WriteFile(e, "b.bin", pattern(size))
+	other, _ := ReadFile(mem, "b.bin")
+	tamper(t, mem, "a.bin", func(raw []byte) []byte {
+		copy(raw[encHeaderSize:], other[encHeaderSize:encHeaderSize+frame])
+		return raw
+	})
+	if _, err := readAll(e, "a.bin"); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("frame from another file: err = %v, want ErrCorrupted", err)
+	}
+}
+
+func TestEncryptedKeyRotation(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+	mem := NewMemory()
+	plain := pattern(2*encFrameSize + 5)
+
+	// 用旧主密钥写入加密文件，另有一个启用加密前的明文文件
+	if err := WriteFile(newEncrypted(t, mem, oldKey), "old.bin", plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(mem, "plain.txt", []byte("written before encryption")); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mem.Chtimes("old.bin", modTime)
+
+	// 只配置新主密钥时无法解开旧文件
+	if _, err := readAll(newEncrypted(t, mem, newKey), "old.bin"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("read with only the new key: err = %v, want ErrUnknownKey", err)
+	}
+
+	// 轮换期间同时配置新旧主密钥，两种文件都可读
+	rotating := newEncrypted(t, mem, newKey, oldKey)
+	if got, err := readAll(rotating, "old.bin"); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("read old file during rotation: %v", err)
+	}
+	if got, err := readAll(rotating, "plain.txt"); err != nil || string(got) != "written before encryption" {
+		t.Fatalf("read plaintext file = %q, %v", got, err)
+	}
+	before, _ := ReadFile(mem, "old.bin")
+
+	for _, name := range []string{"old.bin", "plain.txt"} {
+		if changed, err := rotating.Rewrap(name); err != nil || !changed {
+			t.Fatalf("rewrap %s = %v, %v", name, changed, err)
+		}
+		if changed, err := rotating.Rewrap(name); err != nil || changed {
+			t.Fatalf("second rewrap %s = %v, %v", name, changed, err)
+		}
+	}
+
+	// 只改写头部，数据帧保持不变，修改时间不变
+	after, _ := ReadFile(mem, "old.bin")
+	if len(after) != len(before) || !bytes.Equal(after[encHeaderSize:], before[encHeaderSize:]) || bytes.Equal(after[:encHeaderSize], before[:encHeaderSize]) {
+		t.Fatal("rewrap should replace only the header")
+	}
+	if info, _ := mem.Stat("old.bin"); !info.ModTime().Equal(modTime) {
+		t.Fatalf("modification time changed to %v", info.ModTime())
+	}
+	if raw, _ := ReadFile(mem, "plain.txt"); string(raw[:4]) != encMagic {
+		t.Fatal("plaintext file was not encrypted")
+	}
+
+	// 轮换完成后去掉旧主密钥仍然可读
+	current := newEncrypted(t, mem, newKey)
+	if got, err := readAll(current, "old.bin"); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("read after rotation: %v", err)
+	}
+	if got, err := readAll(current, "plain.txt"); err != nil || string(got) != "written before encryption" {
+		t.Fatalf("read encrypted plaintext file = %q, %v", got, err)
+	}
+	if _, err := readAll(newEncrypted(t, mem, oldKey), "old.bin"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("old key still opens the rotated file: %v", err)
+	}
+}
+
+func TestNewEncryptedRejectsBadKeys(t *testing.T) {
+	for _, key := range [][]byte{nil, make([]byte, 16), make([]byte, 33)} {
+		if _, err := NewEncrypted(NewMemory(), key); !errors.Is(err, ErrEncryptionKey) {
+			t.Fatalf("%d-byte key: err = %v", len(key), err)
+		}
+		if _, err := NewEncrypted(NewMemory(), make([]byte, 32), key); !errors.Is(err, ErrEncryptionKey) {
+			t.Fatalf("%d-byte previous key: err = %v", len(key), err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local 本地磁盘驱动，所有路径在解析符号链接后都必须位于根目录之内
+type Local struct {
+	root    string // 根目录的绝对路径
+	tempDir string // Write使用的临时目录，需与根目录位于同一文件系统，保证重命名是原子的
+}
+
+// NewLocal 创建本地磁盘驱动，根目录不存在时自动创建；tempDir为空时使用系统临时目录
+func NewLocal(root, tempDir string) (*Local, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	if tempDir != "" {
+		if tempDir, err = filepath.Abs(tempDir); err != nil {
+			return nil, err
+		}
+	}
+	return &Local{root: root, tempDir: tempDir}, nil
+}
+
+// Root 根目录的绝对路径
+func (l *Local) Root() string {
+	return l.root
+}
+
+func (l *Local) Stat(name string) (fs.FileInfo, error) {
+	full, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(full)
+}
+
+// List 返回的子项不跟随符号链接，调用方可据此跳过链接
+func (l *Local) List(name string) ([]fs.FileInfo, error) {
+	full, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (l *Local) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	file, _, err := l.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Open 打开文件句柄，目录返回ErrIsDir
+func (l *Local) Open(name string) (File, fs.FileInfo, error) {
+	full, err := l.path(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrIsDir)
+	}
+	return file, info, nil
+}
+
+// Write 先写入临时文件并同步到磁盘，再重命名到目标位置
+func (l *Local) Write(name string, r io.Reader) (int64, error) {
+	full, err := l.path(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return 0, err
+	}
+
+	dir := l.tempDir
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return 0, err
+		}
+	}
+	tmp, err := os.CreateTemp(dir, "write-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+	// 任何失败都不会在目标位置留下不完整的文件
+	defer os.Remove(tmpPath)
+
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		// CreateTemp创建的文件权限为0600，与直接创建的文件保持一致
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, full); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (l *Local) Rename(oldName, newName string) error {
+	oldFull, err := l.path(oldName)
+	if err != nil {
+		return err
+	}
+	newFull, err := l.path(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(newFull), 0755); err != nil {
+		return err
+	}
+	return os.Rename(oldFull, newFull)
+}
+
+func (l *Local) Remove(name string) error {
+	full, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if full == l.root {
+		return ErrInvalidName
+	}
+	return os.RemoveAll(full)
+}
+
+func (l *Local) MkdirAll(name string) error {
+	full, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, 0755)
+}
+
+// Copy 优先使用硬链接，上层的写入总是先写临时文件再重命名，不会原地修改，链接的两端互不影响
+func (l *Local) Copy(src, dst string) error {
+	srcFull, err := l.path(src)
+	if err != nil {
+		return err
+	}
+	dstFull, err := l.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstFull), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(srcFull, dstFull); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(srcFull)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = l.Write(dst, in)
+	return err
+}
+
+func (l *Local) Chtimes(name string, modTime time.Time) error {
+	full, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(full, modTime, modTime)
+}
+
+func (l *Local) RealPath(name string) (string, error) {
+	full, err := l.path(name)
+	if err != nil {
+		return "", err
+	}
+	return evalExistingSymlinks(full)
+}
+
+// path 将名称转换为根目录下的绝对路径，解析符号链接后仍不能指向根目录之外
+func (l *Local) path(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("%q: %w", name, ErrInvalidName)
+	}
+	full := filepath.Join(l.root, filepath.FromSlash(name))
+
+	realRoot, err := evalExistingSymlinks(l.root)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := evalExistingSymlinks(full)
+	if err != nil {
+		return "", err
+	}
+	if !WithinDir(realRoot, realPath) {
+		return "", ErrPathEscape
+	}
+	return full, nil
+}
+
+// WithinDir 判断本地路径path是否等于root或位于root之下，两者都应是已解析符号链接的路径
+func WithinDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// evalExistingSymlinks 解析路径中已存在部分的符号链接，不存在的部分原样拼接
+func evalExistingSymlinks(path string) (string, error) {
+	existing := path
+	var rest []string
+	for {
+		realPath, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(append([]string{realPath}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// 悬空的符号链接无法确定最终指向，写入时可能在目录外创建文件，直接拒绝
+		if _, err := os.Lstat(existing); err == nil {
+			return "", ErrPathEscape
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(existing)}, rest...)
+		existing = parent
+	}
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory 内存中的存储驱动，进程退出后数据丢失，用于测试
+// 行为与本地磁盘驱动保持一致：写入是原子的，重命名遵循os.Rename的规则
+type Memory struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode // 根目录不在其中
+}
+
+// memNode 内存中的文件或目录
+type memNode struct {
+	isDir   bool
+	data    []byte // 写入后不再修改，读取和复制时可以直接共享
+	modTime time.Time
+}
+
+// memRoot 根目录
+var memRoot = &memNode{isDir: true}
+
+// NewMemory 创建空的内存驱动
+func NewMemory() *Memory {
+	return &Memory{nodes: make(map[string]*memNode)}
+}
+
+func (m *Memory) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return memInfo(name, node), nil
+}
+
+func (m *Memory) List(name string) ([]fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("list", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isDir {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotDir)
+	}
+
+	var infos []fs.FileInfo
+	for key, child := range m.nodes {
+		if Dir(key) == name {
+			infos = append(infos, memInfo(key, child))
+		}
+	}
+	sortInfos(infos)
+	return infos, nil
+}
+
+func (m *Memory) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	file, _, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Open 打开文件用于随机读取，目录返回ErrIsDir
+func (m *Memory) Open(name string) (File, fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("open", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if node.isDir {
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrIsDir)
+	}
+	return memFile{bytes.NewReader(node.data)}, memInfo(name, node), nil
+}
+
+// Write 读完全部数据后才替换目标，读取出错时不会留下不完整的文件
+func (m *Memory) Write(name string, r io.Reader) (int64, error) {
+	if name == "" || !ValidName(name) {
+		return 0, ErrInvalidName
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, ok := m.nodes[name]; ok && node.isDir {
+		return 0, fmt.Errorf("%s: %w", name, ErrIsDir)
+	}
+	if err := m.mkdirAll(Dir(name)); err != nil {
+		return 0, err
+	}
+	m.nodes[name] = &memNode{data: data, modTime: time.Now()}
+	return int64(len(data)), nil
+}
+
+func (m *Memory) Rename(oldName, newName string) error {
+	if oldName == "" || newName == "" || !ValidName(newName) {
+		return ErrInvalidName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("rename", oldName)
+	if err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+	if node.isDir && strings.HasPrefix(newName, oldName+"/") {
+		return fmt.Errorf("%s: %w", newName, ErrInvalidName)
+	}
+
+	// 已存在的目标：文件可以替换文件，空目录可以替换为目录
+	if target, ok := m.nodes[newName]; ok {
+		switch {
+		case node.isDir && !target.isDir:
+			return fmt.Errorf("%s: %w", newName, ErrNotDir)
+		case !node.isDir && target.isDir:
+			return fmt.Errorf("%s: %w", newName, ErrIsDir)
+		case target.isDir && m.hasChildren(newName):
+			return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+		}
+	}
+	if err := m.mkdirAll(Dir(newName)); err != nil {
+		return err
+	}
+
+	delete(m.nodes, oldName)
+	m.nodes[newName] = node
+	if node.isDir {
+		prefix := oldName + "/"
+		for key, child := range m.nodes {
+			if strings.HasPrefix(key, prefix) {
+				delete(m.nodes, key)
+				m.nodes[newName+"/"+key[len(prefix):]] = child
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	if name == "" || !ValidName(name) {
+		return ErrInvalidName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.nodes, name)
+	prefix := name + "/"
+	for key := range m.nodes {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.nodes, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) MkdirAll(name string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(name)
+}
+
+// Copy 复制出的文件与源文件共享数据
+func (m *Memory) Copy(src, dst string) error {
+	if dst == "" || !ValidName(dst) {
+		return ErrInvalidName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("copy", src)
+	if err != nil {
+		return err
+	}
+	if node.isDir {
+		return fmt.Errorf("%s: %w", src, ErrIsDir)
+	}
+	if target, ok := m.nodes[dst]; ok && target.isDir {
+		return fmt.Errorf("%s: %w", dst, ErrIsDir)
+	}
+	if err := m.mkdirAll(Dir(dst)); err != nil {
+		return err
+	}
+	m.nodes[dst] = &memNode{data: node.data, modTime: time.Now()}
+	return nil
+}
+
+func (m *Memory) Chtimes(name string, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if node != memRoot {
+		node.modTime = modTime
+	}
+	return nil
+}
+
+// lookup 查找文件或目录，调用方需持有锁
+func (m *Memory) lookup(op, name string) (*memNode, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	if name == "" {
+		return memRoot, nil
+	}
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// mkdirAll 依次创建name及其父目录，路径上存在同名文件时返回ErrNotDir，调用方需持有锁
+func (m *Memory) mkdirAll(name string) error {
+	if name == "" {
+		return nil
+	}
+	if node, ok := m.nodes[name]; ok {
+		if !node.isDir {
+			return fmt.Errorf("%s: %w", name, ErrNotDir)
+		}
+		return nil
+	}
+	if err := m.mkdirAll(Dir(name)); err != nil {
+		return err
+	}
+	m.nodes[name] = &memNode{isDir: true, modTime: time.Now()}
+	return nil
+}
+
+// hasChildren 目录是否非空，调用方需持有锁
+func (m *Memory) hasChildren(name string) bool {
+	prefix := name + "/"
+	for key := range m.nodes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// memInfo 生成文件信息
+func memInfo(name string, node *memNode) fs.FileInfo {
+	return &fileInfo{
+		name:    path.Base("/" + name),
+		size:    int64(len(node.data)),
+		modTime: node.modTime,
+		isDir:   node.isDir,
+	}
+}
+
+// memFile 内存文件的只读句柄
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
@@ -0,0 +1,639 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize 分段上传每段的大小，小于该大小的文件一次上传；S3要求除最后一段外每段至少5MB
+const s3PartSize = 8 << 20
+
+// S3不允许用一个CopyObject请求复制超过5GB的对象，更大的对象按s3CopyPartSize分段复制（UploadPartCopy）
+// 声明为变量以便测试中调小
+var (
+	s3MaxCopySize  int64 = 5 << 30
+	s3CopyPartSize int64 = 512 << 20
+)
+
+// s3Part 分段上传中已上传的一段
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// S3Options S3兼容对象存储的连接参数
+type S3Options struct {
+	Endpoint        string        // 服务地址，如https://s3.us-east-1.amazonaws.com或http://127.0.0.1:9000
+	Region          string        // 区域，用于签名
+	Bucket          string        // 存储桶
+	Prefix          string        // 对象键前缀，为空时使用整个存储桶
+	AccessKeyID     string        // 为空时匿名访问
+	SecretAccessKey string        //
+	PathStyle       bool          // 使用endpoint/bucket/key形式的地址（MinIO等需要），否则使用bucket.endpoint/key
+	Timeout         time.Duration // 连接和等待响应头的超时，不限制传输大文件的时间
+}
+
+// S3 S3兼容对象存储驱动
+// 对象存储没有真正的目录：以/结尾的空对象作为目录标记，键中包含的前缀也视为目录
+type S3 struct {
+	opts     S3Options
+	endpoint *url.URL
+	prefix   string
+	client   *http.Client
+}
+
+// NewS3 创建S3驱动，不会连接服务器
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, errors.New("storage: s3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: opts.Timeout}).DialContext
+	transport.ResponseHeaderTimeout = opts.Timeout
+	return &S3{
+		opts:     opts,
+		endpoint: endpoint,
+		prefix:   prefix,
+		client:   &http.Client{Transport: transport},
+	}, nil
+}
+
+func (s *S3) Stat(name string) (fs.FileInfo, error) {
+	if name == "" {
+		return &fileInfo{name: ".", isDir: true}, nil
+	}
+
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &fileInfo{name: baseName(name), size: resp.ContentLength, modTime: modTime}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// 不存在同名对象时，以其为前缀的对象存在即为目录
+	page, err := s.listPage(s.key(name)+"/", "/", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Contents) == 0 && len(page.CommonPrefixes) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	info := &fileInfo{name: baseName(name), isDir: true}
+	if len(page.Contents) > 0 && page.Contents[0].Key == s.key(name)+"/" {
+		info.modTime = page.Contents[0].LastModified
+	}
+	return info, nil
+}
+
+func (s *S3) List(name string) ([]fs.FileInfo, error) {
+	prefix := s.dirPrefix(name)
+
+	var infos []fs.FileInfo
+	found := false
+	token := ""
+	for {
+		page, err := s.listPage(prefix, "/", token, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			found = true
+			if obj.Key == prefix {
+				continue // 目录标记
+			}
+			infos = append(infos, &fileInfo{
+				name:    strings.TrimPrefix(obj.Key, prefix),
+				size:    obj.Size,
+				modTime: obj.LastModified,
+			})
+		}
+		for _, p := range page.CommonPrefixes {
+			found = true
+			infos = append(infos, &fileInfo{
+				name:  strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"),
+				isDir: true,
+			})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	if !found && name != "" {
+		info, err := s.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s: %w", name, ErrNotDir)
+		}
+	}
+	sortInfos(infos)
+	return infos, nil
+}
+
+func (s *S3) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	header := http.Header{}
+	switch {
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.do(http.MethodGet, s.key(name), nil, header, nil)
+	if err != nil {
+		// 从文件末尾开始读取
+		var s3Err *S3Error
+		if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Write 小文件一次上传，大文件分段上传，内存中最多缓存一段数据
+func (s *S3) Write(name string, r io.Reader) (int64, error) {
+	if name == "" {
+		return 0, ErrInvalidName
+	}
+	key := s.key(name)
+
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if err := s.putObject(key, buf[:n]); err != nil {
+			return 0, err
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID, err := s.createMultipartUpload(key)
+	if err != nil {
+		return 0, err
+	}
+	total, err := s.uploadParts(key, uploadID, buf, r)
+	if err != nil {
+		s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return 0, err
+	}
+	return total, nil
+}
+
+// uploadParts 依次上传各段并完成分段上传，first为已读取的第一段
+func (s *S3) uploadParts(key, uploadID string, first []byte, r io.Reader) (int64, error) {
+	var parts []s3Part
+	var total int64
+
+	data := first
+	for number := 1; len(data) > 0; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(http.MethodPut, key, query, nil, data)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		parts = append(parts, s3Part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		total += int64(len(data))
+
+		buf := make([]byte, s3PartSize)
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		data = buf[:n]
+	}
+
+	if err := s.completeMultipartUpload(key, uploadID, parts); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Rename 对象存储不能重命名，复制到新位置后删除原对象，目录下的每个对象都需要复制
+func (s *S3) Rename(oldName, newName string) error {
+	if oldName == "" || newName == "" {
+		return ErrInvalidName
+	}
+	info, err := s.Stat(oldName)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := s.copyObject(s.key(oldName), s.key(newName), info.Size()); err != nil {
+			return err
+		}
+		if err := s.deleteObject(s.key(oldName)); err != nil {
+			return err
+		}
+		return s.keepParent(oldName)
+	}
+
+	oldPrefix, newPrefix := s.dirPrefix(oldName), s.dirPrefix(newName)
+	objects, err := s.listAll(oldPrefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.copyObject(obj.Key, newPrefix+strings.TrimPrefix(obj.Key, oldPrefix), obj.Size); err != nil {
+			return err
+		}
+	}
+	// 空目录只有目录标记，确保移动后目录仍然存在
+	if err := s.putObject(newPrefix, nil); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.deleteObject(obj.Key); err != nil {
+			return err
+		}
+	}
+	return s.keepParent(oldName)
+}
+
+func (s *S3) Remove(name string) error {
+	if name == "" {
+		return ErrInvalidName
+	}
+
+	removed := false
+	if resp, err := s.do(http.MethodHead, s.key(name), nil, nil, nil); err == nil {
+		resp.Body.Close()
+		if err := s.deleteObject(s.key(name)); err != nil {
+			return err
+		}
+		removed = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	objects, err := s.listAll(s.dirPrefix(name))
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.deleteObject(obj.Key); err != nil {
+			return err
+		}
+		removed = true
+	}
+
+	if !removed {
+		return nil
+	}
+	return s.keepParent(name)
+}
+
+func (s *S3) MkdirAll(name string) error {
+	if name == "" {
+		return nil
+	}
+	if resp, err := s.do(http.MethodHead, s.key(name), nil, nil, nil); err == nil {
+		resp.Body.Close()
+		return fmt.Errorf("%s: %w", name, ErrNotDir)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.putObject(s.dirPrefix(name), nil)
+}
+
+// Copy 在服务端复制对象，不经过本进程传输数据
+func (s *S3) Copy(src, dst string) error {
+	if src == "" || dst == "" {
+		return ErrInvalidName
+	}
+	resp, err := s.do(http.MethodHead, s.key(src), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return s.copyObject(s.key(src), s.key(dst), resp.ContentLength)
+}
+
+// keepParent 删除或移走目录中的最后一个对象后，前缀随之消失，写入目录标记让父目录继续存在
+func (s *S3) keepParent(name string) error {
+	parent := Dir(name)
+	if parent == "" {
+		return nil
+	}
+	return s.putObject(s.dirPrefix(parent), nil)
+}
+
+// key 名称对应的对象键
+func (s *S3) key(name string) string {
+	return s.prefix + name
+}
+
+// dirPrefix 目录下对象的键前缀，也是目录标记的键
+func (s *S3) dirPrefix(name string) string {
+	if name == "" {
+		return s.prefix
+	}
+	return s.prefix + name + "/"
+}
+
+func (s *S3) putObject(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// copyObject 在服务端复制对象，size为源对象大小，超过s3MaxCopySize时分段复制
+func (s *S3) copyObject(srcKey, dstKey string, size int64) error {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", "/"+s.opts.Bucket+"/"+awsEscape(srcKey, true))
+	if size <= s3MaxCopySize {
+		resp, err := s.do(http.MethodPut, dstKey, nil, header, nil)
+		if err != nil {
+			return err
+		}
+		return readResultError(resp)
+	}
+
+	uploadID, err := s.createMultipartUpload(dstKey)
+	if err != nil {
+		return err
+	}
+	if err := s.copyParts(dstKey, uploadID, header, size); err != nil {
+		s.do(http.MethodDelete, dstKey, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return err
+	}
+	return nil
+}
+
+// copyParts 按区间依次复制源对象的各段并完成分段上传，header中带有复制源
+func (s *S3) copyParts(key, uploadID string, header http.Header, size int64) error {
+	var parts []s3Part
+	for number, offset := 1, int64(0); offset < size; number, offset = number+1, offset+s3CopyPartSize {
+		end := min(offset+s3CopyPartSize, size) - 1
+		header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(http.MethodPut, key, query, header, nil)
+		if err != nil {
+			return err
+		}
+
+		// 复制成功时ETag在响应体中，出错时也可能返回200，响应体是<Error>
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		var result struct {
+			XMLName xml.Name
+			ETag    string `xml:"ETag"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return err
+		}
+		if result.XMLName.Local != "CopyPartResult" {
+			s3Err := &S3Error{StatusCode: http.StatusInternalServerError}
+			xml.Unmarshal(data, s3Err)
+			return s3Err
+		}
+		parts = append(parts, s3Part{PartNumber: number, ETag: result.ETag})
+	}
+	return s.completeMultipartUpload(key, uploadID, parts)
+}
+
+// completeMultipartUpload 按段号顺序合并已上传的各段
+func (s *S3) completeMultipartUpload(key, uploadID string, parts []s3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	// 完成分段上传时出错也可能返回200，错误在响应体中
+	return readResultError(resp)
+}
+
+func (s *S3) deleteObject(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) createMultipartUpload(key string) (string, error) {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", errors.New("storage: s3 returned empty upload id")
+	}
+	return result.UploadID, nil
+}
+
+// s3Content ListObjectsV2列出的对象
+type s3Content struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// listBucketResult ListObjectsV2的响应
+type listBucketResult struct {
+	Contents       []s3Content `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) listPage(prefix, delimiter, token string, maxKeys int) (*listBucketResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"max-keys":  {strconv.Itoa(maxKeys)},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+
+	resp, err := s.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// listAll 列出前缀下的所有对象，不按目录分组
+func (s *S3) listAll(prefix string) ([]s3Content, error) {
+	var objects []s3Content
+	token := ""
+	for {
+		page, err := s.listPage(prefix, "", token, 1000)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do 发送签名后的请求，key为空时请求存储桶本身；非2xx响应转换为*S3Error
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := &url.URL{Scheme: s.endpoint.Scheme, Host: s.endpoint.Host}
+	if s.opts.PathStyle {
+		u.Path = "/" + s.opts.Bucket
+	} else {
+		u.Host = s.opts.Bucket + "." + s.endpoint.Host
+	}
+	if key != "" || !s.opts.PathStyle {
+		u.Path += "/" + key
+	}
+	u.RawPath = awsEscape(u.Path, true)
+	u.RawQuery = canonicalQueryString(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	signV4(req, s.opts.AccessKeyID, s.opts.SecretAccessKey, s.opts.Region, hashHex(body), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, parseS3Error(resp)
+	}
+	return resp, nil
+}
+
+// S3Error 对象存储返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("storage: s3 %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap 对象不存在时满足errors.Is(err, fs.ErrNotExist)
+func (e *S3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+func parseS3Error(resp *http.Response) error {
+	s3Err := &S3Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, s3Err) != nil || s3Err.Code == "" {
+		s3Err.Code = http.StatusText(resp.StatusCode)
+	}
+	return s3Err
+}
+
+// readResultError 读取并关闭响应体，响应体是<Error>时返回错误
+func readResultError(resp *http.Response) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	var probe struct {
+		XMLName xml.Name
+	}
+	if xml.Unmarshal(data, &probe) == nil && probe.XMLName.Local == "Error" {
+		s3Err := &S3Error{StatusCode: http.StatusInternalServerError}
+		xml.Unmarshal(data, s3Err)
+		return s3Err
+	}
+	return nil
+}
+
+// baseName 名称的最后一段
+func baseName(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,342 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/storage"
+	"io"
+	"io/fs"
+	"net/http"
+	"testing"
+)
+
+const (
+	testBucket    = "drive"
+	testAccessKey = "test-access"
+	testSecretKey = "test-secret"
+)
+
+// newS3 启动校验签名的内存S3服务，返回连接它的驱动
+func newS3(t *testing.T, accessKey, secretKey string) *storage.S3 {
+	t.Helper()
+	server := storage.NewS3Server(testBucket, testAccessKey, testSecretKey)
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	s, err := storage.NewS3(storage.S3Options{
+		Endpoint:        server.URL(),
+		Bucket:          testBucket,
+		Prefix:          "/drive-data/",
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func writeFile(t *testing.T, s storage.Storage, name, content string) {
+	t.Helper()
+	if err := storage.WriteFile(s, name, []byte(content)); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func readFile(t *testing.T, s storage.Storage, name string) string {
+	t.Helper()
+	data, err := storage.ReadFile(s, name)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+// listNames 列出目录，目录名后加/
+func listNames(t *testing.T, s storage.Storage, name string) []string {
+	t.Helper()
+	infos, err := s.List(name)
+	if err != nil {
+		t.Fatalf("list %s: %v", name, err)
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name()+"/")
+		} else {
+			names = append(names, info.Name())
+		}
+	}
+	return names
+}
+
+func assertNames(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("names = %q, want %q", got, want)
+	}
+}
+
+func TestS3ReadWrite(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+
+	// 键中的空格、加号、百分号和非ASCII字符需要按SigV4规则编码，否则签名校验失败
+	names := []string{"a.txt", "docs/a b+c%20.txt", "文档/报告 (1).txt", "x/y/z/~tilde=eq&amp.txt"}
+	for _, name := range names {
+		writeFile(t, s, name, "content of "+name)
+		if got := readFile(t, s, name); got != "content of "+name {
+			t.Fatalf("%s = %q", name, got)
+		}
+		info, err := s.Stat(name)
+		if err != nil || info.IsDir() || info.Size() != int64(len("content of "+name)) || info.ModTime().IsZero() {
+			t.Fatalf("stat %s = %v, %v", name, info, err)
+		}
+	}
+
+	// 覆盖写入和空文件
+	writeFile(t, s, "a.txt", "")
+	if got := readFile(t, s, "a.txt"); got != "" {
+		t.Fatalf("empty file = %q", got)
+	}
+
+	if _, err := s.Stat("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat missing: %v", err)
+	}
+	if _, err := s.OpenRange("missing.txt", 0, -1); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("open missing: %v", err)
+	}
+	if _, err := s.Write("", bytes.NewReader(nil)); !errors.Is(err, storage.ErrInvalidName) {
+		t.Fatalf("write root: %v", err)
+	}
+}
+
+func TestS3OpenRange(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+	writeFile(t, s, "digits.txt", "0123456789")
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{3, -1, "3456789"},
+		{2, 3, "234"},
+		{8, 10, "89"},
+		{9, 1, "9"},
+		{10, -1, ""}, // 从文件末尾开始读取
+		{4, 0, ""},
+	}
+	for _, tt := range tests {
+		rc, err := s.OpenRange("digits.txt", tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("OpenRange(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(data) != tt.want {
+			t.Fatalf("OpenRange(%d, %d) = %q, %v, want %q", tt.offset, tt.length, data, err, tt.want)
+		}
+	}
+
+	// 通过Open得到的文件可以随机读取
+	file, info, err := storage.Open(s, "digits.txt")
+	if err != nil || info.Size() != 10 {
+		t.Fatalf("open: %v, %v", info, err)
+	}
+	defer file.Close()
+	buf := make([]byte, 4)
+	if n, err := file.ReadAt(buf, 5); err != nil || string(buf[:n]) != "5678" {
+		t.Fatalf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if _, err := file.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(file); err != nil || string(rest) != "789" {
+		t.Fatalf("read after seek = %q, %v", rest, err)
+	}
+}
+
+func TestS3Directories(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+
+	writeFile(t, s, "docs/b.txt", "b")
+	writeFile(t, s, "docs/a.txt", "a")
+	writeFile(t, s, "docs/sub/c.txt", "c")
+	if err := s.MkdirAll("empty/nested"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertNames(t, listNames(t, s, ""), "docs/", "empty/")
+	assertNames(t, listNames(t, s, "docs"), "a.txt", "b.txt", "sub/")
+	assertNames(t, listNames(t, s, "empty"), "nested/")
+	assertNames(t, listNames(t, s, "empty/nested"))
+
+	// 只由键前缀形成的目录
+	if info, err := s.Stat("docs/sub"); err != nil || !info.IsDir() {
+		t.Fatalf("stat implicit dir: %v, %v", info, err)
+	}
+	if info, err := s.Stat(""); err != nil || !info.IsDir() {
+		t.Fatalf("stat root: %v, %v", info, err)
+	}
+
+	if _, err := s.List("docs/a.txt"); !errors.Is(err, storage.ErrNotDir) {
+		t.Fatalf("list file: %v", err)
+	}
+	if _, err := s.List("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("list missing: %v", err)
+	}
+	if err := s.MkdirAll("docs/a.txt"); !errors.Is(err, storage.ErrNotDir) {
+		t.Fatalf("mkdir over file: %v", err)
+	}
+}
+
+func TestS3ListPagination(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+
+	// 超过一页（1000个）的目录需要按continuation-token翻页
+	const n = 1005
+	for i := 0; i < n; i++ {
+		writeFile(t, s, fmt.Sprintf("many/%04d.txt", i), "x")
+	}
+	names := listNames(t, s, "many")
+	if len(names) != n || names[0] != "0000.txt" || names[n-1] != fmt.Sprintf("%04d.txt", n-1) {
+		t.Fatalf("listed %d entries", len(names))
+	}
+
+	if err := s.Remove("many"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("many"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("directory still exists after remove: %v", err)
+	}
+}
+
+func TestS3RenameCopyRemove(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+
+	writeFile(t, s, "src/a.txt", "a")
+	writeFile(t, s, "src/sub/b.txt", "b")
+	if err := s.MkdirAll("src/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重命名文件后原目录仍然存在
+	if err := s.Rename("src/a.txt", "src/renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, listNames(t, s, "src"), "empty/", "renamed.txt", "sub/")
+
+	// 移走目录中唯一的文件，父目录不能随之消失
+	if err := s.Rename("src/sub/b.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, listNames(t, s, "src/sub"))
+
+	// 重命名目录会移动其中的所有对象，包括空目录
+	if err := s.Rename("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("src still exists: %v", err)
+	}
+	assertNames(t, listNames(t, s, "dst"), "empty/", "renamed.txt", "sub/")
+	if got := readFile(t, s, "dst/renamed.txt"); got != "a" {
+		t.Fatalf("renamed content = %q", got)
+	}
+
+	// 服务端复制
+	if err := storage.Copy(s, "b.txt", "dst/sub/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, s, "dst/sub/copy.txt"); got != "b" || readFile(t, s, "b.txt") != "b" {
+		t.Fatalf("copy = %q", got)
+	}
+	if err := s.Copy("missing.txt", "x.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("copy missing: %v", err)
+	}
+
+	// 删除文件后父目录仍然存在，删除目录会删除其中所有对象
+	if err := s.Remove("dst/sub/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, listNames(t, s, "dst/sub"))
+	if err := s.Remove("dst"); err != nil {
+		t.Fatal(err)
+	}
+	assertNames(t, listNames(t, s, ""), "b.txt")
+
+	// 删除不存在的名称不报错
+	if err := s.Remove("missing"); err != nil {
+		t.Fatalf("remove missing: %v", err)
+	}
+	if err := s.Rename("missing", "x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("rename missing: %v", err)
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	s := newS3(t, testAccessKey, testSecretKey)
+
+	// 超过一段（8MB）的文件分段上传，最后一段不足一段
+	data := make([]byte, 17<<20+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	n, err := s.Write("big.bin", bytes.NewReader(data))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	got, err := storage.ReadFile(s, "big.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read back %d bytes, %v", len(got), err)
+	}
+
+	// 跨越段边界的范围读取
+	rc, err := s.OpenRange("big.bin", 8<<20-5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	part, _ := io.ReadAll(rc)
+	if !bytes.Equal(part, data[8<<20-5:8<<20+5]) {
+		t.Fatalf("range across parts = %v", part)
+	}
+}
+
+func TestS3SignatureRejected(t *testing.T) {
+	tests := []struct {
+		name                 string
+		accessKey, secretKey string
+		code                 string
+	}{
+		{"wrong secret", testAccessKey, "wrong-secret", "SignatureDoesNotMatch"},
+		{"unknown access key", "other-access", testSecretKey, "InvalidAccessKeyId"},
+		{"anonymous", "", "", "InvalidAccessKeyId"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newS3(t, tt.accessKey, tt.secretKey)
+			for _, err := range []error{
+				storage.WriteFile(s, "a.txt", []byte("a")),
+				func() error { _, err := s.List(""); return err }(),
+			} {
+				var s3Err *storage.S3Error
+				if !errors.As(err, &s3Err) || s3Err.Code != tt.code {
+					t.Fatalf("err = %v, want %s", err, tt.code)
+				}
+			}
+
+			// HEAD的响应没有错误详情，但签名错误不能被当作文件不存在
+			_, err := s.Stat("a.txt")
+			var s3Err *storage.S3Error
+			if !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusForbidden || errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("stat: err = %v, want 403", err)
+			}
+		})
+	}
+}
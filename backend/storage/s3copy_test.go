@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestS3MultipartCopy 调小复制上限，验证超过上限的对象分段复制，而模拟服务拒绝单次复制
+func TestS3MultipartCopy(t *testing.T) {
+	maxCopySize, copyPartSize := s3MaxCopySize, s3CopyPartSize
+	s3MaxCopySize, s3CopyPartSize = 1000, 300
+	t.Cleanup(func() { s3MaxCopySize, s3CopyPartSize = maxCopySize, copyPartSize })
+
+	server := NewS3Server("drive", "test-access", "test-secret")
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	s, err := NewS3(S3Options{
+		Endpoint:        server.URL(),
+		Bucket:          "drive",
+		AccessKeyID:     "test-access",
+		SecretAccessKey: "test-secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 250)
+	if err := WriteFile(s, "big.bin", data); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟服务与S3一样拒绝单次复制超过上限的对象
+	var s3Err *S3Error
+	if err := s.copyObject("big.bin", "direct.bin", 0); !errors.As(err, &s3Err) || s3Err.Code != "InvalidRequest" {
+		t.Fatalf("single copy of a large object: %v", err)
+	}
+
+	if err := s.Copy("big.bin", "copy.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename("copy.bin", "dir/moved.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename("dir", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"big.bin", "renamed/moved.bin"} {
+		got, err := ReadFile(s, name)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: %d bytes, %v", name, len(got), err)
+		}
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.uploads) != 0 {
+		t.Fatalf("%d multipart uploads left open", len(server.uploads))
+	}
+}
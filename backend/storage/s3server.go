@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Server 内存中的S3兼容服务，用于本地开发和测试对象存储驱动
+// 只支持路径风格的地址和驱动用到的接口：对象的读写删除、服务端复制、ListObjectsV2、分段上传和分段复制
+// 与S3一样，单次复制的对象和分段复制的每段不能超过5GB
+// 设置了访问密钥时校验SigV4签名和请求体的SHA-256
+type S3Server struct {
+	bucket    string
+	accessKey string
+	secretKey string
+	listener  net.Listener
+	server    *http.Server
+	objects   map[string]*s3Object
+	uploads   map[string]map[int][]byte // 分段上传ID -> 段号 -> 数据
+	mu        sync.Mutex
+}
+
+type s3Object struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewS3Server 创建只有一个空存储桶的服务，accessKey为空时不校验签名
+func NewS3Server(bucket, accessKey, secretKey string) *S3Server {
+	return &S3Server{
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		objects:   make(map[string]*s3Object),
+		uploads:   make(map[string]map[int][]byte),
+	}
+}
+
+// Listen 在addr上监听并在后台处理请求，addr为127.0.0.1:0时使用随机端口
+func (s *S3Server) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// URL 服务地址，如http://127.0.0.1:9000
+func (s *S3Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// Close 停止服务并断开所有连接
+func (s *S3Server) Close() error {
+	return s.server.Close()
+}
+
+func (s *S3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, message := s.authenticate(r, body); code != "" {
+		writeS3Error(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.list(w, query)
+	case key == "":
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "bucket operation not supported")
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("%d", time.Now().UnixNano())
+		s.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: s.bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		}
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			s.copyPart(w, parts, number, source, r.Header.Get("X-Amz-Copy-Source-Range"))
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", `"`+hashHex(body)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, key, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copy(w, key, r.Header.Get("X-Amz-Copy-Source"))
+	case r.Method == http.MethodPut:
+		s.objects[key] = &s3Object{data: body, modTime: time.Now()}
+		w.Header().Set("ETag", `"`+hashHex(body)+`"`)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.get(w, r, key)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// authenticate 校验签名，返回错误码和说明，通过时错误码为空
+func (s *S3Server) authenticate(r *http.Request, body []byte) (string, string) {
+	if s.accessKey == "" {
+		return "", ""
+	}
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" ")
+	fields := make(map[string]string)
+	for _, part := range strings.Split(auth, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			fields[k] = v
+		}
+	}
+	credential := strings.SplitN(fields["Credential"], "/", 5)
+	if len(credential) != 5 || credential[0] != s.accessKey {
+		return "InvalidAccessKeyId", "The access key does not exist"
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || time.Since(signedAt).Abs() > 15*time.Minute {
+		return "RequestTimeTooSkewed", "The request time is too far from the server time"
+	}
+	scope := strings.Join(credential[1:], "/")
+	if credential[1] != amzDate[:8] {
+		return "SignatureDoesNotMatch", "credential date does not match x-amz-date"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != unsignedPayload && payloadHash != hashHex(body) {
+		return "XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 does not match the body"
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	headers := make(map[string]string)
+	for _, name := range signed {
+		if name == "host" {
+			headers[name] = r.Host
+		} else {
+			headers[name] = strings.Join(r.Header.Values(name), ",")
+		}
+	}
+	canonical := canonicalRequest(r.Method, r.URL.EscapedPath(), canonicalQueryString(r.URL.Query()), headers, signed, payloadHash)
+	expected := v4Signature(s.secretKey, credential[2], amzDate, scope, canonical)
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided"
+	}
+	return "", ""
+}
+
+// get 返回对象内容，支持bytes=a-b和bytes=a-形式的Range
+func (s *S3Server) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := s.objects[key]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+		return
+	}
+
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", `"`+hashHex(obj.data)+`"`)
+	data := obj.data
+	status := http.StatusOK
+	if spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+		first, last, _ := strings.Cut(spec, "-")
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start >= int64(len(data)) {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		end := int64(len(data)) - 1
+		if last != "" {
+			if e, err := strconv.ParseInt(last, 10, 64); err == nil && e < end {
+				end = e
+			}
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (s *S3Server) copy(w http.ResponseWriter, key, source string) {
+	obj, ok := s.copySource(w, source)
+	if !ok {
+		return
+	}
+	if int64(len(obj.data)) > s3MaxCopySize {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("The specified copy source is larger than the maximum allowable size for a copy source: %d", s3MaxCopySize))
+		return
+	}
+
+	now := time.Now()
+	s.objects[key] = &s3Object{data: obj.data, modTime: now}
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{LastModified: now.UTC().Format(time.RFC3339), ETag: `"` + hashHex(obj.data) + `"`})
+}
+
+// copyPart UploadPartCopy，复制源对象的一个区间作为分段上传的一段，rangeSpec为空时复制整个对象
+func (s *S3Server) copyPart(w http.ResponseWriter, parts map[int][]byte, number int, source, rangeSpec string) {
+	obj, ok := s.copySource(w, source)
+	if !ok {
+		return
+	}
+
+	data := obj.data
+	if spec, ok := strings.CutPrefix(rangeSpec, "bytes="); ok {
+		first, last, _ := strings.Cut(spec, "-")
+		start, err1 := strconv.ParseInt(first, 10, 64)
+		end, err2 := strconv.ParseInt(last, 10, 64)
+		if err1 != nil || err2 != nil || start > end || end >= int64(len(data)) {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+			return
+		}
+		data = data[start : end+1]
+	} else if rangeSpec != "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source range")
+		return
+	}
+	if int64(len(data)) > s3MaxCopySize {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("The specified copy source is larger than the maximum allowable size for a copy source: %d", s3MaxCopySize))
+		return
+	}
+
+	parts[number] = data
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyPartResult"`
+		LastModified string   `xml:"LastModified"`
+		ETag         string   `xml:"ETag"`
+	}{LastModified: time.Now().UTC().Format(time.RFC3339), ETag: `"` + hashHex(data) + `"`})
+}
+
+// copySource 查找X-Amz-Copy-Source指定的源对象，找不到时已写入错误响应
+func (s *S3Server) copySource(w http.ResponseWriter, source string) (*s3Object, bool) {
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return nil, false
+	}
+	bucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	obj, ok := s.objects[srcKey]
+	if bucket != s.bucket || !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+		return nil, false
+	}
+	return obj, true
+}
+
+func (s *S3Server) completeUpload(w http.ResponseWriter, key, id string, body []byte) {
+	parts, ok := s.uploads[id]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", "invalid CompleteMultipartUpload body")
+		return
+	}
+
+	var data []byte
+	for i, part := range req.Parts {
+		chunk, ok := parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 {
+			writeS3Error(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+			return
+		}
+		data = append(data, chunk...)
+	}
+	s.objects[key] = &s3Object{data: data, modTime: time.Now()}
+	delete(s.uploads, id)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+	}{Bucket: s.bucket, Key: key})
+}
+
+// list ListObjectsV2，continuation-token是下一页第一项的序号
+func (s *S3Server) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+	if err != nil || maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// 对象和公共前缀按键的顺序排在一起分页
+	type item struct {
+		key      string
+		isPrefix bool
+	}
+	var items []item
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if !seen[common] {
+					seen[common] = true
+					items = append(items, item{common, true})
+				}
+				continue
+			}
+		}
+		items = append(items, item{key, false})
+	}
+
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	if start < 0 || start > len(items) {
+		start = len(items)
+	}
+	end := min(start+maxKeys, len(items))
+
+	type content struct {
+		Key          string `xml:"Key"`
+		Size         int    `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	}
+	type commonPrefix struct {
+		Prefix string `xml:"Prefix"`
+	}
+	result := struct {
+		XMLName               xml.Name       `xml:"ListBucketResult"`
+		Name                  string         `xml:"Name"`
+		Prefix                string         `xml:"Prefix"`
+		KeyCount              int            `xml:"KeyCount"`
+		IsTruncated           bool           `xml:"IsTruncated"`
+		NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}{Name: s.bucket, Prefix: prefix, KeyCount: end - start, IsTruncated: end < len(items)}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	for _, it := range items[start:end] {
+		if it.isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{it.key})
+			continue
+		}
+		obj := s.objects[it.key]
+		result.Contents = append(result.Contents, content{
+			Key:          it.key,
+			Size:         len(obj.data),
+			LastModified: obj.modTime.UTC().Format("2006-01-02T15:04:05.000Z"),
+		})
+	}
+	writeXML(w, result)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(append([]byte(xml.Header), data...))
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,301 @@
+// Package storage 文件存储的抽象，上层按以正斜杠分隔的相对路径（键）读写文件，
+// 由本地磁盘或S3兼容的对象存储等驱动实现
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPathEscape  = errors.New("path escapes storage root")
+	ErrInvalidName = errors.New("storage: invalid name")
+	ErrNotDir      = errors.New("storage: not a directory")
+	ErrIsDir       = errors.New("storage: is a directory")
+)
+
+// Storage 存储驱动
+// 名称是相对存储根目录、以正斜杠分隔的路径，空字符串表示根目录，调用方负责清理和校验
+type Storage interface {
+	// Stat 获取文件或目录的信息，不存在时返回的错误满足errors.Is(err, fs.ErrNotExist)
+	Stat(name string) (fs.FileInfo, error)
+	// List 列出目录下的直接子项，按名称排序
+	List(name string) ([]fs.FileInfo, error)
+	// OpenRange 读取文件从offset开始的length字节，length为-1表示读到文件末尾
+	OpenRange(name string, offset, length int64) (io.ReadCloser, error)
+	// Write 写入r中的全部数据，写入完成后才替换已有文件，返回写入的字节数；父目录不存在时自动创建
+	Write(name string, r io.Reader) (int64, error)
+	// Rename 将文件或目录移动到新位置，已存在的目标文件会被替换；父目录不存在时自动创建
+	Rename(oldName, newName string) error
+	// Remove 删除文件或目录及其中的所有内容，不存在时不报错
+	Remove(name string) error
+	// MkdirAll 创建目录及其所有父目录
+	MkdirAll(name string) error
+}
+
+// Copier 可以在存储内部复制文件的驱动，不需要经过本进程传输数据
+type Copier interface {
+	Copy(src, dst string) error
+}
+
+// Opener 可以直接打开文件句柄的驱动（本地磁盘），比按范围读取更高效
+type Opener interface {
+	Open(name string) (File, fs.FileInfo, error)
+}
+
+// Chtimeser 可以设置修改时间的驱动，对象存储的修改时间由服务端决定
+type Chtimeser interface {
+	Chtimes(name string, modTime time.Time) error
+}
+
+// Resolver 存在符号链接的驱动（本地磁盘），RealPath返回解析链接后的真实路径
+type Resolver interface {
+	RealPath(name string) (string, error)
+}
+
+// File 支持随机读取的文件
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Open 打开文件用于随机读取，驱动未实现Opener时按需发起范围读取
+func Open(s Storage, name string) (File, fs.FileInfo, error) {
+	if o, ok := s.(Opener); ok {
+		return o.Open(name)
+	}
+
+	info, err := s.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrIsDir)
+	}
+	return &rangeFile{s: s, name: name, size: info.Size()}, info, nil
+}
+
+// Copy 复制文件，驱动未实现Copier时读出再写入
+func Copy(s Storage, src, dst string) error {
+	if c, ok := s.(Copier); ok {
+		return c.Copy(src, dst)
+	}
+
+	r, err := s.OpenRange(src, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = s.Write(dst, r)
+	return err
+}
+
+// Chtimes 设置修改时间，驱动不支持时忽略
+func Chtimes(s Storage, name string, modTime time.Time) error {
+	if c, ok := s.(Chtimeser); ok {
+		return c.Chtimes(name, modTime)
+	}
+	return nil
+}
+
+// ReadFile 读取整个文件
+func ReadFile(s Storage, name string) ([]byte, error) {
+	r, err := s.OpenRange(name, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WriteFile 写入整个文件
+func WriteFile(s Storage, name string, data []byte) error {
+	_, err := s.Write(name, bytes.NewReader(data))
+	return err
+}
+
+// WalkFunc Walk对每个文件和目录调用的函数，对目录返回fs.SkipDir时跳过其中的内容
+type WalkFunc func(name string, info fs.FileInfo) error
+
+// Walk 先序遍历name及其下的所有文件和目录，不跟随目录中的符号链接
+func Walk(s Storage, name string, fn WalkFunc) error {
+	info, err := s.Stat(name)
+	if err != nil {
+		return err
+	}
+	err = walk(s, name, info, fn)
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(s Storage, name string, info fs.FileInfo, fn WalkFunc) error {
+	if err := fn(name, info); err != nil || !info.IsDir() {
+		return err
+	}
+
+	children, err := s.List(name)
+	if err != nil {
+		// 遍历过程中目录被删除等情况直接跳过
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, child := range children {
+		err := walk(s, Join(name, child.Name()), child, fn)
+		if err == fs.SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Join 拼接名称，根目录为空字符串
+func Join(elem ...string) string {
+	joined := path.Join(elem...)
+	if joined == "." {
+		return ""
+	}
+	return joined
+}
+
+// Dir 获取名称的父目录，根目录下的条目返回空字符串
+func Dir(name string) string {
+	return Join(path.Dir(name))
+}
+
+// ValidName 名称必须是清理过的相对路径，不能包含..、空路径段或NUL
+func ValidName(name string) bool {
+	if name == "" {
+		return true
+	}
+	if strings.ContainsRune(name, 0) || strings.Contains(name, `\`) {
+		return false
+	}
+	return fs.ValidPath(name)
+}
+
+// fileInfo 没有底层文件系统的驱动使用的文件信息
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.isDir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// sortInfos 按名称排序
+func sortInfos(infos []fs.FileInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+}
+
+// rangeFile 基于范围读取实现的随机读取文件，顺序读取时复用同一个响应
+type rangeFile struct {
+	s      Storage
+	name   string
+	size   int64
+	offset int64
+	body   io.ReadCloser // 从bodyAt开始的顺序读取
+	bodyAt int64
+}
+
+func (f *rangeFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyAt != f.offset {
+		f.closeBody()
+		body, err := f.s.OpenRange(f.name, f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.body, f.bodyAt = body, f.offset
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyAt += int64(n)
+	if err == io.EOF && f.offset < f.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (f *rangeFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if off+length > f.size {
+		length = f.size - off
+	}
+
+	r, err := f.s.OpenRange(f.name, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, p[:length])
+	if err == nil && int64(n) < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *rangeFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *rangeFile) Close() error {
+	f.closeBody()
+	return nil
+}
+
+func (f *rangeFile) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
@@ -0,0 +1,137 @@
+package testenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gin_cloud_drive/backend/middleware"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Client 模拟浏览器的客户端：保存服务端设置的Cookie，修改请求自动带上CSRF令牌
+type Client struct {
+	env     *Env
+	mu      sync.Mutex
+	cookies map[string]*http.Cookie
+}
+
+// Response API的统一响应格式
+type Response struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Client 创建未登录的客户端（游客）
+func (e *Env) Client() *Client {
+	return &Client{env: e, cookies: make(map[string]*http.Cookie)}
+}
+
+// Login 创建客户端并用用户名和密码登录，需要两步验证的账号不能用这种方式登录
+func (e *Env) Login(username, password string) (*Client, error) {
+	client := e.Client()
+	rec := client.JSON(http.MethodPost, "/api/auth/login", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	resp, err := Decode(rec)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Code != http.StatusOK || resp.Code != http.StatusOK {
+		return nil, fmt.Errorf("testenv: login %s failed: %d %s", username, rec.Code, resp.Message)
+	}
+	if _, ok := client.Cookie(middleware.SessionCookieName); !ok {
+		return nil, fmt.Errorf("testenv: login %s did not set a session cookie", username)
+	}
+	return client, nil
+}
+
+// Do 发送请求，附带已保存的Cookie，并保存响应中设置的Cookie
+func (c *Client) Do(req *http.Request) *httptest.ResponseRecorder {
+	c.mu.Lock()
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	if csrf, ok := c.cookies[middleware.CSRFCookieName]; ok && req.Header.Get(middleware.CSRFHeaderName) == "" {
+		req.Header.Set(middleware.CSRFHeaderName, csrf.Value)
+	}
+	c.mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	c.env.Engine.ServeHTTP(rec, req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(c.cookies, cookie.Name)
+			continue
+		}
+		c.cookies[cookie.Name] = cookie
+	}
+	return rec
+}
+
+// Get 发送GET请求
+func (c *Client) Get(path string) *httptest.ResponseRecorder {
+	return c.Do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// JSON 发送以JSON编码v作为请求体的请求，v为nil时没有请求体
+func (c *Client) JSON(method, path string, v any) *httptest.ResponseRecorder {
+	var body io.Reader
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			panic(err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, body)
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.Do(req)
+}
+
+// Upload 通过普通上传接口把r的内容上传为dir目录下的filename
+func (c *Client) Upload(dir, filename string, r io.Reader) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("path", dir)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		panic(err)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/file/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return c.Do(req)
+}
+
+// Cookie 获取服务端设置的Cookie
+func (c *Client) Cookie(name string) (*http.Cookie, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cookie, ok := c.cookies[name]
+	return cookie, ok
+}
+
+// Decode 解析API的统一响应
+func Decode(rec *httptest.ResponseRecorder) (*Response, error) {
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("testenv: decode response (status %d): %w", rec.Code, err)
+	}
+	return &resp, nil
+}
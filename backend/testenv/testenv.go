@@ -0,0 +1,123 @@
+// Package testenv 集成测试用的运行环境，在进程内运行完整的HTTP API而不读写磁盘：
+// 文件保存在内存存储驱动中，日志只保存在内存中，数据文件配置为空时用户、分享等数据也只保存在内存中，
+// 请求通过httptest直接交给路由注册好的gin引擎处理，不需要监听端口
+//
+// 模型层的存储是进程级的全局变量，一个测试进程中只能创建一个环境，通常在TestMain中创建并在测试间共享：
+//
+//	var env *testenv.Env
+//
+//	func TestMain(m *testing.M) {
+//		var err error
+//		if env, err = testenv.New(nil); err != nil {
+//			log.Fatal(err)
+//		}
+//		os.Exit(m.Run())
+//	}
+//
+//	func TestUpload(t *testing.T) {
+//		admin, err := env.Login("admin", "admin123")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		rec := admin.Upload("docs", "a.txt", strings.NewReader("hello"))
+//		...
+//	}
+package testenv
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/routes"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrAlreadyCreated 同一进程中重复创建环境
+var ErrAlreadyCreated = errors.New("testenv: environment already created in this process")
+
+var (
+	created   bool
+	createdMu sync.Mutex
+)
+
+// Env 测试环境
+type Env struct {
+	Config  *config.Config
+	Storage *storage.Memory // 上传的文件，测试中可以直接检查或预先放入文件
+	Engine  *gin.Engine
+}
+
+// Config 返回测试用的默认配置：所有数据文件为空，初始管理员为admin/admin123
+// 登录失败后不等待，账号锁定等其余规则保持默认
+func Config() *config.Config {
+	cfg := config.Default()
+	cfg.Login.BackoffBase = 0
+	cfg.User.DataFile = ""
+	cfg.Token.DataFile = ""
+	cfg.TwoFactor.DataFile = ""
+	cfg.OIDC.DataFile = ""
+	cfg.LDAP.DataFile = ""
+	cfg.Share.DataFile = ""
+	cfg.Access.DataFile = ""
+	cfg.ACL.DataFile = ""
+	cfg.ACL.GroupFile = ""
+	cfg.System.DataFile = ""
+	return cfg
+}
+
+// New 用注入的配置初始化各个存储并创建gin引擎，cfg为nil时使用Config()
+// 不启动过期数据清理和系统监控等后台任务
+func New(cfg *config.Config) (*Env, error) {
+	createdMu.Lock()
+	defer createdMu.Unlock()
+	if created {
+		return nil, ErrAlreadyCreated
+	}
+
+	if cfg == nil {
+		cfg = Config()
+	}
+	config.SetConfig(cfg)
+
+	if err := logger.InitLogger("", logger.LevelInfo); err != nil {
+		return nil, err
+	}
+
+	// 与main.go中的初始化顺序一致
+	inits := []func() error{
+		models.InitUserStore,
+		models.InitSessionStore,
+		models.InitTokenStore,
+		models.InitTwoFactorStore,
+		models.InitOIDC,
+		models.InitLDAP,
+		models.InitShareStore,
+		models.InitAccessStore,
+		models.InitGroupStore,
+		models.InitACLStore,
+	}
+	for _, init := range inits {
+		if err := init(); err != nil {
+			return nil, err
+		}
+	}
+
+	mem := storage.NewMemory()
+	utils.SetStorage(mem)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.Use(gin.Recovery())
+	routes.RegisterRoutes(r)
+
+	created = true
+	return &Env{Config: cfg, Storage: mem, Engine: r}, nil
+}
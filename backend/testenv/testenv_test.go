@@ -0,0 +1,154 @@
+package testenv_test
+
+import (
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/testenv"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var env *testenv.Env
+
+func TestMain(m *testing.M) {
+	var err error
+	if env, err = testenv.New(nil); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestNewOnlyOnce(t *testing.T) {
+	if _, err := testenv.New(nil); !errors.Is(err, testenv.ErrAlreadyCreated) {
+		t.Fatalf("second New: err = %v, want ErrAlreadyCreated", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	if _, err := env.Login("admin", "wrong-password"); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := admin.Get("/api/user/info")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("user info: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// 未登录的客户端不能访问需要认证的接口
+	if rec := env.Client().Get("/api/user/info"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("guest user info: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestFileLifecycle(t *testing.T) {
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传
+	rec := admin.Upload("docs", "hello.txt", strings.NewReader("hello world"))
+	if resp := mustDecode(t, rec, http.StatusOK); resp.Code != http.StatusOK {
+		t.Fatalf("upload: code = %d: %s", resp.Code, resp.Message)
+	}
+	data, err := storage.ReadFile(env.Storage, "docs/hello.txt")
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("stored file = %q, %v", data, err)
+	}
+
+	// 列表
+	var files []struct {
+		Name  string `json:"name"`
+		Path  string `json:"path"`
+		Size  int64  `json:"size"`
+		IsDir bool   `json:"is_directory"`
+	}
+	unmarshal(t, mustDecode(t, admin.Get("/api/file/list?path=docs"), http.StatusOK).Data, &files)
+	if len(files) != 1 || files[0].Path != "docs/hello.txt" || files[0].Size != 11 || files[0].IsDir {
+		t.Fatalf("list = %+v", files)
+	}
+
+	// 下载
+	rec = admin.Get("/api/file/download/docs/hello.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello world" {
+		t.Fatalf("download: status = %d, body = %q", rec.Code, rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "attachment") {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+
+	// 删除后文件移入回收站
+	mustDecode(t, admin.JSON(http.MethodDelete, "/api/file/delete/docs/hello.txt", nil), http.StatusOK)
+	if rec := admin.Get("/api/file/download/docs/hello.txt"); rec.Code != http.StatusNotFound {
+		t.Fatalf("download after delete: status = %d, want 404", rec.Code)
+	}
+
+	var trash []struct {
+		ID           string `json:"id"`
+		OriginalPath string `json:"original_path"`
+	}
+	unmarshal(t, mustDecode(t, admin.Get("/api/file/trash"), http.StatusOK).Data, &trash)
+	if len(trash) != 1 || trash[0].OriginalPath != "docs/hello.txt" {
+		t.Fatalf("trash = %+v", trash)
+	}
+
+	// 恢复
+	mustDecode(t, admin.JSON(http.MethodPost, "/api/file/trash/"+trash[0].ID+"/restore", nil), http.StatusOK)
+	rec = admin.Get("/api/file/download/docs/hello.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello world" {
+		t.Fatalf("download after restore: status = %d, body = %q", rec.Code, rec.Body)
+	}
+	unmarshal(t, mustDecode(t, admin.Get("/api/file/trash"), http.StatusOK).Data, &trash)
+	if len(trash) != 0 {
+		t.Fatalf("trash after restore = %+v", trash)
+	}
+
+	// 再次删除并清空回收站
+	mustDecode(t, admin.JSON(http.MethodDelete, "/api/file/delete/docs/hello.txt", nil), http.StatusOK)
+	mustDecode(t, admin.JSON(http.MethodDelete, "/api/file/trash", nil), http.StatusOK)
+	unmarshal(t, mustDecode(t, admin.Get("/api/file/trash"), http.StatusOK).Data, &trash)
+	if len(trash) != 0 {
+		t.Fatalf("trash after empty = %+v", trash)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	admin, err := env.Login("admin", "admin123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustDecode(t, admin.JSON(http.MethodPost, "/api/auth/logout", nil), http.StatusOK)
+	if rec := admin.Get("/api/user/info"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("user info after logout: status = %d, want 401", rec.Code)
+	}
+}
+
+// mustDecode 检查HTTP状态码并解析统一响应
+func mustDecode(t *testing.T, rec *httptest.ResponseRecorder, status int) *testenv.Response {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	resp, err := testenv.Decode(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// unmarshal 解析响应中的data
+func unmarshal(t *testing.T, data json.RawMessage, v any) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decode data %s: %v", data, err)
+	}
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/storage"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// 打包下载支持的格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+var ErrInvalidArchiveFormat = errors.New("invalid archive format")
+
+// ArchiveEntry 打包下载中的一个文件或目录
+type ArchiveEntry struct {
+	Path string // 存储中的名称
+	Name string // 包内路径，以正斜杠分隔，目录以斜杠结尾
+	Info fs.FileInfo
+}
+
+// ArchivePlan 打包下载的内容清单，写入前先完成路径校验，出错时还能返回正常的错误响应
+type ArchivePlan struct {
+	Name      string // 建议的包文件名（不含扩展名）
+	Entries   []ArchiveEntry
+	TotalSize int64 // 所有文件大小之和
+}
+
+// ParseArchiveFormat 解析打包格式，为空时默认ZIP
+func ParseArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", ArchiveZip:
+		return ArchiveZip, nil
+	case ArchiveTarGz, "tgz":
+		return ArchiveTarGz, nil
+	default:
+		return "", ErrInvalidArchiveFormat
+	}
+}
+
+// PlanArchive 收集要打包的文件，包内路径相对于所有选中项的公共父目录
+// 目录下的符号链接会被跳过，防止通过链接打包上传目录之外的内容
+func PlanArchive(paths []string) (*ArchivePlan, error) {
+	if len(paths) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	names := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		name, err := ResolveEntryPath(p)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fileStorage().Stat(name); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%s: %w", p, fs.ErrNotExist)
+			}
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	base := commonParent(names)
+	plan := &ArchivePlan{Name: "download"}
+	if len(names) == 1 {
+		plan.Name = path.Base(names[0])
+	} else if base != "" {
+		plan.Name = path.Base(base)
+	}
+
+	added := make(map[string]bool)
+	for _, top := range names {
+		err := storage.Walk(fileStorage(), top, func(p string, info fs.FileInfo) error {
+			if info.Mode()&fs.ModeSymlink != 0 && p != top {
+				return nil
+			}
+			// 选中的目录中可能包含同样被选中的子项，避免重复打包
+			if added[p] {
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			added[p] = true
+
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+
+			name := strings.TrimPrefix(p[len(base):], "/")
+			if info.IsDir() {
+				name += "/"
+			} else {
+				plan.TotalSize += info.Size()
+			}
+			plan.Entries = append(plan.Entries, ArchiveEntry{Path: p, Name: name, Info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// WriteArchive 将清单中的内容以指定格式流式写入w，不在磁盘上生成临时文件
+func WriteArchive(w io.Writer, format string, plan *ArchivePlan) error {
+	switch format {
+	case ArchiveZip:
+		return writeZip(w, plan)
+	case ArchiveTarGz:
+		return writeTarGz(w, plan)
+	default:
+		return ErrInvalidArchiveFormat
+	}
+}
+
+// writeZip 写入ZIP格式
+func writeZip(w io.Writer, plan *ArchivePlan) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range plan.Entries {
+		header, err := zip.FileInfoHeader(entry.Info)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		if !entry.Info.IsDir() {
+			header.Method = zip.Deflate
+		}
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if entry.Info.IsDir() {
+			continue
+		}
+		if err := copyEntry(dst, entry); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz 写入tar.gz格式
+func writeTarGz(w io.Writer, plan *ArchivePlan) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, entry := range plan.Entries {
+		header, err := tar.FileInfoHeader(entry.Info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		// 不泄露服务器上的用户和用户组信息
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.Info.IsDir() {
+			continue
+		}
+		if err := copyEntry(tw, entry); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyEntry 复制文件内容，写入量以收集清单时的大小为准，避免文件期间被修改导致tar头与内容不符
+func copyEntry(dst io.Writer, entry ArchiveEntry) error {
+	src, err := fileStorage().OpenRange(entry.Path, 0, entry.Info.Size())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	n, err := io.Copy(dst, io.LimitReader(src, entry.Info.Size()))
+	if err != nil {
+		return err
+	}
+	if n != entry.Info.Size() {
+		return fmt.Errorf("%s: file changed during archiving", entry.Name)
+	}
+	return nil
+}
+
+// commonParent 计算多个名称的公共父目录，上传根目录为空字符串
+func commonParent(names []string) string {
+	parent := storage.Dir(names[0])
+	for _, name := range names[1:] {
+		for !isWithin(parent, name) {
+			parent = storage.Dir(parent)
+		}
+	}
+	return parent
+}
+
+// ArchiveExtension 获取打包格式对应的文件扩展名
+func ArchiveExtension(format string) string {
+	return "." + format
+}
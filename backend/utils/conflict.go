@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// 目标已存在时的处理策略
+const (
+	ConflictOverwrite = "overwrite" // 覆盖已有文件
+	ConflictRename    = "rename"    // 自动重命名为"name (1).ext"
+	ConflictFail      = "fail"      // 返回错误
+)
+
+var (
+	ErrFileExists      = errors.New("target already exists")
+	ErrInvalidConflict = errors.New("invalid conflict policy")
+)
+
+// maxRenameAttempts 自动重命名时最多尝试的序号
+const maxRenameAttempts = 10000
+
+// ParseConflictPolicy 解析冲突处理策略，为空时使用默认策略
+func ParseConflictPolicy(policy, defaultPolicy string) (string, error) {
+	switch policy {
+	case "":
+		return defaultPolicy, nil
+	case ConflictOverwrite, ConflictRename, ConflictFail:
+		return policy, nil
+	default:
+		return "", ErrInvalidConflict
+	}
+}
+
+// resolveConflict 根据策略确定最终写入的名称
+// 覆盖只允许在源和目标都是文件时进行，不会用文件覆盖目录或反之
+func resolveConflict(name string, srcIsDir bool, policy string) (string, error) {
+	info, err := fileStorage().Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch policy {
+	case ConflictOverwrite:
+		if info.IsDir() || srcIsDir {
+			return "", fmt.Errorf("cannot overwrite %s: %w", path.Base(name), ErrFileExists)
+		}
+		return name, nil
+	case ConflictRename:
+		return availableName(name)
+	default:
+		return "", fmt.Errorf("%s: %w", path.Base(name), ErrFileExists)
+	}
+}
+
+// availableName 生成"name (n).ext"形式的可用名称
+func availableName(name string) (string, error) {
+	dir := storage.Dir(name)
+	base := path.Base(name)
+	ext := path.Ext(base)
+	// 隐藏文件（如.bashrc）整体视为文件名
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	for i := 1; i <= maxRenameAttempts; i++ {
+		candidate := storage.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		if _, err := fileStorage().Stat(candidate); errors.Is(err, fs.ErrNotExist) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no available name for %s: %w", base, ErrFileExists)
+}
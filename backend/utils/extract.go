@@ -0,0 +1,450 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveTar 未压缩的tar包，只用于解压
+const archiveTar = "tar"
+
+var (
+	ErrArchiveLimit  = errors.New("archive exceeds extraction limits")
+	ErrExtractDenied = errors.New("no write permission for extracted entry")
+)
+
+// ExtractResult 解压结果
+type ExtractResult struct {
+	Target      string `json:"target"` // 解压到的目录（相对上传目录）
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+	Size        int64  `json:"size"`    // 解压出的文件总大小
+	Skipped     int    `json:"skipped"` // 跳过的符号链接、设备文件等条目数
+}
+
+// archiveHeader 压缩包条目的通用信息
+type archiveHeader struct {
+	Name    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// ArchiveFormatByName 根据文件扩展名判断压缩包格式
+func ArchiveFormatByName(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar, nil
+	default:
+		return "", ErrInvalidArchiveFormat
+	}
+}
+
+// ArchiveBaseName 去掉压缩包扩展名，作为默认的解压目录名
+func ArchiveBaseName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ".tar"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// ListArchive 列出压缩包中dir目录下的直接子项，不解压
+// 压缩包中可能省略目录条目，中间目录会根据文件路径补全
+func ListArchive(archivePath, dir string) ([]FileInfo, error) {
+	name, err := ResolveEntryPath(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	format, err := ArchiveFormatByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir = strings.Trim(path.Clean("/"+filepath.ToSlash(dir)), "/")
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	children := make(map[string]*FileInfo)
+	err = walkArchive(name, format, func(header archiveHeader, _ func() (io.ReadCloser, error)) error {
+		name, err := archiveEntryName(header.Name)
+		if err != nil || name == "" || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		// 与解压时一致，不展示符号链接等特殊条目
+		if !header.Mode.IsDir() && !header.Mode.IsRegular() {
+			return nil
+		}
+
+		childName, rest, nested := strings.Cut(strings.TrimPrefix(name, prefix), "/")
+		if childName == "" {
+			return nil
+		}
+		child, ok := children[childName]
+		if !ok {
+			child = &FileInfo{
+				Name: childName,
+				Path: prefix + childName,
+				Type: getFileType(childName),
+			}
+			children[childName] = child
+		}
+
+		if nested && rest != "" || header.Mode.IsDir() {
+			child.IsDirectory = true
+			child.Size = 0
+		} else {
+			child.Size = header.Size
+		}
+		if nested && rest != "" {
+			return nil
+		}
+		child.ModifiedTime = header.ModTime
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0, len(children))
+	for _, child := range children {
+		files = append(files, *child)
+	}
+	// 文件夹在前，其余按名称排序
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDirectory != files[j].IsDirectory {
+			return files[i].IsDirectory
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// ExtractArchive 将压缩包解压到targetDir，同名文件按冲突策略处理，同名目录合并
+// 先完整解压到保留目录中的临时位置并检查大小、条目数和配额，全部通过后才写入目标目录
+// canWrite不为nil时对每个要写入的路径（相对上传目录的用户路径）检查写入权限，任何一个没有权限都不做修改
+func ExtractArchive(archivePath, targetDir, policy string, canWrite func(path string) bool) (*ExtractResult, error) {
+	archiveName, err := ResolveEntryPath(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	format, err := ArchiveFormatByName(archiveName)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fileStorage().Stat(archiveName); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("%s: %w", archivePath, ErrIsDirectory)
+	}
+
+	target, err := ResolvePath(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fileStorage().Stat(target); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%s: %w", targetDir, ErrFileExists)
+	}
+
+	staging, err := tempName("extract")
+	if err != nil {
+		return nil, err
+	}
+	if err := fileStorage().MkdirAll(staging); err != nil {
+		return nil, err
+	}
+	defer fileStorage().Remove(staging)
+
+	result := &ExtractResult{Target: target}
+	if err := stageArchive(archiveName, format, staging, result); err != nil {
+		return nil, err
+	}
+	if result.Directories, err = commitExtracted(staging, targetDir, target, policy, canWrite); err != nil {
+		return nil, err
+	}
+
+	InvalidateUsage()
+	return result, nil
+}
+
+// stageArchive 将压缩包解压到临时目录，解压过程中实时检查限制，不信任条目头中声明的大小
+func stageArchive(archiveName, format, staging string, result *ExtractResult) error {
+	cfg := config.GetConfig().File
+
+	// 总大小上限取解压限制和剩余配额中较小的一个
+	limit := cfg.ExtractMaxSize
+	if limit <= 0 {
+		limit = -1
+	}
+	limitErr := ErrArchiveLimit
+	available, err := availableSpace()
+	if err != nil {
+		return err
+	}
+	if available >= 0 && (limit < 0 || available < limit) {
+		limit = available
+		limitErr = ErrQuotaExceeded
+	}
+
+	type dirTime struct {
+		path    string
+		modTime time.Time
+	}
+	var dirTimes []dirTime
+	entries := 0
+
+	err = walkArchive(archiveName, format, func(header archiveHeader, open func() (io.ReadCloser, error)) error {
+		entries++
+		if cfg.ExtractMaxEntries > 0 && entries > cfg.ExtractMaxEntries {
+			return ErrArchiveLimit
+		}
+
+		name, err := archiveEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return nil
+		}
+		dst := storage.Join(staging, name)
+
+		switch {
+		case header.Mode.IsDir():
+			if err := fileStorage().MkdirAll(dst); err != nil {
+				return err
+			}
+			dirTimes = append(dirTimes, dirTime{dst, header.ModTime})
+			return nil
+		case !header.Mode.IsRegular():
+			// 符号链接、硬链接、设备文件等一律跳过，防止借助链接写到目标目录之外
+			result.Skipped++
+			return nil
+		}
+
+		if cfg.MaxSize > 0 && header.Size > cfg.MaxSize {
+			return ErrFileTooLarge
+		}
+
+		src, err := open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		// 单个文件最多读取到剩余额度+1字节，用于判断是否超限
+		fileLimit := int64(-1)
+		if limit >= 0 {
+			fileLimit = limit - result.Size
+		}
+		if cfg.MaxSize > 0 && (fileLimit < 0 || cfg.MaxSize < fileLimit) {
+			fileLimit = cfg.MaxSize
+		}
+		reader := io.Reader(src)
+		if fileLimit >= 0 {
+			reader = io.LimitReader(src, fileLimit+1)
+		}
+
+		n, err := fileStorage().Write(dst, reader)
+		if err != nil {
+			return err
+		}
+		if fileLimit >= 0 && n > fileLimit {
+			if cfg.MaxSize > 0 && n > cfg.MaxSize {
+				return ErrFileTooLarge
+			}
+			return limitErr
+		}
+
+		result.Size += n
+		result.Files++
+		return storage.Chtimes(fileStorage(), dst, header.ModTime)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 目录的修改时间在其中文件写入后才能设置，从最深的目录开始
+	for i := len(dirTimes) - 1; i >= 0; i-- {
+		storage.Chtimes(fileStorage(), dirTimes[i].path, dirTimes[i].modTime)
+	}
+	return nil
+}
+
+// commitExtracted 将临时目录中的内容移动到目标目录
+// 移动前先检查所有冲突和写入权限，文件与目录互相冲突、fail策略下存在同名文件或没有权限时不做任何修改，返回目录数
+func commitExtracted(staging, targetDir, target, policy string, canWrite func(path string) bool) (int, error) {
+	type stagedEntry struct {
+		src, dst string
+		isDir    bool
+		modTime  time.Time
+	}
+	var staged []stagedEntry
+
+	err := storage.Walk(fileStorage(), staging, func(p string, info fs.FileInfo) error {
+		if p == staging {
+			return nil
+		}
+		rel := strings.TrimPrefix(p, staging+"/")
+
+		// 合并到已有目录时可能写入单独收紧了权限的子目录，按每个条目的用户路径检查
+		if userPath := path.Join(targetDir, rel); canWrite != nil && !canWrite(userPath) {
+			return fmt.Errorf("%s: %w", userPath, ErrExtractDenied)
+		}
+
+		// 重新按用户路径解析，确保目标目录中已有的符号链接不会把文件带出上传目录
+		dst, err := ResolvePath(path.Join(target, rel))
+		if err != nil {
+			return err
+		}
+		if existing, err := fileStorage().Stat(dst); err == nil {
+			if existing.IsDir() != info.IsDir() || (!info.IsDir() && policy == ConflictFail) {
+				return fmt.Errorf("%s: %w", dst, ErrFileExists)
+			}
+		}
+		staged = append(staged, stagedEntry{src: p, dst: dst, isDir: info.IsDir(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := fileStorage().MkdirAll(target); err != nil {
+		return 0, err
+	}
+	dirs := 0
+	for _, entry := range staged {
+		if entry.isDir {
+			if err := fileStorage().MkdirAll(entry.dst); err != nil {
+				return dirs, err
+			}
+			dirs++
+			continue
+		}
+		if _, err := commitFile(entry.src, entry.dst, policy); err != nil {
+			return dirs, err
+		}
+	}
+
+	// 新建目录的修改时间与压缩包中保持一致
+	for i := len(staged) - 1; i >= 0; i-- {
+		if staged[i].isDir {
+			storage.Chtimes(fileStorage(), staged[i].dst, staged[i].modTime)
+		}
+	}
+	return dirs, nil
+}
+
+// walkArchive 依次读取压缩包中的条目，open用于读取普通文件的内容
+func walkArchive(name, format string, fn func(header archiveHeader, open func() (io.ReadCloser, error)) error) error {
+	if format == ArchiveZip {
+		// ZIP的目录位于文件末尾，需要随机读取
+		file, info, err := storage.Open(fileStorage(), name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return err
+		}
+
+		for _, file := range reader.File {
+			header := archiveHeader{
+				Name:    file.Name,
+				Size:    int64(file.UncompressedSize64),
+				Mode:    file.Mode(),
+				ModTime: file.Modified,
+			}
+			if err := fn(header, file.Open); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := fileStorage().OpenRange(name, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	if format == ArchiveTarGz {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		th, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		header := archiveHeader{
+			Name:    th.Name,
+			Size:    th.Size,
+			Mode:    th.FileInfo().Mode(),
+			ModTime: th.ModTime,
+		}
+		open := func() (io.ReadCloser, error) {
+			return io.NopCloser(tr), nil
+		}
+		if err := fn(header, open); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveEntryName 校验并规范化压缩包中的条目名，防止Zip Slip
+// 绝对路径、盘符和包含..的条目直接拒绝；返回空字符串表示条目指向根目录本身
+func archiveEntryName(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", ErrInvalidPath
+	}
+	// Windows下生成的压缩包可能使用反斜杠作为分隔符
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%s: %w", name, ErrPathEscape)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s: %w", name, ErrPathEscape)
+		}
+	}
+
+	name = path.Clean(name)
+	if name == "." {
+		return "", nil
+	}
+	return name, nil
+}
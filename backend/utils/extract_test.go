@@ -0,0 +1,356 @@
+package utils_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveEntry 测试压缩包中的条目，link非空时为指向link的符号链接
+type archiveEntry struct {
+	name string
+	body string
+	link string
+	dir  bool
+}
+
+func buildZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Now()}
+		body := e.body
+		switch {
+		case e.link != "":
+			header.SetMode(fs.ModeSymlink | 0777)
+			body = e.link
+		case e.dir:
+			header.SetMode(fs.ModeDir | 0755)
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		switch {
+		case e.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+		case e.dir:
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// buildArchive 按格式构造压缩包，format为zip或tar.gz
+func buildArchive(t *testing.T, format string, entries []archiveEntry) []byte {
+	if format == "zip" {
+		return buildZip(t, entries)
+	}
+	return buildTarGz(t, entries)
+}
+
+// putArchive 将压缩包写入上传目录下的extract/目录，返回相对路径
+func putArchive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	rel := "extract/" + name
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(full) })
+	return rel
+}
+
+// setExtractLimits 临时修改解压限制，测试结束后恢复
+func setExtractLimits(t *testing.T, maxSize int64, maxEntries int) {
+	t.Helper()
+	cfg := &config.GetConfig().File
+	oldSize, oldEntries := cfg.ExtractMaxSize, cfg.ExtractMaxEntries
+	cfg.ExtractMaxSize, cfg.ExtractMaxEntries = maxSize, maxEntries
+	t.Cleanup(func() { cfg.ExtractMaxSize, cfg.ExtractMaxEntries = oldSize, oldEntries })
+}
+
+func exists(rel string) bool {
+	_, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel)))
+	return err == nil
+}
+
+// assertNothingExtracted 解压失败时目标目录不应被创建，上传目录之外也不能出现文件
+func assertNothingExtracted(t *testing.T, target string) {
+	t.Helper()
+	if exists(target) {
+		t.Fatalf("target %s was created", target)
+	}
+	for _, name := range []string{"evil.txt", "../evil.txt"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); err == nil {
+			t.Fatalf("%s written outside the upload directory", name)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(root), "evil.txt")); err == nil {
+		t.Fatal("evil.txt written next to the upload directory")
+	}
+	staging, _ := os.ReadDir(filepath.Join(root, utils.SystemDirName, "tmp"))
+	for _, entry := range staging {
+		if strings.HasPrefix(entry.Name(), "extract") {
+			t.Fatalf("staging directory %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	names := []string{
+		"../evil.txt",
+		"../../evil.txt",
+		"ok/../../evil.txt",
+		"/evil.txt",
+		"/tmp/evil.txt",
+		`..\evil.txt`,
+		`ok\..\..\evil.txt`,
+		"C:/evil.txt",
+		`C:\evil.txt`,
+		"evil\x00.txt",
+	}
+
+	for i, name := range names {
+		entries := []archiveEntry{{name: "ok.txt", body: "ok"}, {name: name, body: "evil"}}
+		for _, format := range []string{"zip", "tar.gz"} {
+			t.Run(format+"/"+name, func(t *testing.T) {
+				if format == "tar.gz" && strings.ContainsRune(name, 0) {
+					t.Skip("tar cannot encode NUL in names")
+				}
+				data := buildArchive(t, format, entries)
+				archive := putArchive(t, "slip."+format, data)
+				target := "extract/slip-" + format + "-" + string(rune('a'+i))
+
+				if _, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); !errors.Is(err, utils.ErrPathEscape) && !errors.Is(err, utils.ErrInvalidPath) {
+					t.Fatalf("err = %v, want ErrPathEscape or ErrInvalidPath", err)
+				}
+				assertNothingExtracted(t, target)
+			})
+		}
+	}
+}
+
+func TestExtractSkipsLinks(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "dir", dir: true},
+		{name: "dir/a.txt", body: "hello"},
+		{name: "passwd", link: "/etc/passwd"},
+		{name: "dir/up", link: "../../.."},
+	}
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			data := buildArchive(t, format, entries)
+			archive := putArchive(t, "links."+format, data)
+			target := "extract/links-" + format
+			t.Cleanup(func() { os.RemoveAll(filepath.Join(root, target)) })
+
+			result, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Files != 1 || result.Skipped != 2 || result.Size != 5 {
+				t.Fatalf("result = %+v", result)
+			}
+			if data, err := os.ReadFile(filepath.Join(root, target, "dir", "a.txt")); err != nil || string(data) != "hello" {
+				t.Fatalf("a.txt = %q, %v", data, err)
+			}
+			for _, link := range []string{target + "/passwd", target + "/dir/up"} {
+				if exists(link) {
+					t.Fatalf("%s was extracted", link)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractSymlinkThenWriteThrough(t *testing.T) {
+	// 先放一个指向目录外的符号链接，再写入同名路径下的文件，链接被跳过后文件只能落在目标目录内
+	entries := []archiveEntry{
+		{name: "out", link: outside},
+		{name: "out/evil.txt", body: "evil"},
+	}
+	archive := putArchive(t, "through.tar.gz", buildTarGz(t, entries))
+	target := "extract/through"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(root, target)) })
+
+	if _, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "evil.txt")); err == nil {
+		t.Fatal("file written through a symlink entry")
+	}
+	info, err := os.Lstat(filepath.Join(root, target, "out"))
+	if err != nil || !info.IsDir() {
+		t.Fatalf("out should be a plain directory: %v, %v", info, err)
+	}
+}
+
+func TestExtractEntryLimit(t *testing.T) {
+	setExtractLimits(t, 0, 3)
+
+	entries := []archiveEntry{{name: "a", body: "a"}, {name: "b", body: "b"}, {name: "c", body: "c"}}
+	archive := putArchive(t, "three.zip", buildZip(t, entries))
+	target := "extract/three"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(root, target)) })
+	if result, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); err != nil || result.Files != 3 {
+		t.Fatalf("three entries: %+v, %v", result, err)
+	}
+
+	entries = append(entries, archiveEntry{name: "d", body: "d"})
+	for _, format := range []string{"zip", "tar.gz"} {
+		data := buildArchive(t, format, entries)
+		archive := putArchive(t, "four."+format, data)
+		target := "extract/four-" + format
+		if _, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); !errors.Is(err, utils.ErrArchiveLimit) {
+			t.Fatalf("%s: err = %v, want ErrArchiveLimit", format, err)
+		}
+		assertNothingExtracted(t, target)
+	}
+}
+
+func TestExtractSizeLimit(t *testing.T) {
+	setExtractLimits(t, 1000, 0)
+
+	// 高度可压缩的内容：压缩包只有几KB，解压后远超限制
+	bomb := strings.Repeat("0", 10<<20)
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"single large file", []archiveEntry{{name: "bomb.txt", body: bomb}}},
+		{"total across files", []archiveEntry{{name: "a.txt", body: strings.Repeat("a", 600)}, {name: "b.txt", body: strings.Repeat("b", 600)}}},
+	}
+
+	for i, tt := range tests {
+		for _, format := range []string{"zip", "tar.gz"} {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				data := buildArchive(t, format, tt.entries)
+				if len(data) > 64<<10 {
+					t.Fatalf("archive is %d bytes, expected it to compress well", len(data))
+				}
+				archive := putArchive(t, "big."+format, data)
+				target := "extract/big-" + format + "-" + string(rune('a'+i))
+
+				if _, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); !errors.Is(err, utils.ErrArchiveLimit) {
+					t.Fatalf("err = %v, want ErrArchiveLimit", err)
+				}
+				assertNothingExtracted(t, target)
+			})
+		}
+	}
+
+	// 恰好等于限制时允许解压
+	archive := putArchive(t, "exact.zip", buildZip(t, []archiveEntry{{name: "a.txt", body: strings.Repeat("a", 1000)}}))
+	target := "extract/exact"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(root, target)) })
+	if result, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); err != nil || result.Size != 1000 {
+		t.Fatalf("exact limit: %+v, %v", result, err)
+	}
+}
+
+func TestExtractZipLyingHeader(t *testing.T) {
+	setExtractLimits(t, 1000, 0)
+
+	// 条目头声明的大小小于实际内容，解压时按实际读取的字节数计算
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "liar.txt", Method: zip.Store, CompressedSize64: 5000, UncompressedSize64: 10, CRC32: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(bytes.Repeat([]byte("x"), 5000))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := putArchive(t, "liar.zip", buf.Bytes())
+	target := "extract/liar"
+	if _, err := utils.ExtractArchive(archive, target, utils.ConflictFail, nil); err == nil {
+		t.Fatal("archive with a lying size header was extracted")
+	}
+	assertNothingExtracted(t, target)
+}
+
+func TestExtractChecksWritePermission(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "pub/a.txt", body: "a"},
+		{name: "secret/b.txt", body: "b"},
+	}
+	archive := putArchive(t, "perm.zip", buildZip(t, entries))
+	target := "extract/perm"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(root, target)) })
+
+	// 目标目录中已有单独收紧权限的子目录，解压合并到其中时应被拒绝
+	must(os.MkdirAll(filepath.Join(root, target, "secret"), 0755))
+	var checked []string
+	canWrite := func(p string) bool {
+		checked = append(checked, p)
+		return !strings.HasPrefix(p, target+"/secret")
+	}
+	if _, err := utils.ExtractArchive(archive, target, utils.ConflictOverwrite, canWrite); !errors.Is(err, utils.ErrExtractDenied) {
+		t.Fatalf("err = %v, want ErrExtractDenied", err)
+	}
+	if exists(target+"/pub/a.txt") || exists(target+"/secret/b.txt") {
+		t.Fatal("entries were extracted although one destination is not writable")
+	}
+	if !slices.Contains(checked, target+"/pub/a.txt") || !slices.Contains(checked, target+"/secret") {
+		t.Fatalf("checked paths = %v", checked)
+	}
+
+	if _, err := utils.ExtractArchive(archive, target, utils.ConflictOverwrite, func(string) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(target+"/pub/a.txt") || !exists(target+"/secret/b.txt") {
+		t.Fatal("entries were not extracted")
+	}
+}
@@ -1,274 +1,318 @@
-package utils
-
-import (
-	"gin_cloud_drive/backend/config"
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
-)
-
-// FileInfo 文件信息
-type FileInfo struct {
-	Name         string    `json:"name"`
-	Path         string    `json:"path"`
-	Size         int64     `json:"size"`
-	IsDirectory  bool      `json:"is_directory"`
-	ModifiedTime time.Time `json:"modified_time"`
-	Type         string    `json:"type"`
-}
-
-// ListFiles 列出文件
-func ListFiles(path string, sortBy string, sortOrder string) ([]FileInfo, error) {
-	uploadPath := config.GetConfig().File.UploadPath
-	// 使用filepath.Join构建完整路径，确保路径分隔符正确
-	fullPath := filepath.Join(uploadPath, path)
-
-	// 检查路径是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return nil, err
-	}
-
-	// 读取目录
-	entries, err := os.ReadDir(fullPath)
-	if err != nil {
-		return nil, err
-	}
-
-	var files []FileInfo
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		// 使用filepath.Join构建文件路径，确保路径分隔符正确
-		filePath := filepath.Join(path, info.Name())
-		// 将路径分隔符转换为正斜杠，确保URL兼容
-		filePath = filepath.ToSlash(filePath)
-
-		file := FileInfo{
-			Name:         info.Name(),
-			Path:         filePath,
-			Size:         info.Size(),
-			IsDirectory:  entry.IsDir(),
-			ModifiedTime: info.ModTime(),
-			Type:         getFileType(info.Name()),
-		}
-
-		files = append(files, file)
-	}
-
-	// 排序文件列表
-	// 首先确保文件夹在文件前面
-	// 然后根据指定字段排序
-	ascending := sortOrder == "asc"
-
-	// 定义比较函数
-	compare := func(a, b FileInfo) bool {
-		// 文件夹始终在文件前面
-		if a.IsDirectory != b.IsDirectory {
-			return a.IsDirectory
-		}
-
-		// 根据排序字段比较
-		switch sortBy {
-		case "name":
-			if a.Name != b.Name {
-				if ascending {
-					return a.Name < b.Name
-				} else {
-					return a.Name > b.Name
-				}
-			}
-		case "size":
-			if a.Size != b.Size {
-				if ascending {
-					return a.Size < b.Size
-				} else {
-					return a.Size > b.Size
-				}
-			}
-		case "time":
-			if !a.ModifiedTime.Equal(b.ModifiedTime) {
-				if ascending {
-					return a.ModifiedTime.Before(b.ModifiedTime)
-				} else {
-					return a.ModifiedTime.After(b.ModifiedTime)
-				}
-			}
-		case "type":
-			if a.Type != b.Type {
-				if ascending {
-					return a.Type < b.Type
-				} else {
-					return a.Type > b.Type
-				}
-			}
-		}
-
-		// 最后按名称排序作为默认
-		if ascending {
-			return a.Name < b.Name
-		} else {
-			return a.Name > b.Name
-		}
-	}
-
-	// 冒泡排序
-	for i := 0; i < len(files)-1; i++ {
-		for j := 0; j < len(files)-i-1; j++ {
-			if compare(files[j+1], files[j]) {
-				files[j], files[j+1] = files[j+1], files[j]
-			}
-		}
-	}
-
-	return files, nil
-}
-
-// getFileType 获取文件类型
-func getFileType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	if ext == "" {
-		return "file"
-	}
-
-	// 图片类型
-	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".svg"}
-	for _, e := range imageExts {
-		if ext == e {
-			return "image"
-		}
-	}
-
-	// 文档类型
-	docExts := []string{".txt", ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".md"}
-	for _, e := range docExts {
-		if ext == e {
-			return "document"
-		}
-	}
-
-	// 视频类型
-	videoExts := []string{".mp4", ".avi", ".mov", ".wmv", ".flv"}
-	for _, e := range videoExts {
-		if ext == e {
-			return "video"
-		}
-	}
-
-	// 音频类型
-	audioExts := []string{".mp3", ".wav", ".ogg", ".flac"}
-	for _, e := range audioExts {
-		if ext == e {
-			return "audio"
-		}
-	}
-
-	return "file"
-}
-
-// CreateDirectory 创建目录
-func CreateDirectory(path string) error {
-	uploadPath := config.GetConfig().File.UploadPath
-	fullPath := filepath.Join(uploadPath, path)
-	return os.MkdirAll(fullPath, 0755)
-}
-
-// RenameFile 重命名文件
-func RenameFile(oldPath, newName string) error {
-	uploadPath := config.GetConfig().File.UploadPath
-	oldFullPath := filepath.Join(uploadPath, oldPath)
-	newFullPath := filepath.Join(filepath.Dir(oldFullPath), newName)
-	return os.Rename(oldFullPath, newFullPath)
-}
-
-// MoveFile 移动文件或目录
-func MoveFile(oldPath, newPath string) error {
-	uploadPath := config.GetConfig().File.UploadPath
-
-	// 清理路径，移除可能的控制字符
-	oldPath = strings.TrimSpace(oldPath)
-	newPath = strings.TrimSpace(newPath)
-
-	// 检查路径是否为空
-	if oldPath == "" || newPath == "" {
-		return fmt.Errorf("path cannot be empty")
-	}
-
-	// 构建完整路径，确保路径分隔符正确
-	oldFullPath := filepath.Join(uploadPath, oldPath)
-	newFullPath := filepath.Join(uploadPath, newPath)
-
-	// 检查源文件/目录是否存在
-	_, err := os.Stat(oldFullPath)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("source path does not exist: %s", oldFullPath)
-	}
-
-	// 检查目标路径是否存在
-	newInfo, err := os.Stat(newFullPath)
-
-	// 确定目标是否为目录
-	isDir := false
-	if err == nil {
-		isDir = newInfo.IsDir()
-	} else {
-		// 目标路径不存在，默认视为目录
-		isDir = true
-	}
-
-	// 如果目标是目录，将源移动到该目录下
-	if isDir {
-		// 获取源文件名
-		sourceName := filepath.Base(oldFullPath)
-		newFullPath = filepath.Join(newFullPath, sourceName)
-		// 确保目标目录存在
-		if err := os.MkdirAll(filepath.Dir(newFullPath), 0755); err != nil {
-			return fmt.Errorf("failed to create target directory: %v", err)
-		}
-	} else if os.IsNotExist(err) {
-		// 目标不存在，确保父目录存在
-		if err := os.MkdirAll(filepath.Dir(newFullPath), 0755); err != nil {
-			return fmt.Errorf("failed to create parent directory: %v", err)
-		}
-	}
-
-	// 确保旧路径和新路径不相同
-	if oldFullPath == newFullPath {
-		return nil // 路径相同，无需移动
-	}
-
-	// 执行移动操作
-	if err := os.Rename(oldFullPath, newFullPath); err != nil {
-		return fmt.Errorf("failed to rename: %v, old: %s, new: %s", err, oldFullPath, newFullPath)
-	}
-
-	return nil
-}
-
-// DeleteFile 删除文件或文件夹
-func DeleteFile(path string) error {
-	uploadPath := config.GetConfig().File.UploadPath
-
-	// 清理路径，移除可能的控制字符
-	path = strings.TrimSpace(path)
-
-	// 检查路径是否为空
-	if path == "" {
-		return fmt.Errorf("path cannot be empty")
-	}
-
-	// 构建完整路径
-	fullPath := filepath.Join(uploadPath, path)
-
-	// 检查路径是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return nil // 路径不存在，视为删除成功
-	}
-
-	// 执行删除操作
-	return os.RemoveAll(fullPath)
-}
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrIsDirectory = errors.New("is a directory")
+
+// FileInfo 文件信息
+type FileInfo struct {
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	IsDirectory  bool      `json:"is_directory"`
+	ModifiedTime time.Time `json:"modified_time"`
+	Type         string    `json:"type"`
+}
+
+// ListFiles 列出文件
+func ListFiles(path string, sortBy string, sortOrder string) ([]FileInfo, error) {
+	// 解析路径，确保不会越出上传目录
+	name, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 读取目录
+	entries, err := fileStorage().List(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	for _, info := range entries {
+		// 隐藏根目录下的保留目录
+		if name == "" && info.Name() == SystemDirName {
+			continue
+		}
+
+		file := FileInfo{
+			Name:         info.Name(),
+			Path:         storage.Join(name, info.Name()),
+			Size:         info.Size(),
+			IsDirectory:  info.IsDir(),
+			ModifiedTime: info.ModTime(),
+			Type:         getFileType(info.Name()),
+		}
+
+		files = append(files, file)
+	}
+
+	// 排序文件列表
+	// 首先确保文件夹在文件前面
+	// 然后根据指定字段排序
+	ascending := sortOrder == "asc"
+
+	// 定义比较函数
+	compare := func(a, b FileInfo) bool {
+		// 文件夹始终在文件前面
+		if a.IsDirectory != b.IsDirectory {
+			return a.IsDirectory
+		}
+
+		// 根据排序字段比较
+		switch sortBy {
+		case "name":
+			if a.Name != b.Name {
+				if ascending {
+					return a.Name < b.Name
+				} else {
+					return a.Name > b.Name
+				}
+			}
+		case "size":
+			if a.Size != b.Size {
+				if ascending {
+					return a.Size < b.Size
+				} else {
+					return a.Size > b.Size
+				}
+			}
+		case "time":
+			if !a.ModifiedTime.Equal(b.ModifiedTime) {
+				if ascending {
+					return a.ModifiedTime.Before(b.ModifiedTime)
+				} else {
+					return a.ModifiedTime.After(b.ModifiedTime)
+				}
+			}
+		case "type":
+			if a.Type != b.Type {
+				if ascending {
+					return a.Type < b.Type
+				} else {
+					return a.Type > b.Type
+				}
+			}
+		}
+
+		// 最后按名称排序作为默认
+		if ascending {
+			return a.Name < b.Name
+		} else {
+			return a.Name > b.Name
+		}
+	}
+
+	// 冒泡排序
+	for i := 0; i < len(files)-1; i++ {
+		for j := 0; j < len(files)-i-1; j++ {
+			if compare(files[j+1], files[j]) {
+				files[j], files[j+1] = files[j+1], files[j]
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// getFileType 获取文件类型
+func getFileType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return "file"
+	}
+
+	// 图片类型
+	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".svg"}
+	for _, e := range imageExts {
+		if ext == e {
+			return "image"
+		}
+	}
+
+	// 文档类型
+	docExts := []string{".txt", ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".md"}
+	for _, e := range docExts {
+		if ext == e {
+			return "document"
+		}
+	}
+
+	// 视频类型
+	videoExts := []string{".mp4", ".avi", ".mov", ".wmv", ".flv"}
+	for _, e := range videoExts {
+		if ext == e {
+			return "video"
+		}
+	}
+
+	// 音频类型
+	audioExts := []string{".mp3", ".wav", ".ogg", ".flac"}
+	for _, e := range audioExts {
+		if ext == e {
+			return "audio"
+		}
+	}
+
+	return "file"
+}
+
+// CreateDirectory 创建目录
+func CreateDirectory(path string) error {
+	name, err := ResolveEntryPath(path)
+	if err != nil {
+		return err
+	}
+	return fileStorage().MkdirAll(name)
+}
+
+// StatEntry 获取上传目录中文件或目录的信息
+func StatEntry(path string) (fs.FileInfo, error) {
+	name, err := ResolveEntryPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fileStorage().Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+	return info, err
+}
+
+// OpenFile 打开上传目录中的文件用于读取，返回文件及其信息
+func OpenFile(path string) (storage.File, fs.FileInfo, error) {
+	name, err := ResolveEntryPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, info, err := storage.Open(fileStorage(), name)
+	if errors.Is(err, storage.ErrIsDir) {
+		return nil, nil, fmt.Errorf("%s: %w", path, ErrIsDirectory)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// FileETag 根据文件大小和纳秒级修改时间生成强ETag
+// 文件写入都是先写临时文件再重命名，内容变化时修改时间必然变化
+func FileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// RenameFile 重命名文件，目标已存在时按冲突策略处理，返回重命名后的相对路径
+func RenameFile(oldPath, newName, policy string) (string, error) {
+	// 新名称只能是单级文件名，防止借助分隔符移动到其他目录
+	if err := ValidateName(newName); err != nil {
+		return "", err
+	}
+
+	oldName, err := ResolveEntryPath(oldPath)
+	if err != nil {
+		return "", err
+	}
+	newFullName, err := ResolvePath(storage.Join(storage.Dir(oldName), newName))
+	if err != nil {
+		return "", err
+	}
+
+	info, err := fileStorage().Stat(oldName)
+	if err != nil {
+		return "", err
+	}
+	if oldName == newFullName {
+		return newFullName, nil
+	}
+
+	return moveEntry(oldName, newFullName, info.IsDir(), policy)
+}
+
+// MoveFile 移动文件或目录，目标已存在时按冲突策略处理，返回移动后的相对路径
+func MoveFile(oldPath, newPath, policy string) (string, error) {
+	// 清理路径，移除可能的控制字符
+	oldPath = strings.TrimSpace(oldPath)
+	newPath = strings.TrimSpace(newPath)
+
+	// 检查路径是否为空
+	if oldPath == "" || newPath == "" {
+		return "", fmt.Errorf("path cannot be empty: %w", ErrInvalidPath)
+	}
+
+	// 解析路径，确保不会越出上传目录
+	oldName, err := ResolveEntryPath(oldPath)
+	if err != nil {
+		return "", err
+	}
+	newName, err := ResolvePath(newPath)
+	if err != nil {
+		return "", err
+	}
+
+	// 检查源文件/目录是否存在
+	oldInfo, err := fileStorage().Stat(oldName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("source path does not exist: %s: %w", oldPath, fs.ErrNotExist)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// 目标是目录或不存在时，将源移动到该目录下；目标是已有文件时按冲突策略处理
+	newInfo, err := fileStorage().Stat(newName)
+	if err != nil || newInfo.IsDir() {
+		newName = storage.Join(newName, path.Base(oldName))
+	}
+
+	// 确保旧路径和新路径不相同
+	if oldName == newName {
+		return newName, nil // 路径相同，无需移动
+	}
+
+	// 不能将目录移动到其自身的子目录中
+	if isWithin(oldName, newName) {
+		return "", fmt.Errorf("cannot move a directory into itself: %s: %w", oldPath, ErrInvalidPath)
+	}
+
+	// 执行移动操作，目标的父目录不存在时自动创建
+	finalName, err := moveEntry(oldName, newName, oldInfo.IsDir(), policy)
+	if err != nil {
+		return "", fmt.Errorf("failed to move %s to %s: %w", oldPath, newPath, err)
+	}
+
+	return finalName, nil
+}
+
+// moveEntry 按冲突策略将文件或目录移动到目标位置，返回最终的名称
+func moveEntry(oldName, newName string, srcIsDir bool, policy string) (string, error) {
+	commitMu.Lock()
+	defer commitMu.Unlock()
+
+	target, err := resolveConflict(newName, srcIsDir, policy)
+	if err != nil {
+		return "", err
+	}
+	if err := archiveVersion(target); err != nil {
+		return "", err
+	}
+	if err := fileStorage().Rename(oldName, target); err != nil {
+		return "", err
+	}
+
+	// 从回收站恢复时版本本就记录在原路径下，只有用户目录之间的移动需要迁移版本
+	if !isWithin(SystemDirName, oldName) {
+		moveVersions(oldName, target, srcIsDir)
+	}
+	return target, nil
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/storage"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SystemDirName 上传目录中的保留目录，存放分片上传等内部数据，对用户不可见
+const SystemDirName = ".drive"
+
+var (
+	ErrPathEscape  = storage.ErrPathEscape
+	ErrInvalidPath = errors.New("invalid path")
+	ErrInvalidName = errors.New("invalid file name")
+)
+
+// ResolvePath 将用户提交的相对路径解析为存储中的名称，上传根目录为空字符串
+// 路径经过清理后必须位于上传目录之内，本地存储解析符号链接后仍不能指向上传目录之外
+func ResolvePath(rel string) (string, error) {
+	if strings.ContainsRune(rel, 0) {
+		return "", ErrInvalidPath
+	}
+	if filepath.VolumeName(filepath.FromSlash(rel)) != "" {
+		return "", ErrPathEscape
+	}
+
+	// 开头的斜杠视为上传根目录
+	name := path.Clean(strings.TrimLeft(filepath.ToSlash(rel), "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", ErrPathEscape
+	}
+	if name == "." {
+		name = ""
+	}
+	// 保留目录不允许通过用户路径访问
+	if isWithin(SystemDirName, name) {
+		return "", ErrPathEscape
+	}
+
+	// 符号链接可能指向任意位置，需要比较解析后的真实路径
+	if r, ok := fileStorage().(storage.Resolver); ok {
+		if _, err := r.RealPath(name); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// ResolveEntryPath 解析指向具体文件或目录的路径，不允许指向上传根目录本身
+func ResolveEntryPath(rel string) (string, error) {
+	name, err := ResolvePath(strings.TrimSpace(rel))
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", ErrInvalidPath
+	}
+	return name, nil
+}
+
+// ResolveSubPath 将sub拼接到base目录下，返回拼接后的相对路径
+// sub中的..不能越过base，本地存储解析符号链接后的真实路径也必须位于base之内
+func ResolveSubPath(base, sub string) (string, error) {
+	sub = strings.Trim(path.Clean("/"+filepath.ToSlash(sub)), "/")
+	if sub == "" {
+		return base, nil
+	}
+
+	baseName, err := ResolveEntryPath(base)
+	if err != nil {
+		return "", err
+	}
+	rel := path.Join(filepath.ToSlash(base), sub)
+	name, err := ResolveEntryPath(rel)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(baseName, name) {
+		return "", ErrPathEscape
+	}
+
+	if r, ok := fileStorage().(storage.Resolver); ok {
+		realBase, err := r.RealPath(baseName)
+		if err != nil {
+			return "", err
+		}
+		realPath, err := r.RealPath(name)
+		if err != nil {
+			return "", err
+		}
+		if !storage.WithinDir(realBase, realPath) {
+			return "", ErrPathEscape
+		}
+	}
+	return rel, nil
+}
+
+// PermissionPaths 权限检查需要覆盖的路径：用户提交的路径，以及解析符号链接后的真实路径
+// 指向其他目录的符号链接既受链接所在位置的权限约束，也受目标位置的权限约束；无法解析时只返回原路径，由后续的路径解析拒绝请求
+func PermissionPaths(rel string) []string {
+	paths := []string{rel}
+	name, err := ResolvePath(rel)
+	if err != nil {
+		return paths
+	}
+	if name != rel {
+		paths = append(paths, name)
+	}
+
+	r, ok := fileStorage().(storage.Resolver)
+	if !ok {
+		return paths
+	}
+	realRoot, err := r.RealPath("")
+	if err != nil {
+		return paths
+	}
+	realPath, err := r.RealPath(name)
+	if err != nil {
+		return paths
+	}
+	target, err := filepath.Rel(realRoot, realPath)
+	if err != nil || !storage.WithinDir(realRoot, realPath) {
+		return paths
+	}
+	if target = filepath.ToSlash(target); target == "." {
+		target = ""
+	}
+	if target != name {
+		paths = append(paths, target)
+	}
+	return paths
+}
+
+// systemPath 获取保留目录下的名称，仅供内部使用
+func systemPath(elem ...string) string {
+	return path.Join(append([]string{SystemDirName}, elem...)...)
+}
+
+// ValidateName 检查文件名是否为单级名称，不能包含路径分隔符
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return ErrInvalidName
+	}
+	if strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, 0) {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// isWithin 判断存储中的名称name是否等于root或位于root之下，root为空表示上传根目录
+func isWithin(root, name string) bool {
+	return root == "" || name == root || strings.HasPrefix(name, root+"/")
+}
@@ -0,0 +1,243 @@
+package utils_test
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// root 测试使用的本地上传目录，outside 位于上传目录之外的目录
+var root, outside string
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	tmp, err := os.MkdirTemp("", "gcd-utils-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root = filepath.Join(tmp, "uploads")
+	outside = filepath.Join(tmp, "outside")
+	cfg := config.Default()
+	cfg.File.UploadPath = root
+	config.SetConfig(cfg)
+
+	local, err := storage.NewLocal(root, filepath.Join(root, utils.SystemDirName, "tmp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetStorage(local)
+
+	// uploads/
+	//   docs/sub/
+	//   docs/out     -> outside
+	//   docs/up      -> uploads/other
+	//   other/
+	//   inside       -> uploads/docs
+	//   escape       -> outside
+	//   dangling     -> uploads/missing
+	for _, dir := range []string{"docs/sub", "other", utils.SystemDirName} {
+		must(os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	must(os.MkdirAll(outside, 0755))
+	must(os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	must(os.Symlink(outside, filepath.Join(root, "docs", "out")))
+	must(os.Symlink(filepath.Join(root, "other"), filepath.Join(root, "docs", "up")))
+	must(os.Symlink(filepath.Join(root, "docs"), filepath.Join(root, "inside")))
+	must(os.Symlink(outside, filepath.Join(root, "escape")))
+	must(os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "dangling")))
+
+	return m.Run()
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// anyError 表示只要求返回错误，不限定具体类型
+var anyError = errors.New("any error")
+
+func checkResult(t *testing.T, got string, err error, want string, wantErr error) {
+	t.Helper()
+	switch {
+	case wantErr == anyError:
+		if err == nil {
+			t.Fatalf("got %q, want an error", got)
+		}
+	case wantErr != nil:
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("got %q, %v, want %v", got, err, wantErr)
+		}
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case got != want:
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		rel     string
+		want    string
+		wantErr error
+	}{
+		// 上传根目录
+		{"", "", nil},
+		{"/", "", nil},
+		{".", "", nil},
+		{"docs/..", "", nil},
+
+		// 清理后位于上传目录之内
+		{"docs/sub", "docs/sub", nil},
+		{"/docs/sub/", "docs/sub", nil},
+		{"docs//./sub", "docs/sub", nil},
+		{"docs/../docs/sub", "docs/sub", nil},
+		{"new/file.txt", "new/file.txt", nil},
+
+		// ..越过上传目录
+		{"..", "", utils.ErrPathEscape},
+		{"../", "", utils.ErrPathEscape},
+		{"../uploads/docs", "", utils.ErrPathEscape},
+		{"docs/../../outside", "", utils.ErrPathEscape},
+		{"docs/sub/../../..", "", utils.ErrPathEscape},
+
+		// 绝对路径视为相对于上传目录，不能借此越过上传目录
+		{"/etc/passwd", "etc/passwd", nil},
+		{"//../etc/passwd", "", utils.ErrPathEscape},
+
+		// 路径不做URL解码，编码的..只是普通文件名
+		{"%2e%2e", "%2e%2e", nil},
+		{"%2e%2e/%2e%2e/etc/passwd", "%2e%2e/%2e%2e/etc/passwd", nil},
+		{"..%2f..%2fetc", "..%2f..%2fetc", nil},
+
+		// 反斜杠和Windows盘符不是合法的名称
+		{`..\..\etc`, "", anyError},
+		{`docs\..\..\etc`, "", anyError},
+		{`C:\Windows`, "", anyError},
+
+		// NUL字符
+		{"docs\x00.txt", "", utils.ErrInvalidPath},
+		{"\x00", "", utils.ErrInvalidPath},
+
+		// 保留目录
+		{utils.SystemDirName, "", utils.ErrPathEscape},
+		{"/" + utils.SystemDirName + "/uploads/x", "", utils.ErrPathEscape},
+		{"docs/../" + utils.SystemDirName, "", utils.ErrPathEscape},
+		{utils.SystemDirName + "x", utils.SystemDirName + "x", nil},
+		{"docs/" + utils.SystemDirName, "docs/" + utils.SystemDirName, nil},
+
+		// 符号链接
+		{"escape", "", utils.ErrPathEscape},
+		{"escape/secret.txt", "", utils.ErrPathEscape},
+		{"docs/out/secret.txt", "", utils.ErrPathEscape},
+		{"docs/out/new.txt", "", utils.ErrPathEscape},
+		{"dangling", "", utils.ErrPathEscape},
+		{"dangling/new.txt", "", utils.ErrPathEscape},
+		{"inside/sub", "inside/sub", nil},
+		{"docs/up", "docs/up", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := utils.ResolvePath(tt.rel)
+		t.Run(tt.rel, func(t *testing.T) {
+			checkResult(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestResolveEntryPath(t *testing.T) {
+	for _, rel := range []string{"", "/", " ", ".", "docs/.."} {
+		if got, err := utils.ResolveEntryPath(rel); !errors.Is(err, utils.ErrInvalidPath) {
+			t.Fatalf("ResolveEntryPath(%q) = %q, %v, want ErrInvalidPath", rel, got, err)
+		}
+	}
+	if got, err := utils.ResolveEntryPath(" docs/sub "); err != nil || got != "docs/sub" {
+		t.Fatalf("ResolveEntryPath with spaces = %q, %v", got, err)
+	}
+}
+
+func TestResolveSubPath(t *testing.T) {
+	tests := []struct {
+		base, sub string
+		want      string
+		wantErr   error
+	}{
+		{"docs", "", "docs", nil},
+		{"docs", "sub", "docs/sub", nil},
+		{"docs", "sub/new.txt", "docs/sub/new.txt", nil},
+
+		// sub中的..和开头的斜杠不能越过base
+		{"docs", "..", "docs", nil},
+		{"docs", "../other", "docs/other", nil},
+		{"docs", "../../etc/passwd", "docs/etc/passwd", nil},
+		{"docs", "sub/../..", "docs", nil},
+		{"docs", "/etc/passwd", "docs/etc/passwd", nil},
+		{"docs", "%2e%2e/x", "docs/%2e%2e/x", nil},
+		{"docs", "../escape/secret.txt", "docs/escape/secret.txt", nil},
+
+		// 非法的sub
+		{"docs", `..\..\etc`, "", anyError},
+		{"docs", "a\x00b", "", utils.ErrInvalidPath},
+
+		// base本身必须合法
+		{"..", "x", "", utils.ErrPathEscape},
+		{"../outside", "secret.txt", "", utils.ErrPathEscape},
+		{"", "x", "", utils.ErrInvalidPath},
+		{utils.SystemDirName, "x", "", utils.ErrPathEscape},
+		{"escape", "secret.txt", "", utils.ErrPathEscape},
+
+		// 符号链接指向base之外
+		{"docs", "out/secret.txt", "", utils.ErrPathEscape},
+		{"docs", "up", "", utils.ErrPathEscape},
+		{"docs", "up/new.txt", "", utils.ErrPathEscape},
+
+		// base本身是指向上传目录内的符号链接
+		{"inside", "sub", "inside/sub", nil},
+		{"inside", "up", "", utils.ErrPathEscape},
+	}
+
+	for _, tt := range tests {
+		got, err := utils.ResolveSubPath(tt.base, tt.sub)
+		t.Run(tt.base+"+"+tt.sub, func(t *testing.T) {
+			checkResult(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestPermissionPaths(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want []string
+	}{
+		{"docs/sub", []string{"docs/sub"}},
+		{"/docs/sub/", []string{"/docs/sub/", "docs/sub"}},
+		{"inside/sub", []string{"inside/sub", "docs/sub"}},
+		{"docs/up/file.txt", []string{"docs/up/file.txt", "other/file.txt"}},
+		// 无法解析的路径只返回原路径
+		{"escape/secret.txt", []string{"escape/secret.txt"}},
+		{"../x", []string{"../x"}},
+	}
+
+	for _, tt := range tests {
+		got := utils.PermissionPaths(tt.rel)
+		if len(got) != len(tt.want) {
+			t.Fatalf("PermissionPaths(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("PermissionPaths(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFileTooLarge  = errors.New("file exceeds size limit")
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// 配额针对整个上传目录：文件不记录所有者，不按用户分别统计和限制
+
+// usageCacheTTL 存储用量缓存有效期，避免每次上传都遍历整个上传目录
+const usageCacheTTL = 30 * time.Second
+
+// StorageUsage 存储用量信息
+type StorageUsage struct {
+	Used        int64 `json:"used"`          // 已用空间（字节）
+	Quota       int64 `json:"quota"`         // 总配额（字节），0表示不限制
+	Available   int64 `json:"available"`     // 剩余空间（字节），不限制时为-1
+	MaxFileSize int64 `json:"max_file_size"` // 单个文件最大大小（字节），0表示不限制
+}
+
+var usageCache struct {
+	used      int64
+	reserved  int64 // 正在写入的上传预留的字节数，尚未计入used
+	updatedAt time.Time
+	mu        sync.Mutex
+}
+
+// CheckUploadSize 检查即将写入的数据是否超过单文件大小限制和存储配额
+func CheckUploadSize(size int64) error {
+	cfg := config.GetConfig().File
+	if cfg.MaxSize > 0 && size > cfg.MaxSize {
+		return ErrFileTooLarge
+	}
+	return CheckQuota(size)
+}
+
+// CheckQuota 检查是否还有足够的配额写入additional字节，其他上传预留的空间视为已用
+func CheckQuota(additional int64) error {
+	quota := config.GetConfig().File.Quota
+	if quota <= 0 {
+		return nil
+	}
+
+	used, err := committedSpace()
+	if err != nil {
+		return err
+	}
+	if used+additional > quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// ReserveUploadSize 检查单文件大小限制并为即将写入的数据预留配额，返回释放预留的函数
+func ReserveUploadSize(size int64) (func(), error) {
+	cfg := config.GetConfig().File
+	if cfg.MaxSize > 0 && size > cfg.MaxSize {
+		return nil, ErrFileTooLarge
+	}
+	return ReserveQuota(size)
+}
+
+// ReserveQuota 在检查配额的同时预留additional字节，写入结束后调用返回的函数释放
+// 检查和预留在同一把锁内完成，并发的上传不会各自通过检查后合计超出配额；
+// 写入成功时应先调用InvalidateUsage再释放，让新写入的数据计入用量
+func ReserveQuota(additional int64) (func(), error) {
+	quota := config.GetConfig().File.Quota
+	if quota <= 0 || additional <= 0 {
+		return func() {}, nil
+	}
+
+	usageCache.mu.Lock()
+	defer usageCache.mu.Unlock()
+
+	used, err := usedSpaceLocked()
+	if err != nil {
+		return nil, err
+	}
+	if used+usageCache.reserved+additional > quota {
+		return nil, ErrQuotaExceeded
+	}
+	usageCache.reserved += additional
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			usageCache.mu.Lock()
+			defer usageCache.mu.Unlock()
+			usageCache.reserved -= additional
+		})
+	}, nil
+}
+
+// UploadLimit 获取本次上传允许写入的最大字节数，-1表示不限制
+func UploadLimit() (int64, error) {
+	cfg := config.GetConfig().File
+	limit := cfg.MaxSize
+	if limit <= 0 {
+		limit = -1
+	}
+
+	available, err := availableSpace()
+	if err != nil {
+		return 0, err
+	}
+	if available >= 0 && (limit < 0 || available < limit) {
+		limit = available
+	}
+
+	return limit, nil
+}
+
+// availableSpace 获取配额剩余空间（扣除其他上传预留的空间），-1表示不限制
+func availableSpace() (int64, error) {
+	quota := config.GetConfig().File.Quota
+	if quota <= 0 {
+		return -1, nil
+	}
+
+	used, err := committedSpace()
+	if err != nil {
+		return 0, err
+	}
+	if used > quota {
+		return 0, nil
+	}
+	return quota - used, nil
+}
+
+// GetStorageUsage 获取存储用量
+func GetStorageUsage() (StorageUsage, error) {
+	cfg := config.GetConfig().File
+	used, err := usedSpace()
+	if err != nil {
+		return StorageUsage{}, err
+	}
+
+	usage := StorageUsage{
+		Used:        used,
+		Quota:       cfg.Quota,
+		Available:   -1,
+		MaxFileSize: cfg.MaxSize,
+	}
+	if cfg.Quota > 0 {
+		usage.Available = cfg.Quota - used
+		if usage.Available < 0 {
+			usage.Available = 0
+		}
+	}
+	return usage, nil
+}
+
+// InvalidateUsage 文件写入或删除后使用量缓存失效
+func InvalidateUsage() {
+	usageCache.mu.Lock()
+	defer usageCache.mu.Unlock()
+	usageCache.updatedAt = time.Time{}
+}
+
+// committedSpace 已用空间加上正在写入的上传预留的空间
+func committedSpace() (int64, error) {
+	usageCache.mu.Lock()
+	defer usageCache.mu.Unlock()
+
+	used, err := usedSpaceLocked()
+	if err != nil {
+		return 0, err
+	}
+	return used + usageCache.reserved, nil
+}
+
+// usedSpace 统计存储中所有文件（包括保留目录中的临时数据）占用的空间
+func usedSpace() (int64, error) {
+	usageCache.mu.Lock()
+	defer usageCache.mu.Unlock()
+	return usedSpaceLocked()
+}
+
+// usedSpaceLocked 同usedSpace，调用方需持有usageCache.mu
+func usedSpaceLocked() (int64, error) {
+	if time.Since(usageCache.updatedAt) < usageCacheTTL {
+		return usageCache.used, nil
+	}
+
+	var used int64
+	err := storage.Walk(fileStorage(), "", func(name string, info fs.FileInfo) error {
+		if info.Mode().IsRegular() {
+			used += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	usageCache.used = used
+	usageCache.updatedAt = time.Now()
+	return used, nil
+}
@@ -0,0 +1,75 @@
+package utils_test
+
+import (
+	"bytes"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/utils"
+	"testing"
+)
+
+// useQuota 在测试期间使用空的内存存储和指定的配额
+func useQuota(t *testing.T, quota int64) {
+	t.Helper()
+	useStorage(t, storage.NewMemory())
+	cfg := config.GetConfig()
+	previous := cfg.File.Quota
+	cfg.File.Quota = quota
+	utils.InvalidateUsage()
+	t.Cleanup(func() {
+		cfg.File.Quota = previous
+		utils.InvalidateUsage()
+	})
+}
+
+func TestReserveQuota(t *testing.T) {
+	useQuota(t, 100)
+
+	release, err := utils.ReserveQuota(60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 预留的空间视为已用，并发的上传不能合计超出配额
+	if _, err := utils.ReserveQuota(50); !errors.Is(err, utils.ErrQuotaExceeded) {
+		t.Fatalf("second reservation: err = %v", err)
+	}
+	if err := utils.CheckQuota(50); !errors.Is(err, utils.ErrQuotaExceeded) {
+		t.Fatalf("check with reservation: err = %v", err)
+	}
+
+	release()
+	release() // 重复释放不会多减
+	second, err := utils.ReserveQuota(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CheckQuota(1); !errors.Is(err, utils.ErrQuotaExceeded) {
+		t.Fatalf("check after double release: err = %v", err)
+	}
+	second()
+}
+
+func TestUploadChunkUpdatesUsage(t *testing.T) {
+	useQuota(t, 10000)
+
+	session, err := utils.CreateUploadSession("admin", "", "chunked.bin", 6000, "", utils.ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 会话元数据也保存在存储中，只占很少的空间
+	if err := utils.CheckQuota(9000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := utils.WriteUploadChunk(session.ID, "admin", 0, bytes.NewReader(make([]byte, 3000))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已写入的分片立即计入用量，不等缓存过期
+	if err := utils.CheckQuota(7001); !errors.Is(err, utils.ErrQuotaExceeded) {
+		t.Fatalf("check after chunk: err = %v", err)
+	}
+	if err := utils.CancelUploadSession(session.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 存储驱动
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+var (
+	ErrStorageConfig      = errors.New("invalid storage configuration")
+	ErrEncryptionDisabled = errors.New("encryption at rest is not enabled")
+)
+
+// KeyRotationResult 密钥轮换的结果
+type KeyRotationResult struct {
+	Files     int      `json:"files"`     // 检查的文件数
+	Rewrapped int      `json:"rewrapped"` // 改用当前主密钥的文件数（包括新加密的明文文件）
+	Failed    []string `json:"failed"`    // 处理失败的文件
+}
+
+var (
+	fileStore   storage.Storage
+	fileStoreMu sync.RWMutex
+)
+
+// InitStorage 按file.storage配置创建存储驱动，所有文件操作都通过该驱动进行
+func InitStorage() error {
+	s, err := newStorage(config.GetConfig().File)
+	if err != nil {
+		return err
+	}
+
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	fileStore = s
+	return nil
+}
+
+// SetStorage 替换存储驱动，测试中用于注入内存驱动
+func SetStorage(s storage.Storage) {
+	fileStoreMu.Lock()
+	fileStore = s
+	fileStoreMu.Unlock()
+
+	InvalidateUsage()
+}
+
+// newStorage 创建配置的存储驱动，开启静态加密时在外层包装加密驱动
+func newStorage(cfg config.FileConfig) (storage.Storage, error) {
+	s, err := newDriver(cfg)
+	if err != nil || !cfg.Encryption.Enabled {
+		return s, err
+	}
+
+	key, previous, err := loadEncryptionKeys(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStorageConfig, err)
+	}
+	enc, err := storage.NewEncrypted(s, key, previous...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStorageConfig, err)
+	}
+	return enc, nil
+}
+
+// newDriver 按file.storage创建底层存储驱动
+func newDriver(cfg config.FileConfig) (storage.Storage, error) {
+	switch cfg.Storage {
+	case "", StorageLocal:
+		// Write的临时文件放在保留目录中，与目标位于同一文件系统
+		return storage.NewLocal(cfg.UploadPath, filepath.Join(cfg.UploadPath, SystemDirName, "tmp"))
+	case StorageS3:
+		s, err := storage.NewS3(storage.S3Options{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			Prefix:          cfg.S3.Prefix,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			PathStyle:       cfg.S3.PathStyle,
+			Timeout:         time.Duration(cfg.S3.Timeout) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrStorageConfig, err)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%w: storage应为local或s3", ErrStorageConfig)
+	}
+}
+
+// fileStorage 获取当前的存储驱动，未初始化时按配置创建
+func fileStorage() storage.Storage {
+	fileStoreMu.RLock()
+	s := fileStore
+	fileStoreMu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	fileStoreMu.Lock()
+	defer fileStoreMu.Unlock()
+	if fileStore == nil {
+		s, err := newStorage(config.GetConfig().File)
+		if err != nil {
+			panic(err)
+		}
+		fileStore = s
+	}
+	return fileStore
+}
+
+// loadEncryptionKeys 读取主密钥，配置了密钥文件时从文件读取：第一行为当前主密钥，其余非空行为旧主密钥
+func loadEncryptionKeys(cfg config.EncryptionConfig) ([]byte, [][]byte, error) {
+	lines := append([]string{cfg.Key}, cfg.PreviousKeys...)
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines = nil
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, nil, errors.New("encryption开启时需要配置key或key_file")
+	}
+
+	keys := make([][]byte, 0, len(lines))
+	for i, line := range lines {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("第%d个主密钥不是有效的base64: %v", i+1, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys[0], keys[1:], nil
+}
+
+// RotateEncryptionKeys 让所有文件改用当前主密钥：旧主密钥加密的文件重新包装数据密钥，明文文件被加密
+// 旧主密钥需要保留在配置中直到轮换完成，失败的文件记录在结果中，可以再次执行
+func RotateEncryptionKeys() (KeyRotationResult, error) {
+	result := KeyRotationResult{Failed: []string{}}
+	enc, ok := fileStorage().(*storage.Encrypted)
+	if !ok {
+		return result, ErrEncryptionDisabled
+	}
+
+	// 临时目录中是正在写入的文件，由写入方负责清理
+	tmp := systemPath("tmp")
+	err := storage.Walk(enc, "", func(name string, info fs.FileInfo) error {
+		if name == tmp {
+			return fs.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		result.Files++
+		// 与上传、还原版本等提交操作串行，避免改写期间文件被替换
+		commitMu.Lock()
+		changed, err := enc.Rewrap(name)
+		commitMu.Unlock()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			result.Files--
+		case err != nil:
+			result.Failed = append(result.Failed, name)
+		case changed:
+			result.Rewrapped++
+		}
+		return nil
+	})
+	InvalidateUsage()
+	return result, err
+}
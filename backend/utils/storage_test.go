@@ -0,0 +1,104 @@
+package utils_test
+
+import (
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/utils"
+)
+
+// useStorage 在测试期间替换文件存储，结束后恢复为本地上传目录
+func useStorage(t *testing.T, s storage.Storage) {
+	t.Helper()
+	utils.SetStorage(s)
+	t.Cleanup(func() {
+		local, err := storage.NewLocal(root, filepath.Join(root, utils.SystemDirName, "tmp"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		utils.SetStorage(local)
+	})
+}
+
+func encrypted(t *testing.T, inner storage.Storage, key []byte, previous ...[]byte) *storage.Encrypted {
+	t.Helper()
+	e, err := storage.NewEncrypted(inner, key, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func masterKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	oldKey, newKey, lostKey := masterKey(t), masterKey(t), masterKey(t)
+	mem := storage.NewMemory()
+
+	files := map[string]string{
+		"a.txt":         "old key",
+		"docs/b.txt":    "old key in a subdirectory",
+		"docs/new.txt":  "already on the new key",
+		"plain.txt":     "written before encryption",
+		"docs/lost.txt": "key no longer configured",
+	}
+	must(storage.WriteFile(encrypted(t, mem, oldKey), "a.txt", []byte(files["a.txt"])))
+	must(storage.WriteFile(encrypted(t, mem, oldKey), "docs/b.txt", []byte(files["docs/b.txt"])))
+	must(storage.WriteFile(encrypted(t, mem, newKey), "docs/new.txt", []byte(files["docs/new.txt"])))
+	must(storage.WriteFile(mem, "plain.txt", []byte(files["plain.txt"])))
+	must(storage.WriteFile(encrypted(t, mem, lostKey), "docs/lost.txt", []byte(files["docs/lost.txt"])))
+	// 正在写入的临时文件不参与轮换
+	tmpFile := utils.SystemDirName + "/tmp/upload-1"
+	must(storage.WriteFile(mem, tmpFile, []byte("partial")))
+
+	useStorage(t, encrypted(t, mem, newKey, oldKey))
+	result, err := utils.RotateEncryptionKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 5 || result.Rewrapped != 3 || !slices.Equal(result.Failed, []string{"docs/lost.txt"}) {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// 去掉旧主密钥后，轮换过的文件仍然可读
+	current := encrypted(t, mem, newKey)
+	for name, want := range files {
+		got, err := storage.ReadFile(current, name)
+		if name == "docs/lost.txt" {
+			if !errors.Is(err, storage.ErrUnknownKey) {
+				t.Fatalf("%s: err = %v, want ErrUnknownKey", name, err)
+			}
+			continue
+		}
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q, %v", name, got, err)
+		}
+	}
+	if raw, _ := storage.ReadFile(mem, tmpFile); string(raw) != "partial" {
+		t.Fatalf("temporary file was rewritten: %q", raw)
+	}
+
+	// 再次执行不会改写已使用当前主密钥的文件
+	result, err = utils.RotateEncryptionKeys()
+	if err != nil || result.Files != 5 || result.Rewrapped != 0 || len(result.Failed) != 1 {
+		t.Fatalf("second run = %+v, %v", result, err)
+	}
+}
+
+func TestRotateEncryptionKeysDisabled(t *testing.T) {
+	useStorage(t, storage.NewMemory())
+	if _, err := utils.RotateEncryptionKeys(); !errors.Is(err, utils.ErrEncryptionDisabled) {
+		t.Fatalf("err = %v, want ErrEncryptionDisabled", err)
+	}
+}
@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+// TrashItem 回收站条目
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	OriginalPath string    `json:"original_path"` // 删除前的相对路径
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"` // 目录为其中所有文件大小之和
+	DeletedBy    string    `json:"deleted_by"`
+	DeletedAt    time.Time `json:"deleted_at"`
+}
+
+// trashMu 串行化回收站条目的移入、恢复和清除
+var trashMu sync.Mutex
+
+// InitTrashCleaner 启动回收站过期条目的清理协程
+func InitTrashCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			PurgeExpiredTrash()
+			<-ticker.C
+		}
+	}()
+}
+
+// DeleteFile 将文件或目录移入回收站，返回回收站条目
+func DeleteFile(path, deletedBy string) (*TrashItem, error) {
+	// 清理路径，移除可能的控制字符
+	path = strings.TrimSpace(path)
+
+	// 检查路径是否为空
+	if path == "" {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+
+	// 解析路径，确保不会越出上传目录
+	name, err := ResolveEntryPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fileStorage().Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("path does not exist: %s: %w", path, fs.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	item := &TrashItem{
+		ID:           id,
+		Name:         info.Name(),
+		OriginalPath: name,
+		IsDir:        info.IsDir(),
+		Size:         entrySize(name, info),
+		DeletedBy:    deletedBy,
+		DeletedAt:    time.Now(),
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	// 先写元数据再移动，移动失败时删除元数据，避免出现无法恢复的数据
+	if err := saveTrashItem(item); err != nil {
+		return nil, err
+	}
+	dataPath, metaPath := trashFilePaths(id)
+	if err := fileStorage().Rename(name, dataPath); err != nil {
+		fileStorage().Remove(metaPath)
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ListTrash 列出回收站中的条目，最近删除的在前
+func ListTrash() ([]TrashItem, error) {
+	entries, err := fileStorage().List(systemPath("trash"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []TrashItem{}, nil
+		}
+		return nil, err
+	}
+
+	items := []TrashItem{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		item, err := loadTrashItem(id)
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// GetTrashItem 获取回收站条目
+func GetTrashItem(id string) (*TrashItem, error) {
+	return loadTrashItem(id)
+}
+
+// RestoreTrashItem 将条目恢复到原位置，原位置已存在时按冲突策略处理，返回恢复后的相对路径
+func RestoreTrashItem(id, policy string) (string, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	item, err := loadTrashItem(id)
+	if err != nil {
+		return "", err
+	}
+
+	// 原路径在删除时已校验过，恢复前仍需重新解析，防止期间出现指向目录外的符号链接
+	name, err := ResolveEntryPath(item.OriginalPath)
+	if err != nil {
+		return "", err
+	}
+
+	dataPath, metaPath := trashFilePaths(id)
+	finalName, err := moveEntry(dataPath, name, item.IsDir, policy)
+	if err != nil {
+		return "", err
+	}
+	fileStorage().Remove(metaPath)
+
+	return finalName, nil
+}
+
+// PurgeTrashItem 彻底删除回收站中的条目
+func PurgeTrashItem(id string) error {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	if _, err := loadTrashItem(id); err != nil {
+		return err
+	}
+	return removeTrashItem(id)
+}
+
+// EmptyTrash 清空回收站，返回删除的条目数
+func EmptyTrash() (int, error) {
+	items, err := ListTrash()
+	if err != nil {
+		return 0, err
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	count := 0
+	for _, item := range items {
+		if err := removeTrashItem(item.ID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// PurgeExpiredTrash 彻底删除超过保留期的条目，保留期为0时不自动清理
+func PurgeExpiredTrash() {
+	retention := time.Duration(config.GetConfig().File.TrashRetention) * time.Second
+	if retention <= 0 {
+		return
+	}
+
+	items, err := ListTrash()
+	if err != nil {
+		return
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	for _, item := range items {
+		if time.Since(item.DeletedAt) > retention {
+			removeTrashItem(item.ID)
+		}
+	}
+}
+
+// trashFilePaths 获取条目的数据和元数据文件在存储中的名称
+func trashFilePaths(id string) (string, string) {
+	return systemPath("trash", id), systemPath("trash", id+".json")
+}
+
+// loadTrashItem 读取条目元数据
+func loadTrashItem(id string) (*TrashItem, error) {
+	if !validID(id) {
+		return nil, ErrTrashItemNotFound
+	}
+
+	_, metaPath := trashFilePaths(id)
+	data, err := storage.ReadFile(fileStorage(), metaPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrTrashItemNotFound
+		}
+		return nil, err
+	}
+
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// saveTrashItem 保存条目元数据，存储驱动保证写入中断时不会留下不完整的文件
+func saveTrashItem(item *TrashItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, metaPath := trashFilePaths(item.ID)
+	return storage.WriteFile(fileStorage(), metaPath, data)
+}
+
+// removeTrashItem 删除条目的数据和元数据
+func removeTrashItem(id string) error {
+	dataPath, metaPath := trashFilePaths(id)
+	if err := fileStorage().Remove(dataPath); err != nil {
+		return err
+	}
+	defer InvalidateUsage()
+	return fileStorage().Remove(metaPath)
+}
+
+// entrySize 计算文件大小，目录则累加其中所有普通文件的大小
+func entrySize(name string, info fs.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+
+	var size int64
+	storage.Walk(fileStorage(), name, func(_ string, info fs.FileInfo) error {
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
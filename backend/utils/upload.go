@@ -0,0 +1,551 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload session not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadIncomplete     = errors.New("upload is incomplete")
+	ErrUploadTooLarge       = errors.New("upload exceeds declared size")
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+	ErrInvalidChecksum      = errors.New("invalid checksum")
+)
+
+// UploadSession 分片上传会话
+type UploadSession struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Path      string    `json:"path"`     // 目标目录（相对上传目录）
+	Filename  string    `json:"filename"` // 目标文件名
+	Size      int64     `json:"size"`     // 文件总大小
+	Offset    int64     `json:"offset"`   // 已接收字节数
+	Checksum  string    `json:"checksum"` // 期望的SHA-256（十六进制），可为空
+	Conflict  string    `json:"conflict"` // 目标已存在时的处理策略
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RelativePath 上传完成后文件的相对路径
+func (s *UploadSession) RelativePath() string {
+	return filepath.Join(s.Path, s.Filename)
+}
+
+var (
+	uploadMu    sync.Mutex
+	uploadLocks = make(map[string]*uploadLock) // 会话ID -> 写入锁，没有请求持有或等待时删除
+
+	// commitMu 串行化冲突检查与重命名，避免并发上传选中同一个目标名
+	commitMu sync.Mutex
+)
+
+// InitUploadCleaner 启动过期分片上传会话的清理协程
+func InitUploadCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			CleanStaleUploads()
+			<-ticker.C
+		}
+	}()
+}
+
+// SaveUpload 将上传数据先写入临时文件，成功后再按冲突策略移动到目标路径
+// limit为允许写入的最大字节数，-1表示不限制；返回最终的相对路径和写入的字节数
+func SaveUpload(relativePath string, src io.Reader, limit int64, policy string) (string, int64, error) {
+	name, err := ResolveEntryPath(relativePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmpPath, err := tempName("upload")
+	if err != nil {
+		return "", 0, err
+	}
+	// 任何失败都不会在目标位置留下不完整的文件
+	defer fileStorage().Remove(tmpPath)
+
+	reader := src
+	if limit >= 0 {
+		reader = io.LimitReader(src, limit+1)
+	}
+	size, err := fileStorage().Write(tmpPath, reader)
+	if err != nil {
+		return "", 0, err
+	}
+	if limit >= 0 && size > limit {
+		return "", 0, ErrFileTooLarge
+	}
+
+	finalName, err := commitFile(tmpPath, name, policy)
+	if err != nil {
+		return "", 0, err
+	}
+
+	InvalidateUsage()
+	return finalName, size, nil
+}
+
+// commitFile 按冲突策略将临时文件移动到目标位置，返回最终的名称
+func commitFile(tmpPath, name, policy string) (string, error) {
+	commitMu.Lock()
+	defer commitMu.Unlock()
+
+	target, err := resolveConflict(name, false, policy)
+	if err != nil {
+		return "", err
+	}
+	// 覆盖已有文件前保留旧内容
+	if err := archiveVersion(target); err != nil {
+		return "", err
+	}
+	if err := fileStorage().Rename(tmpPath, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// tempName 生成保留目录中临时文件的名称，本地存储中与目标位于同一文件系统，保证重命名是原子的
+func tempName(prefix string) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return systemPath("tmp", prefix+"-"+id), nil
+}
+
+// CreateUploadSession 创建分片上传会话
+func CreateUploadSession(owner, path, filename string, size int64, checksum, policy string) (*UploadSession, error) {
+	if err := ValidateName(filename); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("invalid upload size: %d", size)
+	}
+	checksum, err := normalizeChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckUploadSize(size); err != nil {
+		return nil, err
+	}
+	// 提前校验目标路径和冲突，避免上传完成后才发现无法写入
+	name, err := ResolveEntryPath(filepath.Join(path, filename))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveConflict(name, false, policy); err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &UploadSession{
+		ID:        id,
+		Owner:     owner,
+		Path:      path,
+		Filename:  filename,
+		Size:      size,
+		Checksum:  checksum,
+		Conflict:  policy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := saveUploadSession(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetUploadSession 获取分片上传会话，只有创建者可以访问
+func GetUploadSession(id, owner string) (*UploadSession, error) {
+	session, err := loadUploadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Owner != owner {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+// WriteUploadChunk 在指定偏移处追加分片数据，返回写入后的偏移
+// 每个分片单独保存为以偏移命名的文件，完成时再按顺序拼接，存储驱动不需要支持追加写入
+// 连接中断时已收到的数据会保留，客户端可查询偏移后继续上传
+func WriteUploadChunk(id, owner string, offset int64, r io.Reader) (*UploadSession, error) {
+	session, unlock, err := lockUploadSession(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if offset != session.Offset {
+		return session, ErrUploadOffsetMismatch
+	}
+	// 已写入的部分计入用量，只需为剩余部分预留配额
+	release, err := ReserveQuota(session.Size - offset)
+	if err != nil {
+		return session, err
+	}
+	defer release()
+
+	chunkDir, _ := uploadFilePaths(id)
+	chunk := storage.Join(chunkDir, chunkName(offset))
+
+	// 多读取1字节用于判断数据是否超出声明的大小
+	remaining := session.Size - offset
+	reader := &partialReader{r: io.LimitReader(r, remaining+1)}
+	written, err := fileStorage().Write(chunk, reader)
+	InvalidateUsage()
+	if err != nil {
+		return nil, err
+	}
+	copyErr := reader.err
+	if written > remaining {
+		// 分片超出声明的大小，整个分片作废
+		written = 0
+		copyErr = ErrUploadTooLarge
+	}
+	if written == 0 {
+		if err := fileStorage().Remove(chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	session.Offset = offset + written
+	session.UpdatedAt = time.Now()
+	if err := saveUploadSession(session); err != nil {
+		return nil, err
+	}
+
+	return session, copyErr
+}
+
+// FinishUploadSession 拼接分片并校验数据完整性，然后将文件移动到目标路径
+func FinishUploadSession(id, owner string) (*UploadSession, error) {
+	session, unlock, err := lockUploadSession(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if session.Offset != session.Size {
+		return session, ErrUploadIncomplete
+	}
+
+	name, err := ResolveEntryPath(session.RelativePath())
+	if err != nil {
+		return nil, err
+	}
+
+	tmpPath, err := tempName("upload")
+	if err != nil {
+		return nil, err
+	}
+	defer fileStorage().Remove(tmpPath)
+
+	// 拼接的同时计算校验和
+	chunkDir, metaPath := uploadFilePaths(id)
+	chunks := &chunkReader{dir: chunkDir, size: session.Size}
+	hash := sha256.New()
+	size, err := fileStorage().Write(tmpPath, io.TeeReader(chunks, hash))
+	chunks.Close()
+	if err != nil {
+		return nil, err
+	}
+	if size != session.Size {
+		return session, ErrUploadIncomplete
+	}
+	if session.Checksum != "" && hex.EncodeToString(hash.Sum(nil)) != session.Checksum {
+		// 数据已损坏，无法通过续传修复，直接丢弃会话
+		removeUploadSession(id)
+		return session, ErrChecksumMismatch
+	}
+
+	finalName, err := commitFile(tmpPath, name, session.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	// 自动重命名时返回实际写入的位置
+	session.Path = storage.Dir(finalName)
+	session.Filename = path.Base(finalName)
+
+	fileStorage().Remove(chunkDir)
+	fileStorage().Remove(metaPath)
+	InvalidateUsage()
+	return session, nil
+}
+
+// CancelUploadSession 取消分片上传并删除已上传的数据
+func CancelUploadSession(id, owner string) error {
+	_, unlock, err := lockUploadSession(id, owner)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	removeUploadSession(id)
+	InvalidateUsage()
+	return nil
+}
+
+// CleanStaleUploads 清理超时未更新的分片上传会话和残留的临时文件
+func CleanStaleUploads() {
+	dir := systemPath("uploads")
+	entries, err := fileStorage().List(dir)
+	if err != nil {
+		return
+	}
+
+	ttl := time.Duration(config.GetConfig().File.UploadSessionTTL) * time.Second
+	for _, entry := range entries {
+		name := entry.Name()
+		id := name[:strings.Index(name+".", ".")]
+
+		session, err := loadUploadSession(id)
+		if err == nil {
+			if time.Since(session.UpdatedAt) > ttl {
+				removeStaleUpload(id, session.Owner, ttl)
+			}
+			continue
+		}
+
+		// 元数据缺失或损坏的残留文件按修改时间清理
+		if time.Since(entry.ModTime()) > ttl {
+			fileStorage().Remove(storage.Join(dir, name))
+		}
+	}
+
+	// 清理进程异常退出时残留的临时文件
+	tmpDir := systemPath("tmp")
+	tmpEntries, err := fileStorage().List(tmpDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range tmpEntries {
+		if time.Since(entry.ModTime()) > ttl {
+			fileStorage().Remove(storage.Join(tmpDir, entry.Name()))
+		}
+	}
+}
+
+// removeStaleUpload 获取会话的写入锁后确认仍然超时再删除，避免删除正在写入分片或完成的会话
+func removeStaleUpload(id, owner string, ttl time.Duration) {
+	session, unlock, err := lockUploadSession(id, owner)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	if time.Since(session.UpdatedAt) > ttl {
+		removeUploadSession(id)
+	}
+}
+
+// uploadFilePaths 获取会话的分片目录和元数据文件在存储中的名称
+func uploadFilePaths(id string) (string, string) {
+	return systemPath("uploads", id), systemPath("uploads", id+".json")
+}
+
+// chunkName 分片以十六进制的起始偏移命名
+func chunkName(offset int64) string {
+	return fmt.Sprintf("%016x", offset)
+}
+
+// chunkReader 从偏移0开始依次读取各个分片，拼接为完整的文件
+// 每个分片的长度决定下一个分片的偏移，重试时覆盖写入的同一偏移只会保留最后一次的数据
+type chunkReader struct {
+	dir    string
+	offset int64
+	size   int64
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if r.offset >= r.size {
+				return 0, io.EOF
+			}
+			cur, err := fileStorage().OpenRange(storage.Join(r.dir, chunkName(r.offset)), 0, -1)
+			if err != nil {
+				return 0, err
+			}
+			r.cur = cur
+		}
+
+		n, err := r.cur.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// partialReader 把读取错误转换为EOF并记录下来，使连接中断前收到的数据仍能写入
+type partialReader struct {
+	r   io.Reader
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// newID 生成32位十六进制的随机ID，用于上传会话、回收站条目等内部数据
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// validID ID只能是newID生成的十六进制字符串，防止拼接路径时越界
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// loadUploadSession 读取会话元数据
+func loadUploadSession(id string) (*UploadSession, error) {
+	if !validID(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	_, metaPath := uploadFilePaths(id)
+	data, err := storage.ReadFile(fileStorage(), metaPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// saveUploadSession 保存会话元数据，存储驱动保证写入中断时不会留下损坏的元数据
+func saveUploadSession(session *UploadSession) error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, metaPath := uploadFilePaths(session.ID)
+	return storage.WriteFile(fileStorage(), metaPath, data)
+}
+
+// removeUploadSession 删除会话的数据和元数据
+func removeUploadSession(id string) {
+	chunkDir, metaPath := uploadFilePaths(id)
+	fileStorage().Remove(chunkDir)
+	fileStorage().Remove(metaPath)
+}
+
+// uploadLock 会话的写入锁，同一会话同时只允许一个请求写入分片、完成或取消
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int // 持有或等待该锁的请求数，调用方需持有uploadMu
+}
+
+// lockUploadSession 确认会话存在且属于owner后获取写入锁，返回加锁后重新读取的会话和解锁函数
+// 会话不存在时不创建锁，无效的ID不会在锁表中留下条目
+func lockUploadSession(id, owner string) (*UploadSession, func(), error) {
+	if _, err := GetUploadSession(id, owner); err != nil {
+		return nil, nil, err
+	}
+
+	uploadMu.Lock()
+	lock, ok := uploadLocks[id]
+	if !ok {
+		lock = &uploadLock{}
+		uploadLocks[id] = lock
+	}
+	lock.refs++
+	uploadMu.Unlock()
+
+	lock.mu.Lock()
+	unlock := func() {
+		lock.mu.Unlock()
+
+		uploadMu.Lock()
+		defer uploadMu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(uploadLocks, id)
+		}
+	}
+
+	// 等待锁期间会话可能已被完成或取消
+	session, err := GetUploadSession(id, owner)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return session, unlock, nil
+}
+
+// normalizeChecksum 规范化校验和，支持"sha256:<hex>"或纯十六进制
+func normalizeChecksum(checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	checksum = strings.TrimPrefix(checksum, "sha256:")
+	if checksum == "" {
+		return "", nil
+	}
+	if len(checksum) != sha256.Size*2 {
+		return "", ErrInvalidChecksum
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return "", ErrInvalidChecksum
+	}
+	return checksum, nil
+}
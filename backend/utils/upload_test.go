@@ -0,0 +1,69 @@
+package utils_test
+
+import (
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"gin_cloud_drive/backend/utils"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestCleanStaleUploadsWaitsForWriter 清理协程要等正在写入的分片完成，写入刷新了更新时间的会话不能被删除
+func TestCleanStaleUploadsWaitsForWriter(t *testing.T) {
+	useStorage(t, storage.NewMemory())
+	cfg := config.GetConfig()
+	ttl := cfg.File.UploadSessionTTL
+	cfg.File.UploadSessionTTL = 1
+	t.Cleanup(func() { cfg.File.UploadSessionTTL = ttl })
+
+	session, err := utils.CreateUploadSession("admin", "", "slow.bin", 8, "", utils.ConflictFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	// 会话已超时，此时开始写入分片，数据到达前清理协程开始运行
+	pr, pw := io.Pipe()
+	written := make(chan error)
+	go func() {
+		_, err := utils.WriteUploadChunk(session.ID, "admin", 0, pr)
+		written <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cleaned := make(chan struct{})
+	go func() {
+		utils.CleanStaleUploads()
+		close(cleaned)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-cleaned:
+		t.Fatal("cleanup did not wait for the chunk being written")
+	default:
+	}
+	pw.Write([]byte("12345678"))
+	pw.Close()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	<-cleaned
+
+	if got, err := utils.GetUploadSession(session.ID, "admin"); err != nil || got.Offset != 8 {
+		t.Fatalf("session after cleanup = %+v, %v", got, err)
+	}
+	if _, err := utils.FinishUploadSession(session.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超时且没有写入的会话被清理
+	if session, err = utils.CreateUploadSession("admin", "", "idle.bin", 8, "", utils.ConflictFail); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	utils.CleanStaleUploads()
+	if _, err := utils.GetUploadSession(session.ID, "admin"); !errors.Is(err, utils.ErrUploadNotFound) {
+		t.Fatalf("idle session: err = %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/storage"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrVersionNotFound = errors.New("file version not found")
+
+// FileVersion 文件的一个历史版本
+type FileVersion struct {
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modified_time"` // 该版本内容的最后修改时间
+	ArchivedAt time.Time `json:"archived_at"`   // 被覆盖的时间
+}
+
+// versionSet 同一路径下的所有历史版本，按归档时间从旧到新排列
+type versionSet struct {
+	Path     string        `json:"path"`
+	Versions []FileVersion `json:"versions"`
+}
+
+// versionMu 保护版本元数据的读写，需要同时持有commitMu时先获取commitMu
+var versionMu sync.Mutex
+
+// InitVersionCleaner 启动过期历史版本的清理协程
+func InitVersionCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			PruneAllVersions()
+			<-ticker.C
+		}
+	}()
+}
+
+// ListVersions 列出文件的历史版本，最新的在前
+func ListVersions(relativePath string) ([]FileVersion, error) {
+	rel, err := versionKeyPath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	set, err := loadVersionSet(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]FileVersion, 0, len(set.Versions))
+	for i := len(set.Versions) - 1; i >= 0; i-- {
+		versions = append(versions, set.Versions[i])
+	}
+	return versions, nil
+}
+
+// OpenVersion 打开指定版本的内容
+func OpenVersion(relativePath, id string) (storage.File, FileVersion, error) {
+	rel, err := versionKeyPath(relativePath)
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	set, err := loadVersionSet(rel)
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+	version, ok := set.find(id)
+	if !ok {
+		return nil, FileVersion{}, ErrVersionNotFound
+	}
+
+	file, _, err := storage.Open(fileStorage(), versionDataPath(rel, id))
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+	return file, version, nil
+}
+
+// RestoreVersion 将指定版本恢复为当前内容，当前内容会被保存为新的历史版本
+func RestoreVersion(relativePath, id string) error {
+	rel, err := ResolveEntryPath(relativePath)
+	if err != nil {
+		return err
+	}
+
+	commitMu.Lock()
+	defer commitMu.Unlock()
+
+	if info, err := fileStorage().Stat(rel); err == nil && !info.Mode().IsRegular() {
+		return ErrInvalidPath
+	}
+
+	versionMu.Lock()
+	set, err := loadVersionSet(rel)
+	if err != nil {
+		versionMu.Unlock()
+		return err
+	}
+	if _, ok := set.find(id); !ok {
+		versionMu.Unlock()
+		return ErrVersionNotFound
+	}
+
+	// 先复制到临时文件，保证移动到目标位置时是原子的，且不影响版本数据本身
+	tmpPath, err := copyToTemp(versionDataPath(rel, id))
+	versionMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer fileStorage().Remove(tmpPath)
+
+	if err := archiveVersion(rel); err != nil {
+		return err
+	}
+	if err := fileStorage().Rename(tmpPath, rel); err != nil {
+		return err
+	}
+
+	// 被恢复的版本已成为当前内容，从历史中移除
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	if set, err := loadVersionSet(rel); err == nil {
+		set.remove(id)
+		saveVersionSet(set)
+	}
+	fileStorage().Remove(versionDataPath(rel, id))
+
+	InvalidateUsage()
+	return nil
+}
+
+// PruneAllVersions 按配置清理所有文件的过期和超量版本
+func PruneAllVersions() {
+	dir := systemPath("versions")
+	entries, err := fileStorage().List(dir)
+	if err != nil {
+		return
+	}
+
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	for _, entry := range entries {
+		set, err := readVersionSet(storage.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		pruneVersions(set)
+		saveVersionSet(set)
+	}
+	InvalidateUsage()
+}
+
+// archiveVersion 在文件被覆盖前将当前内容保存为历史版本，调用方需持有commitMu
+// 未启用版本管理或文件不存在时直接返回
+func archiveVersion(rel string) error {
+	if config.GetConfig().File.MaxVersions <= 0 {
+		return nil
+	}
+	info, err := fileStorage().Stat(rel)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	set, err := loadVersionSet(rel)
+	if err != nil {
+		return err
+	}
+	// 本地存储使用硬链接、对象存储在服务端复制，都不需要经过本进程传输数据
+	if err := storage.Copy(fileStorage(), rel, versionDataPath(rel, id)); err != nil {
+		return err
+	}
+
+	set.Versions = append(set.Versions, FileVersion{
+		ID:         id,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		ArchivedAt: time.Now(),
+	})
+	pruneVersions(set)
+	return saveVersionSet(set)
+}
+
+// moveVersions 文件或目录被移动后，让历史版本跟随到新路径，调用方需持有commitMu
+func moveVersions(oldRel, newRel string, isDir bool) {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+
+	if !isDir {
+		mergeVersionSet(oldRel, newRel)
+		return
+	}
+
+	// 目录移动时，目录下所有文件的历史版本都需要迁移
+	dir := systemPath("versions")
+	entries, err := fileStorage().List(dir)
+	if err != nil {
+		return
+	}
+	prefix := oldRel + "/"
+	for _, entry := range entries {
+		set, err := readVersionSet(storage.Join(dir, entry.Name()))
+		if err != nil || !strings.HasPrefix(set.Path, prefix) {
+			continue
+		}
+		mergeVersionSet(set.Path, newRel+"/"+strings.TrimPrefix(set.Path, prefix))
+	}
+}
+
+// mergeVersionSet 将oldRel的历史版本并入newRel，调用方需持有versionMu
+func mergeVersionSet(oldRel, newRel string) {
+	src, err := loadVersionSet(oldRel)
+	if err != nil || len(src.Versions) == 0 {
+		return
+	}
+
+	dst, err := loadVersionSet(newRel)
+	if err != nil {
+		return
+	}
+	if len(dst.Versions) == 0 {
+		// 目标没有历史版本时直接移动整个目录
+		fileStorage().Remove(versionDir(newRel))
+		if err := fileStorage().Rename(versionDir(oldRel), versionDir(newRel)); err != nil {
+			return
+		}
+		src.Path = newRel
+		saveVersionSet(src)
+		return
+	}
+
+	for _, version := range src.Versions {
+		if err := fileStorage().Rename(versionDataPath(oldRel, version.ID), versionDataPath(newRel, version.ID)); err == nil {
+			dst.Versions = append(dst.Versions, version)
+		}
+	}
+	sort.Slice(dst.Versions, func(i, j int) bool {
+		return dst.Versions[i].ArchivedAt.Before(dst.Versions[j].ArchivedAt)
+	})
+	pruneVersions(dst)
+	if err := saveVersionSet(dst); err == nil {
+		fileStorage().Remove(versionDir(oldRel))
+	}
+}
+
+// pruneVersions 删除超出数量上限或保留期的版本，调用方需持有versionMu
+func pruneVersions(set *versionSet) {
+	cfg := config.GetConfig().File
+	retention := time.Duration(cfg.VersionRetention) * time.Second
+
+	kept := set.Versions[:0]
+	for i, version := range set.Versions {
+		expired := retention > 0 && time.Since(version.ArchivedAt) > retention
+		excess := cfg.MaxVersions > 0 && len(set.Versions)-i > cfg.MaxVersions
+		if expired || excess {
+			fileStorage().Remove(versionDataPath(set.Path, version.ID))
+			continue
+		}
+		kept = append(kept, version)
+	}
+	set.Versions = kept
+}
+
+// find 查找指定ID的版本
+func (s *versionSet) find(id string) (FileVersion, bool) {
+	for _, version := range s.Versions {
+		if version.ID == id {
+			return version, true
+		}
+	}
+	return FileVersion{}, false
+}
+
+// remove 移除指定ID的版本
+func (s *versionSet) remove(id string) {
+	for i, version := range s.Versions {
+		if version.ID == id {
+			s.Versions = append(s.Versions[:i], s.Versions[i+1:]...)
+			return
+		}
+	}
+}
+
+// versionKeyPath 规范化用户提交的路径，作为查找历史版本的键
+func versionKeyPath(relativePath string) (string, error) {
+	return ResolveEntryPath(relativePath)
+}
+
+// versionDir 获取路径对应的版本目录，以路径的哈希命名，避免目录层级和特殊字符问题
+func versionDir(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return systemPath("versions", hex.EncodeToString(sum[:]))
+}
+
+// versionDataPath 获取版本数据文件在存储中的名称
+func versionDataPath(rel, id string) string {
+	return storage.Join(versionDir(rel), id)
+}
+
+// loadVersionSet 读取路径的版本元数据，不存在时返回空集合
+func loadVersionSet(rel string) (*versionSet, error) {
+	set, err := readVersionSet(versionDir(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &versionSet{Path: rel}, nil
+	}
+	return set, err
+}
+
+// readVersionSet 读取版本目录中的元数据
+func readVersionSet(dir string) (*versionSet, error) {
+	data, err := storage.ReadFile(fileStorage(), storage.Join(dir, "versions.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var set versionSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// saveVersionSet 保存版本元数据，没有任何版本时删除整个版本目录
+func saveVersionSet(set *versionSet) error {
+	dir := versionDir(set.Path)
+	if len(set.Versions) == 0 {
+		return fileStorage().Remove(dir)
+	}
+
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(fileStorage(), storage.Join(dir, "versions.json"), data)
+}
+
+// copyToTemp 将文件复制到保留目录中的临时文件，返回临时文件的名称
+func copyToTemp(src string) (string, error) {
+	tmpPath, err := tempName("restore")
+	if err != nil {
+		return "", err
+	}
+	if err := storage.Copy(fileStorage(), src, tmpPath); err != nil {
+		fileStorage().Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
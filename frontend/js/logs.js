@@ -183,6 +183,7 @@ function updateLogStats(stats) {
     document.getElementById('fileLogs').textContent = stats.type_stats.FILE || 0;
     document.getElementById('userLogs').textContent = stats.type_stats.USER || 0;
     document.getElementById('accessLogs').textContent = stats.type_stats.ACCESS || 0;
+    document.getElementById('securityLogs').textContent = stats.type_stats.SECURITY || 0;
 }
 
 // 重置查询表单
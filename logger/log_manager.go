@@ -16,6 +16,7 @@ type LogQueryParams struct {
 	Level     string    `json:"level"`      // 日志级别（可选）
 	Type      string    `json:"type"`       // 日志类型（可选）
 	IP        string    `json:"ip"`         // IP地址（可选）
+	User      string    `json:"user"`       // 用户名（可选）
 	Action    string    `json:"action"`     // 操作内容（可选）
 	File      string    `json:"file"`       // 文件名（可选）
 	Page      int       `json:"page"`       // 页码
@@ -46,28 +47,15 @@ func QueryLogs(params LogQueryParams) (*LogQueryResult, error) {
 		params.StartDate = params.EndDate.AddDate(0, 0, -7) // 默认查询最近7天
 	}
 
-	// 获取日志目录
-	logPath := "./logs"
-	if globalLogger != nil {
-		logPath = globalLogger.logPath
-	}
-
 	// 读取所有日志文件
-	files, err := os.ReadDir(logPath)
+	files, err := listLogFiles()
 	if err != nil {
-		return nil, fmt.Errorf("读取日志目录失败: %v", err)
+		return nil, err
 	}
 
 	// 筛选出日期范围内的日志文件
 	var relevantFiles []string
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		filename := file.Name()
-		if len(filename) < 13 || filename[:5] != "logs_" || filename[13:] != ".log" {
-			continue
-		}
+	for _, filename := range files {
 		// 解析文件名中的日期
 		fileDate, err := time.Parse("20060102", filename[5:13])
 		if err != nil {
@@ -76,7 +64,7 @@ func QueryLogs(params LogQueryParams) (*LogQueryResult, error) {
 		// 检查是否在查询日期范围内
 		if (fileDate.Equal(params.StartDate) || fileDate.After(params.StartDate)) &&
 			(fileDate.Equal(params.EndDate) || fileDate.Before(params.EndDate.AddDate(0, 0, 1))) {
-			relevantFiles = append(relevantFiles, filepath.Join(logPath, filename))
+			relevantFiles = append(relevantFiles, filename)
 		}
 	}
 
@@ -87,8 +75,8 @@ func QueryLogs(params LogQueryParams) (*LogQueryResult, error) {
 
 	// 读取并筛选日志
 	var allLogs []LogEntry
-	for _, filePath := range relevantFiles {
-		fileContent, err := os.ReadFile(filePath)
+	for _, filename := range relevantFiles {
+		fileContent, err := readLogFile(filename)
 		if err != nil {
 			continue
 		}
@@ -165,6 +153,11 @@ func matchLogEntry(entry LogEntry, params LogQueryParams) bool {
 		return false
 	}
 
+	// 用户名匹配
+	if params.User != "" && entry.User != params.User {
+		return false
+	}
+
 	// 操作内容匹配
 	if params.Action != "" && entry.Action != params.Action {
 		return false
@@ -201,44 +194,31 @@ type LogStats struct {
 	TotalLogs   int64            `json:"total_logs"`   // 总日志数
 	TypeStats   map[string]int64 `json:"type_stats"`   // 按类型统计
 	IPStats     map[string]int64 `json:"ip_stats"`     // 按IP统计
+	UserStats   map[string]int64 `json:"user_stats"`   // 按用户统计
 	ActionStats map[string]int64 `json:"action_stats"` // 按操作统计
 	DailyStats  map[string]int64 `json:"daily_stats"`  // 按天统计
 }
 
 // GetLogStats 获取日志统计信息
 func GetLogStats() (*LogStats, error) {
-	// 获取日志目录
-	logPath := "./logs"
-	if globalLogger != nil {
-		logPath = globalLogger.logPath
-	}
-
 	// 读取所有日志文件
-	files, err := os.ReadDir(logPath)
+	files, err := listLogFiles()
 	if err != nil {
-		return nil, fmt.Errorf("读取日志目录失败: %v", err)
+		return nil, err
 	}
 
 	stats := &LogStats{
 		TotalLogs:   0,
 		TypeStats:   make(map[string]int64),
 		IPStats:     make(map[string]int64),
+		UserStats:   make(map[string]int64),
 		ActionStats: make(map[string]int64),
 		DailyStats:  make(map[string]int64),
 	}
 
 	// 遍历所有日志文件
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		filename := file.Name()
-		if len(filename) < 13 || filename[:5] != "logs_" || filename[13:] != ".log" {
-			continue
-		}
-
-		filePath := filepath.Join(logPath, filename)
-		fileContent, err := os.ReadFile(filePath)
+	for _, filename := range files {
+		fileContent, err := readLogFile(filename)
 		if err != nil {
 			continue
 		}
@@ -259,6 +239,9 @@ func GetLogStats() (*LogStats, error) {
 			stats.TotalLogs++
 			stats.TypeStats[entry.Type]++
 			stats.IPStats[entry.IP]++
+			if entry.User != "" {
+				stats.UserStats[entry.User]++
+			}
 			stats.ActionStats[entry.Action]++
 			stats.DailyStats[entry.Timestamp.Format("2006-01-02")]++
 		}
@@ -273,32 +256,18 @@ func ClearOldLogs(days int) (int64, error) {
 		days = 7 // 默认清理7天前的日志
 	}
 
-	// 获取日志目录
-	logPath := "./logs"
-	if globalLogger != nil {
-		logPath = globalLogger.logPath
-	}
-
 	// 计算清理日期
 	cleanDate := time.Now().AddDate(0, 0, -days)
 
 	// 读取所有日志文件
-	files, err := os.ReadDir(logPath)
+	files, err := listLogFiles()
 	if err != nil {
-		return 0, fmt.Errorf("读取日志目录失败: %v", err)
+		return 0, err
 	}
 
 	var deletedCount int64
 	// 遍历所有日志文件
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		filename := file.Name()
-		if len(filename) < 13 || filename[:5] != "logs_" || filename[13:] != ".log" {
-			continue
-		}
-
+	for _, filename := range files {
 		// 解析文件名中的日期
 		fileDate, err := time.Parse("20060102", filename[5:13])
 		if err != nil {
@@ -307,8 +276,7 @@ func ClearOldLogs(days int) (int64, error) {
 
 		// 检查是否需要清理
 		if fileDate.Before(cleanDate) {
-			filePath := filepath.Join(logPath, filename)
-			if err := os.Remove(filePath); err != nil {
+			if err := removeLogFile(filename); err != nil {
 				continue
 			}
 			deletedCount++
@@ -317,3 +285,79 @@ func ClearOldLogs(days int) (int64, error) {
 
 	return deletedCount, nil
 }
+
+// logDir 获取日志目录
+func logDir() string {
+	if globalLogger != nil {
+		return globalLogger.logPath
+	}
+	return "./logs"
+}
+
+// memoryLogger 获取只保存在内存中的日志管理器，日志写入磁盘时返回nil
+func memoryLogger() *Logger {
+	if globalLogger != nil && globalLogger.memFiles != nil {
+		return globalLogger
+	}
+	return nil
+}
+
+// listLogFiles 列出所有日志文件名（logs_20060102.log）
+func listLogFiles() ([]string, error) {
+	if l := memoryLogger(); l != nil {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		names := make([]string, 0, len(l.memFiles))
+		for name := range l.memFiles {
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	files, err := os.ReadDir(logDir())
+	if err != nil {
+		return nil, fmt.Errorf("读取日志目录失败: %v", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		filename := file.Name()
+		if len(filename) < 13 || filename[:5] != "logs_" || filename[13:] != ".log" {
+			continue
+		}
+		names = append(names, filename)
+	}
+	return names, nil
+}
+
+// readLogFile 读取日志文件内容
+func readLogFile(filename string) ([]byte, error) {
+	if l := memoryLogger(); l != nil {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		// 追加写入不会修改已有的内容，可以直接返回
+		data, ok := l.memFiles[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return data, nil
+	}
+	return os.ReadFile(filepath.Join(logDir(), filename))
+}
+
+// removeLogFile 删除日志文件
+func removeLogFile(filename string) error {
+	if l := memoryLogger(); l != nil {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		delete(l.memFiles, filename)
+		return nil
+	}
+	return os.Remove(filepath.Join(logDir(), filename))
+}
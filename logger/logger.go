@@ -19,11 +19,12 @@ const (
 
 // 日志类型
 const (
-	TypeFile   = "FILE"   // 文件操作
-	TypeUser   = "USER"   // 用户操作
-	TypeSystem = "SYSTEM" // 系统操作
-	TypeAccess = "ACCESS" // 访问记录
-	TypeError  = "ERROR"  // 错误记录
+	TypeFile     = "FILE"     // 文件操作
+	TypeUser     = "USER"     // 用户操作
+	TypeSystem   = "SYSTEM"   // 系统操作
+	TypeAccess   = "ACCESS"   // 访问记录
+	TypeError    = "ERROR"    // 错误记录
+	TypeSecurity = "SECURITY" // 安全事件（暴力破解、账号锁定等）
 )
 
 // LogEntry 日志条目结构体
@@ -33,6 +34,7 @@ type LogEntry struct {
 	Type      string    `json:"type"`           // 日志类型
 	IP        string    `json:"ip"`             // 客户端IP
 	UserAgent string    `json:"user_agent"`     // 用户代理
+	User      string    `json:"user,omitempty"` // 操作用户（可选）
 	Action    string    `json:"action"`         // 操作内容
 	Details   string    `json:"details"`        // 详细信息
 	File      string    `json:"file,omitempty"` // 涉及的文件（可选）
@@ -45,6 +47,7 @@ type Logger struct {
 	mutex    sync.Mutex
 	logLevel string
 	logPath  string
+	memFiles map[string][]byte // logPath为空时按文件名保存在内存中的日志
 }
 
 // 全局日志实例
@@ -53,7 +56,7 @@ var (
 	once         sync.Once
 )
 
-// InitLogger 初始化日志管理器
+// InitLogger 初始化日志管理器，logPath为空时日志只保存在内存中，不写入磁盘
 func InitLogger(logPath string, logLevel string) error {
 	var err error
 	once.Do(func() {
@@ -61,6 +64,10 @@ func InitLogger(logPath string, logLevel string) error {
 			logLevel: logLevel,
 			logPath:  logPath,
 		}
+		if logPath == "" {
+			globalLogger.memFiles = make(map[string][]byte)
+			return
+		}
 		err = globalLogger.openLogFile()
 	})
 	return err
@@ -73,9 +80,7 @@ func (l *Logger) openLogFile() error {
 		return fmt.Errorf("创建日志目录失败: %v", err)
 	}
 
-	// 日志文件名格式：logs_20060102.log
-	logFileName := fmt.Sprintf("logs_%s.log", time.Now().Format("20060102"))
-	logFilePath := fmt.Sprintf("%s/%s", l.logPath, logFileName)
+	logFilePath := fmt.Sprintf("%s/%s", l.logPath, logFileName(time.Now()))
 
 	// 打开或创建日志文件
 	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -87,11 +92,44 @@ func (l *Logger) openLogFile() error {
 	return nil
 }
 
+// logFileName 日志文件名格式：logs_20060102.log
+func logFileName(t time.Time) string {
+	return fmt.Sprintf("logs_%s.log", t.Format("20060102"))
+}
+
 // writeLog 写入日志
 func (l *Logger) writeLog(entry LogEntry) error {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
+	// 转换为JSON格式
+	logJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("日志转换为JSON失败: %v", err)
+	}
+
+	if l.memFiles != nil {
+		name := logFileName(time.Now())
+		l.memFiles[name] = append(append(l.memFiles[name], logJSON...), '\n')
+	} else if err := l.writeFile(logJSON); err != nil {
+		return err
+	}
+
+	// 同时输出到控制台
+	fmt.Printf("%s [%s] [%s] %s %s - %s\n",
+		entry.Timestamp.Format("2006-01-02 15:04:05"),
+		entry.Level,
+		entry.Type,
+		entry.IP,
+		entry.User,
+		entry.Action,
+	)
+
+	return nil
+}
+
+// writeFile 将一行日志追加到当天的日志文件，调用方需持有锁
+func (l *Logger) writeFile(logJSON []byte) error {
 	// 检查日志文件是否需要轮转（每天一个文件）
 	currentDate := time.Now().Format("20060102")
 
@@ -116,32 +154,16 @@ func (l *Logger) writeLog(entry LogEntry) error {
 		}
 	}
 
-	// 转换为JSON格式
-	logJSON, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("日志转换为JSON失败: %v", err)
-	}
-
 	// 写入文件
-	_, err = l.logFile.WriteString(fmt.Sprintf("%s\n", string(logJSON)))
+	_, err := l.logFile.WriteString(fmt.Sprintf("%s\n", string(logJSON)))
 	if err != nil {
 		return fmt.Errorf("写入日志文件失败: %v", err)
 	}
-
-	// 同时输出到控制台
-	fmt.Printf("%s [%s] [%s] %s - %s\n",
-		entry.Timestamp.Format("2006-01-02 15:04:05"),
-		entry.Level,
-		entry.Type,
-		entry.IP,
-		entry.Action,
-	)
-
 	return nil
 }
 
 // log 通用日志记录函数
-func log(level, logType, ip, userAgent, action, details string, file string, size int64) error {
+func log(level, logType, ip, userAgent, user, action, details string, file string, size int64) error {
 	if globalLogger == nil {
 		// 如果未初始化，使用默认配置
 		if err := InitLogger("./logs", LevelInfo); err != nil {
@@ -160,6 +182,7 @@ func log(level, logType, ip, userAgent, action, details string, file string, siz
 		Type:      logType,
 		IP:        ip,
 		UserAgent: userAgent,
+		User:      user,
 		Action:    action,
 		Details:   details,
 		File:      file,
@@ -183,28 +206,28 @@ func shouldLog(currentLevel, logLevel string) bool {
 }
 
 // Debug 记录调试日志
-func Debug(logType, ip, userAgent, action, details string, file string, size int64) error {
-	return log(LevelDebug, logType, ip, userAgent, action, details, file, size)
+func Debug(logType, ip, userAgent, user, action, details string, file string, size int64) error {
+	return log(LevelDebug, logType, ip, userAgent, user, action, details, file, size)
 }
 
 // Info 记录信息日志
-func Info(logType, ip, userAgent, action, details string, file string, size int64) error {
-	return log(LevelInfo, logType, ip, userAgent, action, details, file, size)
+func Info(logType, ip, userAgent, user, action, details string, file string, size int64) error {
+	return log(LevelInfo, logType, ip, userAgent, user, action, details, file, size)
 }
 
 // Warn 记录警告日志
-func Warn(logType, ip, userAgent, action, details string, file string, size int64) error {
-	return log(LevelWarn, logType, ip, userAgent, action, details, file, size)
+func Warn(logType, ip, userAgent, user, action, details string, file string, size int64) error {
+	return log(LevelWarn, logType, ip, userAgent, user, action, details, file, size)
 }
 
 // Error 记录错误日志
-func Error(logType, ip, userAgent, action, details string, file string, size int64) error {
-	return log(LevelError, logType, ip, userAgent, action, details, file, size)
+func Error(logType, ip, userAgent, user, action, details string, file string, size int64) error {
+	return log(LevelError, logType, ip, userAgent, user, action, details, file, size)
 }
 
 // Fatal 记录致命错误日志
-func Fatal(logType, ip, userAgent, action, details string, file string, size int64) error {
-	if err := log(LevelFatal, logType, ip, userAgent, action, details, file, size); err != nil {
+func Fatal(logType, ip, userAgent, user, action, details string, file string, size int64) error {
+	if err := log(LevelFatal, logType, ip, userAgent, user, action, details, file, size); err != nil {
 		return err
 	}
 	os.Exit(1)
@@ -212,26 +235,31 @@ func Fatal(logType, ip, userAgent, action, details string, file string, size int
 }
 
 // LogFileOperation 记录文件操作日志
-func LogFileOperation(ip, userAgent, action, filePath string, fileSize int64) error {
-	return Info(TypeFile, ip, userAgent, action, "", filePath, fileSize)
+func LogFileOperation(ip, userAgent, user, action, filePath string, fileSize int64) error {
+	return Info(TypeFile, ip, userAgent, user, action, "", filePath, fileSize)
 }
 
 // LogUserOperation 记录用户操作日志
-func LogUserOperation(ip, userAgent, action, details string) error {
-	return Info(TypeUser, ip, userAgent, action, details, "", 0)
+func LogUserOperation(ip, userAgent, user, action, details string) error {
+	return Info(TypeUser, ip, userAgent, user, action, details, "", 0)
 }
 
 // LogSystemOperation 记录系统操作日志
-func LogSystemOperation(ip, userAgent, action, details string) error {
-	return Info(TypeSystem, ip, userAgent, action, details, "", 0)
+func LogSystemOperation(ip, userAgent, user, action, details string) error {
+	return Info(TypeSystem, ip, userAgent, user, action, details, "", 0)
 }
 
 // LogAccess 记录访问日志
-func LogAccess(ip, userAgent, action, details string) error {
-	return Info(TypeAccess, ip, userAgent, action, details, "", 0)
+func LogAccess(ip, userAgent, user, action, details string) error {
+	return Info(TypeAccess, ip, userAgent, user, action, details, "", 0)
+}
+
+// LogSecurityEvent 记录安全事件，使用WARN级别便于在日志页面筛选
+func LogSecurityEvent(ip, userAgent, user, action, details string) error {
+	return Warn(TypeSecurity, ip, userAgent, user, action, details, "", 0)
 }
 
 // LogError 记录错误日志
-func LogError(ip, userAgent, action, details string) error {
-	return Error(TypeError, ip, userAgent, action, details, "", 0)
+func LogError(ip, userAgent, user, action, details string) error {
+	return Error(TypeError, ip, userAgent, user, action, details, "", 0)
 }
@@ -1,54 +1,117 @@
-package main
-
-import (
-	"gin_cloud_drive/backend/config"
-	"gin_cloud_drive/backend/routes"
-	"gin_cloud_drive/logger"
-	"gin_cloud_drive/system"
-	"fmt"
-	"log"
-	"os"
-
-	"github.com/gin-gonic/gin"
-)
-
-func main() {
-	// 初始化配置
-	config.InitConfig()
-
-	// 初始化日志系统
-	if err := logger.InitLogger("./logs", "INFO"); err != nil {
-		log.Fatalf("初始化日志系统失败: %v", err)
-	}
-
-	// 检测并创建carousel文件夹
-	cfg := config.GetConfig()
-	carouselPath := fmt.Sprintf("%s/carousel", cfg.File.UploadPath)
-	if _, err := os.Stat(carouselPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(carouselPath, 0755); err != nil {
-			logger.LogError("", "", "创建carousel文件夹失败", fmt.Sprintf("创建carousel文件夹失败: %v", err))
-		} else {
-			logger.LogSystemOperation("", "", "创建carousel文件夹", fmt.Sprintf("成功创建carousel文件夹: %s", carouselPath))
-		}
-	}
-
-	// 初始化系统状态监控
-	system.InitSystemMonitor()
-
-	// 创建Gin引擎
-	r := gin.Default()
-
-	// 设置静态文件服务
-	r.Static("/static", "./frontend")
-	r.Static("/upload", "./upload")
-
-	// 注册路由
-	routes.RegisterRoutes(r)
-
-	// 启动服务器
-	port := config.GetConfig().Server.Port
-	fmt.Printf("服务器运行在 http://localhost:%s\n", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("启动服务器失败: %v", err)
-	}
-}
+package main
+
+import (
+	"gin_cloud_drive/backend/config"
+	"gin_cloud_drive/backend/models"
+	"gin_cloud_drive/backend/routes"
+	"gin_cloud_drive/backend/utils"
+	"gin_cloud_drive/logger"
+	"gin_cloud_drive/system"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	// 初始化配置
+	config.InitConfig()
+
+	// 初始化日志系统
+	if err := logger.InitLogger("./logs", "INFO"); err != nil {
+		log.Fatalf("初始化日志系统失败: %v", err)
+	}
+
+	// 初始化用户存储
+	if err := models.InitUserStore(); err != nil {
+		log.Fatalf("初始化用户存储失败: %v", err)
+	}
+
+	// 初始化会话存储
+	if err := models.InitSessionStore(); err != nil {
+		log.Fatalf("初始化会话存储失败: %v", err)
+	}
+
+	// 初始化API令牌存储
+	if err := models.InitTokenStore(); err != nil {
+		log.Fatalf("初始化API令牌存储失败: %v", err)
+	}
+
+	// 初始化两步验证存储
+	if err := models.InitTwoFactorStore(); err != nil {
+		log.Fatalf("初始化两步验证存储失败: %v", err)
+	}
+
+	// 初始化单点登录
+	if err := models.InitOIDC(); err != nil {
+		log.Fatalf("初始化单点登录失败: %v", err)
+	}
+
+	// 初始化LDAP认证
+	if err := models.InitLDAP(); err != nil {
+		log.Fatalf("初始化LDAP认证失败: %v", err)
+	}
+
+	// 初始化分享存储
+	if err := models.InitShareStore(); err != nil {
+		log.Fatalf("初始化分享存储失败: %v", err)
+	}
+
+	// 初始化游客访问规则
+	if err := models.InitAccessStore(); err != nil {
+		log.Fatalf("初始化游客访问规则失败: %v", err)
+	}
+
+	// 初始化用户组和目录权限
+	if err := models.InitGroupStore(); err != nil {
+		log.Fatalf("初始化用户组失败: %v", err)
+	}
+	if err := models.InitACLStore(); err != nil {
+		log.Fatalf("初始化目录权限失败: %v", err)
+	}
+
+	// 初始化文件存储
+	if err := utils.InitStorage(); err != nil {
+		log.Fatalf("初始化文件存储失败: %v", err)
+	}
+
+	// 检测并创建carousel文件夹
+	if _, err := utils.StatEntry("carousel"); errors.Is(err, fs.ErrNotExist) {
+		if err := utils.CreateDirectory("carousel"); err != nil {
+			logger.LogError("", "", "", "创建carousel文件夹失败", fmt.Sprintf("创建carousel文件夹失败: %v", err))
+		} else {
+			logger.LogSystemOperation("", "", "", "创建carousel文件夹", "成功创建carousel文件夹")
+		}
+	}
+
+	// 启动分片上传会话、回收站和历史版本的过期清理
+	utils.InitUploadCleaner()
+	utils.InitTrashCleaner()
+	utils.InitVersionCleaner()
+
+	// 初始化系统状态监控
+	system.InitSystemMonitor()
+
+	// 创建Gin引擎
+	r := gin.Default()
+
+	// 只信任配置的反向代理，否则客户端可以伪造X-Forwarded-For绕过按IP的登录限制
+	if err := r.SetTrustedProxies(config.GetConfig().Server.TrustedProxies); err != nil {
+		log.Fatalf("配置可信代理失败: %v", err)
+	}
+
+	// 设置静态文件服务
+	r.Static("/static", "./frontend")
+
+	// 注册路由
+	routes.RegisterRoutes(r)
+
+	// 启动服务器
+	port := config.GetConfig().Server.Port
+	fmt.Printf("服务器运行在 http://localhost:%s\n", port)
+	if err := r.Run(":" + port); err != nil {
+		log.Fatalf("启动服务器失败: %v", err)
+	}
+}
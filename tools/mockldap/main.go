@@ -0,0 +1,85 @@
+// mockldap 本地测试用的LDAP目录服务，条目保存在内存中
+// 不指定-data时使用内置的示例目录：
+//
+//	cn=admin,dc=example,dc=com      密码admin   服务账号
+//	uid=alice,ou=people,...         密码alice   属于admins组
+//	uid=bob,ou=people,...           密码bob     属于staff组
+//
+// 用法：
+//
+//	go run ./tools/mockldap -addr 127.0.0.1:3389
+//
+// 网盘配置：url为ldap://127.0.0.1:3389，base_dn为ou=people,dc=example,dc=com，
+// bind_dn为cn=admin,dc=example,dc=com，bind_password为admin，admin_groups为["admins"]
+//
+// -data指定的JSON文件格式：[{"dn": "...", "password": "...", "attributes": {"uid": ["..."]}}]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"gin_cloud_drive/backend/ldap"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// entry 目录中的一个条目
+type entry struct {
+	DN         string              `json:"dn"`
+	Password   string              `json:"password"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// defaultEntries 内置的示例目录
+var defaultEntries = []entry{
+	{DN: "cn=admin,dc=example,dc=com", Password: "admin", Attributes: map[string][]string{
+		"objectClass": {"person"}, "cn": {"admin"},
+	}},
+	{DN: "uid=alice,ou=people,dc=example,dc=com", Password: "alice", Attributes: map[string][]string{
+		"objectClass": {"inetOrgPerson"}, "uid": {"alice"}, "cn": {"Alice"}, "mail": {"alice@example.com"},
+		"memberOf": {"cn=admins,ou=groups,dc=example,dc=com"},
+	}},
+	{DN: "uid=bob,ou=people,dc=example,dc=com", Password: "bob", Attributes: map[string][]string{
+		"objectClass": {"inetOrgPerson"}, "uid": {"bob"}, "cn": {"Bob"}, "mail": {"bob@example.com"},
+		"memberOf": {"cn=staff,ou=groups,dc=example,dc=com"},
+	}},
+	{DN: "cn=admins,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+		"objectClass": {"groupOfNames"}, "cn": {"admins"}, "member": {"uid=alice,ou=people,dc=example,dc=com"},
+	}},
+	{DN: "cn=staff,ou=groups,dc=example,dc=com", Attributes: map[string][]string{
+		"objectClass": {"groupOfNames"}, "cn": {"staff"}, "member": {"uid=bob,ou=people,dc=example,dc=com"},
+	}},
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:3389", "监听地址")
+	dataFile := flag.String("data", "", "目录条目的JSON文件，为空时使用内置示例")
+	flag.Parse()
+
+	entries := defaultEntries
+	if *dataFile != "" {
+		data, err := os.ReadFile(*dataFile)
+		if err != nil {
+			log.Fatalf("读取目录文件失败: %v", err)
+		}
+		entries = nil
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Fatalf("解析目录文件失败: %v", err)
+		}
+	}
+
+	server := ldap.NewServer()
+	for _, e := range entries {
+		server.AddEntry(e.DN, e.Attributes, e.Password)
+	}
+	if err := server.Listen(*addr); err != nil {
+		log.Fatalf("监听失败: %v", err)
+	}
+	log.Printf("mock LDAP server listening on %s (%d entries)", server.URL(), len(entries))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	server.Close()
+}
@@ -0,0 +1,37 @@
+// mocks3 本地测试用的S3兼容对象存储，对象保存在内存中，进程退出后丢失
+// 只支持路径风格的地址，设置了-access-key时校验请求的SigV4签名
+//
+// 用法：
+//
+//	go run ./tools/mocks3 -addr 127.0.0.1:9000
+//
+// 网盘配置：storage为s3，s3.endpoint为http://127.0.0.1:9000，s3.bucket为drive，
+// s3.access_key_id为minioadmin，s3.secret_access_key为minioadmin，s3.path_style为true
+package main
+
+import (
+	"flag"
+	"gin_cloud_drive/backend/storage"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "监听地址")
+	bucket := flag.String("bucket", "drive", "存储桶名称")
+	accessKey := flag.String("access-key", "minioadmin", "访问密钥ID，为空时不校验签名")
+	secretKey := flag.String("secret-key", "minioadmin", "访问密钥")
+	flag.Parse()
+
+	server := storage.NewS3Server(*bucket, *accessKey, *secretKey)
+	if err := server.Listen(*addr); err != nil {
+		log.Fatalf("监听失败: %v", err)
+	}
+	log.Printf("mock S3 server listening on %s (bucket %s)", server.URL(), *bucket)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	server.Close()
+}